@@ -0,0 +1,189 @@
+// Command admin manages administrator accounts from the server's shell.
+// Signup only grants the user role, so the first administrator is created
+// here:
+//
+//	go run ./cmd/admin bootstrap -phone +218912345678 -name "Admin"
+//	go run ./cmd/admin list
+//	go run ./cmd/admin revoke -phone +218912345678
+//
+// The password of a new account is read from ADMIN_PASSWORD, or from the
+// -password flag, so it does not have to appear in the shell history.
+//
+// Migration 000018 revokes every administrator grant, as signup used to hand
+// them out; run bootstrap for each real administrator once it is applied.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"project/internal/data"
+	"project/utils"
+	"project/utils/validator"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: admin <command> [flags]
+
+commands:
+  bootstrap -phone N [-name NAME -password P]  make a user an administrator, creating the account if needed
+  list                                         list administrators
+  revoke -phone N                              remove the administrator role from a user
+`
+
+func main() {
+	// .env is optional here; DATABASE_URL may come from the environment.
+	_ = godotenv.Load(".env")
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	var err error
+	switch os.Args[1] {
+	case "bootstrap":
+		err = bootstrap(ctx, os.Args[2:])
+	case "list":
+		err = list(ctx, os.Args[2:])
+	case "revoke":
+		err = revoke(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "admin:", err)
+		os.Exit(1)
+	}
+}
+
+func openModel(dsn string) (data.Model, error) {
+	if dsn == "" {
+		return data.Model{}, errors.New("DATABASE_URL is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := sqlx.ConnectContext(ctx, "postgres", dsn)
+	if err != nil {
+		return data.Model{}, err
+	}
+	utils.SetDB(db)
+
+	return data.NewModels(db), nil
+}
+
+func bootstrap(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	dsn := fs.String("db-dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN")
+	phone := fs.String("phone", "", "Phone number of the administrator")
+	name := fs.String("name", "", "Name, when the account does not exist yet")
+	password := fs.String("password", os.Getenv("ADMIN_PASSWORD"), "Password, when the account does not exist yet")
+	fs.Parse(args)
+
+	model, err := openModel(*dsn)
+	if err != nil {
+		return err
+	}
+
+	user, err := model.UserDB.GetUserByPhoneNumber(ctx, strings.TrimSpace(*phone))
+	switch {
+	case errors.Is(err, data.ErrUserNotFound):
+		user = &data.User{
+			Name:        strings.TrimSpace(*name),
+			PhoneNumber: strings.TrimSpace(*phone),
+			Password:    *password,
+		}
+		v := validator.New()
+		data.ValidateUser(v, user, "name", "phone_number", "password")
+		v.Check(user.Password != "", "password", "كلمة المرور مطلوبة")
+		if !v.Valid() {
+			return fmt.Errorf("invalid account: %v", v.Errors)
+		}
+
+		user.Password, err = utils.HashPassword(user.Password)
+		if err != nil {
+			return err
+		}
+		if err := model.UserDB.InsertUser(ctx, user); err != nil {
+			return err
+		}
+		if err := model.UserRoleDB.GrantRole(ctx, user.ID, data.RoleUser); err != nil {
+			return err
+		}
+		fmt.Printf("Created account %s for %s\n", user.ID, user.PhoneNumber)
+	case err != nil:
+		return err
+	}
+
+	err = model.UserRoleDB.GrantRole(ctx, user.ID, data.RoleAdmin)
+	if errors.Is(err, data.ErrHasRole) {
+		fmt.Printf("%s is already an administrator\n", user.PhoneNumber)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is now an administrator\n", user.PhoneNumber)
+	return nil
+}
+
+func list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	dsn := fs.String("db-dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN")
+	fs.Parse(args)
+
+	model, err := openModel(*dsn)
+	if err != nil {
+		return err
+	}
+
+	admins, err := model.UserRoleDB.UsersWithRole(ctx, data.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	for _, user := range admins {
+		fmt.Printf("%s\t%s\t%s\t%s\n", user.ID, user.PhoneNumber, user.Name, user.CreatedAt.Format(time.DateTime))
+	}
+	fmt.Printf("%d administrators\n", len(admins))
+	return nil
+}
+
+func revoke(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	dsn := fs.String("db-dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN")
+	phone := fs.String("phone", "", "Phone number of the administrator")
+	fs.Parse(args)
+
+	model, err := openModel(*dsn)
+	if err != nil {
+		return err
+	}
+
+	user, err := model.UserDB.GetUserByPhoneNumber(ctx, strings.TrimSpace(*phone))
+	if err != nil {
+		return err
+	}
+	if err := model.UserRoleDB.RevokeRole(ctx, user.ID, data.RoleAdmin); err != nil {
+		return err
+	}
+	// Access tokens still carrying the admin role stop working
+	if err := model.UserDB.BumpSessionVersion(ctx, user.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is no longer an administrator\n", user.PhoneNumber)
+	return nil
+}
@@ -32,7 +32,7 @@ func (app *application) CreateAdhkarCategoryHandler(w http.ResponseWriter, r *ht
 	}
 
 	// Insert the category
-	err := app.Model.AdhkarCategoryDB.InsertAdhkarCategory(category)
+	err := app.Model.AdhkarCategoryDB.InsertAdhkarCategory(r.Context(), category)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarCategoryAlreadyExists) {
 			app.errorResponse(w, r, http.StatusConflict, "تصنيف الأذكار موجود بالفعل")
@@ -41,6 +41,7 @@ func (app *application) CreateAdhkarCategoryHandler(w http.ResponseWriter, r *ht
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, data.AuditEntityAdhkarCategory, category.ID, nil, category)
 
 	// Send response
 	utils.SendJSONResponse(w, http.StatusCreated, utils.Envelope{
@@ -63,7 +64,7 @@ func (app *application) GetAdhkarCategoryHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	category, err := app.Model.AdhkarCategoryDB.GetAdhkarCategoryByID(id)
+	category, err := app.Model.AdhkarCategoryDB.GetAdhkarCategoryByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarCategoryNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "تصنيف الأذكار غير موجود")
@@ -114,8 +115,10 @@ func (app *application) UpdateAdhkarCategoryHandler(w http.ResponseWriter, r *ht
 		Description: description,
 	}
 
+	before, _ := app.Model.AdhkarCategoryDB.GetAdhkarCategoryByID(r.Context(), id)
+
 	// Update the category
-	err = app.Model.AdhkarCategoryDB.UpdateAdhkarCategory(category)
+	err = app.Model.AdhkarCategoryDB.UpdateAdhkarCategory(r.Context(), category)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarCategoryNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "تصنيف الأذكار غير موجود")
@@ -128,6 +131,7 @@ func (app *application) UpdateAdhkarCategoryHandler(w http.ResponseWriter, r *ht
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditUpdate, data.AuditEntityAdhkarCategory, id, before, category)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message":  "تم تحديث تصنيف الأذكار بنجاح",
@@ -149,7 +153,9 @@ func (app *application) DeleteAdhkarCategoryHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	err = app.Model.AdhkarCategoryDB.DeleteAdhkarCategory(id)
+	before, _ := app.Model.AdhkarCategoryDB.GetAdhkarCategoryByID(r.Context(), id)
+
+	err = app.Model.AdhkarCategoryDB.DeleteAdhkarCategory(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarCategoryNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "تصنيف الأذكار غير موجود")
@@ -162,6 +168,7 @@ func (app *application) DeleteAdhkarCategoryHandler(w http.ResponseWriter, r *ht
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditDelete, data.AuditEntityAdhkarCategory, id, before, nil)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message": "تم حذف تصنيف الأذكار بنجاح",
@@ -172,7 +179,7 @@ func (app *application) DeleteAdhkarCategoryHandler(w http.ResponseWriter, r *ht
 func (app *application) ListAdhkarCategoriesHandler(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
-	categories, meta, err := app.Model.AdhkarCategoryDB.ListAdhkarCategories(queryParams)
+	categories, meta, err := app.Model.AdhkarCategoryDB.ListAdhkarCategories(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
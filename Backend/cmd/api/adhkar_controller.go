@@ -54,7 +54,7 @@ func (app *application) CreateAdhkarHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Insert the dhikr
-	err = app.Model.AdhkarDB.InsertAdhkar(adhkar)
+	err = app.Model.AdhkarDB.InsertAdhkar(r.Context(), adhkar)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarAlreadyExists) {
 			app.errorResponse(w, r, http.StatusConflict, "الذكر موجود بالفعل")
@@ -66,6 +66,7 @@ func (app *application) CreateAdhkarHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, data.AuditEntityAdhkar, adhkar.ID, nil, adhkar)
 
 	// Send response
 	utils.SendJSONResponse(w, http.StatusCreated, utils.Envelope{
@@ -88,7 +89,7 @@ func (app *application) GetAdhkarHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	adhkar, err := app.Model.AdhkarDB.GetAdhkarByID(id)
+	adhkar, err := app.Model.AdhkarDB.GetAdhkarByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "الذكر غير موجود")
@@ -165,8 +166,10 @@ func (app *application) UpdateAdhkarHandler(w http.ResponseWriter, r *http.Reque
 		CategoryID: categoryID,
 	}
 
+	before, _ := app.Model.AdhkarDB.GetAdhkarByID(r.Context(), id)
+
 	// Update the dhikr
-	err = app.Model.AdhkarDB.UpdateAdhkar(adhkar)
+	err = app.Model.AdhkarDB.UpdateAdhkar(r.Context(), adhkar)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "الذكر غير موجود")
@@ -178,6 +181,7 @@ func (app *application) UpdateAdhkarHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditUpdate, data.AuditEntityAdhkar, id, before, adhkar)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message": "تم تحديث الذكر بنجاح",
@@ -199,7 +203,9 @@ func (app *application) DeleteAdhkarHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.Model.AdhkarDB.DeleteAdhkar(id)
+	before, _ := app.Model.AdhkarDB.GetAdhkarByID(r.Context(), id)
+
+	err = app.Model.AdhkarDB.DeleteAdhkar(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "الذكر غير موجود")
@@ -208,6 +214,7 @@ func (app *application) DeleteAdhkarHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditDelete, data.AuditEntityAdhkar, id, before, nil)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message": "تم حذف الذكر بنجاح",
@@ -218,7 +225,7 @@ func (app *application) DeleteAdhkarHandler(w http.ResponseWriter, r *http.Reque
 func (app *application) ListAdhkarHandler(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
-	adhkar, meta, err := app.Model.AdhkarDB.ListAdhkar(queryParams)
+	adhkar, meta, err := app.Model.AdhkarDB.ListAdhkar(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -245,7 +252,7 @@ func (app *application) GetAdhkarByCategoryIDHandler(w http.ResponseWriter, r *h
 	}
 
 	// Check if the category exists
-	_, err = app.Model.AdhkarCategoryDB.GetAdhkarCategoryByID(categoryID)
+	_, err = app.Model.AdhkarCategoryDB.GetAdhkarCategoryByID(r.Context(), categoryID)
 	if err != nil {
 		if errors.Is(err, data.ErrAdhkarCategoryNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "تصنيف الذكر غير موجود")
@@ -257,7 +264,7 @@ func (app *application) GetAdhkarByCategoryIDHandler(w http.ResponseWriter, r *h
 
 	queryParams := r.URL.Query()
 
-	adhkar, meta, err := app.Model.AdhkarDB.GetAdhkarByCategoryID(categoryID, queryParams)
+	adhkar, meta, err := app.Model.AdhkarDB.GetAdhkarByCategoryID(r.Context(), categoryID, queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
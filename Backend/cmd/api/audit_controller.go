@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/data"
+	"project/utils"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// auditEntityIDPattern limits entity_id filters to the characters entity
+// ids are made of: numbers, uuids, day/month/section keys and day ranges.
+var auditEntityIDPattern = regexp.MustCompile(`^[0-9A-Za-z:._-]{1,64}$`)
+
+// audit records an administrative change made by the authenticated user.
+// before and after are the record as it was and as it is now; either is nil
+// for a create or delete. Failures are logged and never fail the request:
+// the change itself has already been made.
+func (app *application) audit(r *http.Request, action, entityType string, entityID any, before, after any) {
+	entry, err := data.NewAuditLog(authenticatedUserID(r), action, entityType, fmt.Sprint(entityID), before, after)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+	ip := app.requestIP(r)
+	entry.IPAddress = &ip
+
+	if err := app.Model.AuditLogDB.Insert(r.Context(), entry); err != nil {
+		app.logError(r, err)
+	}
+}
+
+// ListAuditLogHandler handles GET requests to browse the audit log, newest
+// first. It filters by entity, entity_id, action, actor and a from/to range
+// (YYYY-MM-DD or RFC 3339) and pages like every other list.
+func (app *application) ListAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	var filters []string
+
+	if entity := queryParams.Get("entity"); entity != "" {
+		if !slices.Contains(data.AuditEntities, entity) {
+			app.badRequestResponse(w, r, errors.New("نوع الكيان غير صالح"))
+			return
+		}
+		filters = append(filters, fmt.Sprintf("audit_log.entity_type = '%s'", entity))
+	}
+
+	if entityID := queryParams.Get("entity_id"); entityID != "" {
+		if !auditEntityIDPattern.MatchString(entityID) {
+			app.badRequestResponse(w, r, errors.New("معرف الكيان غير صالح"))
+			return
+		}
+		filters = append(filters, fmt.Sprintf("audit_log.entity_id = '%s'", entityID))
+	}
+
+	if action := queryParams.Get("action"); action != "" {
+		if !slices.Contains(data.AuditActions, action) {
+			app.badRequestResponse(w, r, errors.New("نوع العملية غير صالح"))
+			return
+		}
+		filters = append(filters, fmt.Sprintf("audit_log.action = '%s'", action))
+	}
+
+	if actor := queryParams.Get("actor"); actor != "" {
+		actorID, err := uuid.Parse(actor)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("معرف المستخدم غير صالح"))
+			return
+		}
+		filters = append(filters, fmt.Sprintf("audit_log.actor_id = '%s'", actorID))
+	}
+
+	for _, bound := range []struct {
+		param, op string
+		endOfDay  bool
+	}{{"from", ">=", false}, {"to", "<", true}} {
+		value := queryParams.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := parseAuditTime(value, bound.endOfDay)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("قيمة %s غير صالحة، استخدم YYYY-MM-DD أو RFC3339", bound.param))
+			return
+		}
+		filters = append(filters, fmt.Sprintf("audit_log.created_at %s '%s'", bound.op, t.UTC().Format(time.RFC3339Nano)))
+	}
+
+	entries, meta, err := app.Model.AuditLogDB.ListAuditLog(r.Context(), queryParams, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"audit_log": entries,
+		"meta":      meta,
+	})
+}
+
+// parseAuditTime reads a YYYY-MM-DD date or an RFC 3339 time. A date used as
+// an upper bound covers the whole day, so to=2025-03-01 includes that day.
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
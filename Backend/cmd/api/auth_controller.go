@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/data"
+	"project/utils"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+// authenticate validates an access token and returns the user and roles it
+// was issued for. A token issued under an older session version (the user
+// logged out everywhere, changed their password or lost a role) is rejected
+// with utils.ErrRevokedToken.
+func (app *application) authenticate(ctx context.Context, tokenString string) (string, []string, error) {
+	token, err := utils.ValidateToken(tokenString)
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return "", nil, utils.ErrExpiredToken
+		}
+		return "", nil, utils.ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", nil, utils.ErrInvalidClaims
+	}
+
+	userID, ok := claims["id"].(string)
+	if !ok {
+		return "", nil, utils.ErrInvalidClaims
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return "", nil, utils.ErrInvalidClaims
+	}
+
+	sessionVersion, ok := claims["sv"].(float64)
+	if !ok {
+		return "", nil, utils.ErrInvalidClaims
+	}
+	current, err := app.Model.UserDB.GetSessionVersion(ctx, id)
+	if err != nil {
+		if errors.Is(err, data.ErrUserNotFound) {
+			return "", nil, utils.ErrRevokedToken
+		}
+		return "", nil, err
+	}
+	if int(sessionVersion) != current {
+		return "", nil, utils.ErrRevokedToken
+	}
+
+	var userRoles []string
+	switch roles := claims["user_role"].(type) {
+	case []interface{}:
+		userRoles = make([]string, 0, len(roles))
+		for _, role := range roles {
+			if roleStr, ok := role.(string); ok && roleStr != "NULL" && roleStr != "" {
+				userRoles = append(userRoles, roleStr)
+			}
+		}
+	case string:
+		// Handle case where user_role might be a single string
+		if roles != "" && roles != "NULL" {
+			userRoles = []string{roles}
+		}
+	}
+
+	return userID, userRoles, nil
+}
+
+// accessTokenFor issues an access token carrying the user's current roles
+// and session version.
+func (app *application) accessTokenFor(ctx context.Context, userID uuid.UUID) (string, error) {
+	roles, err := app.Model.UserRoleDB.GetRolesByUserID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	roleNames := make([]string, len(roles))
+	for i, role := range roles {
+		roleNames[i] = role.Name
+	}
+
+	sessionVersion, err := app.Model.UserDB.GetSessionVersion(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return utils.GenerateToken(userID.String(), roleNames, sessionVersion)
+}
+
+// startSession signs the user in on this device: it issues an access token
+// and the first refresh token of a new session, sets both cookies and
+// returns them for the response body.
+func (app *application) startSession(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (utils.Envelope, error) {
+	token, err := app.accessTokenFor(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := app.Model.RefreshTokenDB.Create(r.Context(), userID, utils.RefreshTokenTTL, r.UserAgent(), app.requestIP(r))
+	if err != nil {
+		return nil, err
+	}
+
+	utils.SetTokenCookie(w, token)
+	utils.SetRefreshTokenCookie(w, refreshToken)
+
+	return sessionEnvelope(token, refreshToken), nil
+}
+
+func sessionEnvelope(token, refreshToken string) utils.Envelope {
+	return utils.Envelope{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"expires":       fmt.Sprintf("%d دقيقة", int(utils.AccessTokenTTL.Minutes())),
+	}
+}
+
+// endAllSessions signs the user out everywhere: outstanding access tokens
+// stop being accepted and every refresh token is revoked.
+func (app *application) endAllSessions(ctx context.Context, userID uuid.UUID) error {
+	if err := app.Model.UserDB.BumpSessionVersion(ctx, userID); err != nil {
+		return err
+	}
+	return app.Model.RefreshTokenDB.RevokeAllForUser(ctx, userID)
+}
+
+// refreshTokenFromRequest reads the refresh token from the refresh_token form
+// field or, failing that, its cookie.
+func refreshTokenFromRequest(r *http.Request) string {
+	if token := r.FormValue("refresh_token"); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(utils.RefreshTokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// RefreshTokenHandler handles POST requests that exchange a refresh token for
+// a new access token and the next refresh token. Each refresh token works
+// once; presenting a used one ends the session it belongs to.
+func (app *application) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	refreshToken := refreshTokenFromRequest(r)
+	if refreshToken == "" {
+		app.errorResponse(w, r, http.StatusUnauthorized, "رمز التحديث مطلوب")
+		return
+	}
+
+	next, userID, err := app.Model.RefreshTokenDB.Rotate(r.Context(), refreshToken, utils.RefreshTokenTTL, r.UserAgent(), app.requestIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			app.securityLog.WarnContext(r.Context(), "Refresh token reuse detected; session revoked", "ip", app.requestIP(r))
+			utils.ClearTokenCookies(w)
+			app.errorResponse(w, r, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, data.ErrRefreshTokenInvalid):
+			utils.ClearTokenCookies(w)
+			app.errorResponse(w, r, http.StatusUnauthorized, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token, err := app.accessTokenFor(r.Context(), userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SetTokenCookie(w, token)
+	utils.SetRefreshTokenCookie(w, next)
+
+	utils.SendJSONResponse(w, http.StatusOK, sessionEnvelope(token, next))
+}
+
+// LogoutHandler handles POST requests that end the session of this device.
+// The access token already issued stays valid until it expires, at most
+// utils.AccessTokenTTL.
+func (app *application) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if refreshToken := refreshTokenFromRequest(r); refreshToken != "" {
+		err := app.Model.RefreshTokenDB.RevokeFamily(r.Context(), refreshToken)
+		if err != nil && !errors.Is(err, data.ErrRefreshTokenInvalid) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	utils.ClearTokenCookies(w)
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message": "تم تسجيل الخروج بنجاح",
+	})
+}
+
+// LogoutAllHandler handles POST requests that sign the current user out of
+// every device, revoking all of their access and refresh tokens.
+func (app *application) LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.Context().Value(UserIDKey).(string))
+	if err != nil {
+		app.unauthorizedResponse(w, r)
+		return
+	}
+
+	if err := app.endAllSessions(r.Context(), userID); err != nil {
+		app.handleRetrievalError(w, r, err)
+		return
+	}
+
+	utils.ClearTokenCookies(w)
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message": "تم تسجيل الخروج من جميع الأجهزة بنجاح",
+	})
+}
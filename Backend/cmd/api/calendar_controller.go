@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/data"
+	"project/internal/hijri"
+	"project/utils"
+	"strconv"
+	"time"
+)
+
+// hijriCalendar returns the configured Hijri conversion rule.
+func (app *application) hijriCalendar() hijri.Calendar {
+	cal, ok := hijri.CalendarByName(app.cfg.hijriCalendar)
+	if !ok {
+		return hijri.UmmAlQura
+	}
+	return cal
+}
+
+// hijriDate returns the Hijri date of the civil day t falls on, applying the
+// section's adjustment when a section is given.
+func (app *application) hijriDate(section *data.Section, t time.Time) hijri.Date {
+	adjustment := 0
+	if section != nil {
+		adjustment = section.HijriAdjustment
+	}
+	return hijri.FromGregorian(t, app.hijriCalendar(), adjustment)
+}
+
+// optionalSectionFromRequest resolves a section like sectionFromRequest when
+// the request names one or gives coordinates, and returns nil otherwise. ok
+// is false when an error response has been written.
+func (app *application) optionalSectionFromRequest(w http.ResponseWriter, r *http.Request) (section *data.Section, loc *time.Location, ok bool) {
+	query := r.URL.Query()
+	if query.Get("section") == "" && query.Get("lat") == "" && query.Get("lng") == "" {
+		loc, err := time.LoadLocation(data.DefaultSectionTimezone)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, nil, false
+		}
+		return nil, loc, true
+	}
+
+	section = app.sectionFromRequest(w, r)
+	if section == nil {
+		return nil, nil, false
+	}
+	loc, err := section.Location()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil, false
+	}
+	return section, loc, true
+}
+
+// HijriDateHandler handles GET requests that convert between Gregorian and
+// Hijri dates. ?date=YYYY-MM-DD converts a Gregorian date (today by default);
+// ?hijri=YYYY-MM-DD converts the other way. An optional section (or lat/lng)
+// applies that section's day adjustment and time zone.
+func (app *application) HijriDateHandler(w http.ResponseWriter, r *http.Request) {
+	section, loc, ok := app.optionalSectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	adjustment := 0
+	if section != nil {
+		adjustment = section.HijriAdjustment
+	}
+	cal := app.hijriCalendar()
+
+	var date time.Time
+	if value := r.URL.Query().Get("hijri"); value != "" {
+		d, err := hijri.ParseDate(value)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("التاريخ الهجري يجب أن يكون بصيغة YYYY-MM-DD بين سنتي %d و%d", hijri.MinYear, hijri.MaxYear))
+			return
+		}
+		date, err = hijri.ToGregorian(d, cal, adjustment, loc)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("التاريخ الهجري غير صالح"))
+			return
+		}
+	} else if value := r.URL.Query().Get("date"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("التاريخ يجب أن يكون بصيغة YYYY-MM-DD"))
+			return
+		}
+		date = parsed
+	} else {
+		date = time.Now().In(loc)
+	}
+
+	h := hijri.FromGregorian(date, cal, adjustment)
+	response := utils.Envelope{
+		"gregorian":  date.Format("2006-01-02"),
+		"hijri":      h.Info(),
+		"calendar":   cal,
+		"adjustment": adjustment,
+	}
+	if event, ok := hijri.EventOn(date, cal, adjustment); ok {
+		response["event"] = event
+	}
+	if section != nil {
+		response["section"] = section.Name
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, response)
+}
+
+// IslamicEventsHandler handles GET requests listing the Islamic events of a
+// year: ?year= is a Hijri year (the current one by default) and
+// ?gregorian_year= lists the events falling in a Gregorian year instead.
+func (app *application) IslamicEventsHandler(w http.ResponseWriter, r *http.Request) {
+	section, loc, ok := app.optionalSectionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	adjustment := 0
+	if section != nil {
+		adjustment = section.HijriAdjustment
+	}
+	cal := app.hijriCalendar()
+
+	var events []hijri.Occurrence
+	var err error
+	response := utils.Envelope{"calendar": cal}
+
+	if value := r.URL.Query().Get("gregorian_year"); value != "" {
+		year, convErr := strconv.Atoi(value)
+		if convErr != nil || year < 1900 || year > 2200 {
+			app.badRequestResponse(w, r, errors.New("السنة الميلادية غير صالحة"))
+			return
+		}
+		events, err = hijri.EventsInGregorianYear(year, cal, adjustment, loc)
+		response["gregorian_year"] = year
+	} else {
+		year := app.hijriDate(section, time.Now().In(loc)).Year
+		if value := r.URL.Query().Get("year"); value != "" {
+			year, err = strconv.Atoi(value)
+			if err != nil || year < hijri.MinYear || year > hijri.MaxYear {
+				app.badRequestResponse(w, r, errors.New("السنة الهجرية غير صالحة"))
+				return
+			}
+		}
+		events, err = hijri.EventsInYear(year, cal, adjustment, loc)
+		response["year"] = year
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response["events"] = events
+	if section != nil {
+		response["section"] = section.Name
+	}
+	utils.SendJSONResponse(w, http.StatusOK, response)
+}
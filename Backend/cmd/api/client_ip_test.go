@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	got, err := parseTrustedProxies(" 10.0.0.0/8, 192.0.2.7 ,,fdaa::/16, ::ffff:198.51.100.1, 172.16.5.9/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.7/32"),
+		netip.MustParsePrefix("fdaa::/16"),
+		netip.MustParsePrefix("198.51.100.1/32"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseTrustedProxies = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("proxy %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	if proxies, err := parseTrustedProxies(""); err != nil || len(proxies) != 0 {
+		t.Errorf("empty list: %v, %v", proxies, err)
+	}
+	for _, value := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0.1, nope"} {
+		if _, err := parseTrustedProxies(value); err == nil {
+			t.Errorf("parseTrustedProxies(%q) accepted an invalid entry", value)
+		}
+	}
+}
+
+func TestRequestIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, fdaa::/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{trustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		flyClient  string
+		forwarded  []string
+		want       string
+	}{
+		{"direct client", "198.51.100.1:5234", "", nil, "198.51.100.1"},
+		{"direct client without port", "198.51.100.1", "", nil, "198.51.100.1"},
+		{"IPv4-mapped peer", "[::ffff:198.51.100.1]:5234", "", nil, "198.51.100.1"},
+		{"IPv6 client", "[2001:db8::1]:443", "", nil, "2001:db8::1"},
+		{"unparseable peer", "@unix", "", nil, "@unix"},
+
+		// Headers from anyone but a trusted proxy are ignored
+		{"spoofed Fly-Client-IP", "198.51.100.1:5234", "203.0.113.9", nil, "198.51.100.1"},
+		{"spoofed X-Forwarded-For", "198.51.100.1:5234", "", []string{"203.0.113.9"}, "198.51.100.1"},
+
+		{"Fly-Client-IP from a proxy", "[fdaa::3]:80", "203.0.113.9", []string{"192.0.2.1"}, "203.0.113.9"},
+		{"unreadable Fly-Client-IP", "10.1.2.3:80", "garbage", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"nearest untrusted hop", "10.1.2.3:80", "", []string{"192.0.2.66, 203.0.113.9, 10.0.0.5"}, "203.0.113.9"},
+		{"hops across headers", "10.1.2.3:80", "", []string{"192.0.2.66", "203.0.113.9", "10.0.0.5"}, "203.0.113.9"},
+		{"client-written junk left of the hops", "10.1.2.3:80", "", []string{"nonsense, 203.0.113.9"}, "203.0.113.9"},
+		{"junk stops the walk", "10.1.2.3:80", "", []string{"203.0.113.9, nonsense, 10.0.0.5"}, "10.1.2.3"},
+		{"only proxies", "10.1.2.3:80", "", []string{"10.0.0.7, 10.0.0.5"}, "10.1.2.3"},
+		{"proxy without headers", "10.1.2.3:80", "", nil, "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.flyClient != "" {
+			r.Header.Set("Fly-Client-IP", tt.flyClient)
+		}
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := app.requestIP(r); got != tt.want {
+			t.Errorf("%s: requestIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
 	"project/internal/data"
 	"project/utils"
@@ -35,7 +34,7 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 }
 
 func (app *application) logError(r *http.Request, err error) {
-	log.Printf("Error: %v, Method: %s, URL: %s", err, r.Method, r.URL.String())
+	app.log.ErrorContext(r.Context(), "Request failed", "error", err, "method", r.Method, "path", r.URL.Path)
 }
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
@@ -68,7 +67,7 @@ func (app *application) ErrorHandlerMiddleware(next http.Handler) http.Handler {
 		defer func() {
 			if err := recover(); err != nil {
 				// Log the error
-				app.log.Println("Recovered from panic:", err)
+				app.log.ErrorContext(r.Context(), "Recovered from panic", "panic", err)
 
 				// Send the error response
 				w.Header().Set("Content-Type", "application/json")
@@ -85,10 +84,10 @@ func (app *application) ErrorHandlerMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
-// 	message := "rate limit exceeded"
-// 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
-// }
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
 
 func (app *application) jwtErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	var message string
@@ -101,8 +100,10 @@ func (app *application) jwtErrorResponse(w http.ResponseWriter, r *http.Request,
 		message = "missing authorization token"
 	case errors.Is(err, utils.ErrInvalidClaims):
 		message = "invalid token claims"
+	case errors.Is(err, utils.ErrRevokedToken):
+		message = "token has been revoked"
 	default:
-		app.errorResponse(w, r, http.StatusUnauthorized, "You don't have a premission")
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
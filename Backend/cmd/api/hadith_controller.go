@@ -37,7 +37,7 @@ func (app *application) CreateHadithHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Insert the hadith
-	err := app.Model.HadithDB.InsertHadith(hadith)
+	err := app.Model.HadithDB.InsertHadith(r.Context(), hadith)
 	if err != nil {
 		if errors.Is(err, data.ErrHadithAlreadyExists) {
 			app.errorResponse(w, r, http.StatusConflict, "الحديث موجود بالفعل")
@@ -46,6 +46,7 @@ func (app *application) CreateHadithHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, data.AuditEntityHadith, hadith.ID, nil, hadith)
 
 	// Send response
 	utils.SendJSONResponse(w, http.StatusCreated, utils.Envelope{
@@ -68,7 +69,7 @@ func (app *application) GetHadithHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	hadith, err := app.Model.HadithDB.GetHadithByID(id)
+	hadith, err := app.Model.HadithDB.GetHadithByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrHadithNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "الحديث غير موجود")
@@ -124,8 +125,10 @@ func (app *application) UpdateHadithHandler(w http.ResponseWriter, r *http.Reque
 		Topic:  topic,
 	}
 
+	before, _ := app.Model.HadithDB.GetHadithByID(r.Context(), id)
+
 	// Update the hadith
-	err = app.Model.HadithDB.UpdateHadith(hadith)
+	err = app.Model.HadithDB.UpdateHadith(r.Context(), hadith)
 	if err != nil {
 		if errors.Is(err, data.ErrHadithNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "الحديث غير موجود")
@@ -134,6 +137,7 @@ func (app *application) UpdateHadithHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditUpdate, data.AuditEntityHadith, id, before, hadith)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message": "تم تحديث الحديث بنجاح",
@@ -155,7 +159,9 @@ func (app *application) DeleteHadithHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.Model.HadithDB.DeleteHadith(id)
+	before, _ := app.Model.HadithDB.GetHadithByID(r.Context(), id)
+
+	err = app.Model.HadithDB.DeleteHadith(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrHadithNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "الحديث غير موجود")
@@ -164,6 +170,7 @@ func (app *application) DeleteHadithHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditDelete, data.AuditEntityHadith, id, before, nil)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message": "تم حذف الحديث بنجاح",
@@ -174,7 +181,7 @@ func (app *application) DeleteHadithHandler(w http.ResponseWriter, r *http.Reque
 func (app *application) ListHadithsHandler(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
-	hadiths, meta, err := app.Model.HadithDB.ListHadiths(queryParams)
+	hadiths, meta, err := app.Model.HadithDB.ListHadiths(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -196,7 +203,7 @@ func (app *application) GetHadithsByTopicHandler(w http.ResponseWriter, r *http.
 
 	queryParams := r.URL.Query()
 
-	hadiths, meta, err := app.Model.HadithDB.GetHadithsByTopic(topic, queryParams)
+	hadiths, meta, err := app.Model.HadithDB.GetHadithsByTopic(r.Context(), topic, queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
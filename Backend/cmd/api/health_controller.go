@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/leader"
+	"project/utils"
+	"runtime"
+	"time"
+)
+
+// expectedSchemaVersion is the latest migration this build relies on; raise
+// it with every new migration.
+const expectedSchemaVersion = 23
+
+// readinessTimeout bounds the database checks of a readiness probe.
+const readinessTimeout = 2 * time.Second
+
+// Set at build time with
+//
+//	-ldflags "-X main.buildCommit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	buildCommit = "unknown"
+	buildTime   = "unknown"
+)
+
+// HealthzHandler handles GET requests asking whether the process is alive.
+// It checks nothing else, so a slow database never gets the instance
+// restarted.
+func (app *application) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{"status": "ok"})
+}
+
+// ReadyzHandler handles GET requests asking whether the instance can serve
+// traffic: the database answers, its migrations are at least at
+// expectedSchemaVersion and the notifier is set up. It responds 503 when
+// any of them fails. The scheduler's state is reported but does not count,
+// as the scheduler may run on another instance and one is elected whenever
+// the database is reachable.
+func (app *application) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := utils.Envelope{}
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+			return
+		}
+		checks[name] = "ok"
+	}
+
+	check("database", app.Model.SchemaDB.Ping(ctx))
+	check("migrations", app.checkSchemaVersion(ctx))
+	if app.notifier == nil {
+		check("notifier", errors.New("not initialised"))
+	} else {
+		check("notifier", nil)
+	}
+
+	scheduler := utils.Envelope{"is_scheduler": app.scheduler.IsLeader()}
+	current, err := app.scheduler.Current(ctx)
+	switch {
+	case err == nil:
+		scheduler["scheduler"] = current
+	case !errors.Is(err, leader.ErrNoLeader):
+		scheduler["error"] = err.Error()
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	utils.SendJSONResponse(w, code, utils.Envelope{
+		"status":    status,
+		"instance":  app.scheduler.InstanceID(),
+		"checks":    checks,
+		"scheduler": scheduler,
+	})
+}
+
+// checkSchemaVersion fails when the database is behind this build or a
+// migration was left half applied.
+func (app *application) checkSchemaVersion(ctx context.Context) error {
+	version, dirty, err := app.Model.SchemaDB.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	if version < expectedSchemaVersion {
+		return fmt.Errorf("at version %d, expected %d", version, expectedSchemaVersion)
+	}
+	return nil
+}
+
+// VersionHandler handles GET requests for the build the instance runs.
+func (app *application) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"commit":     buildCommit,
+		"build_time": buildTime,
+		"go_version": runtime.Version(),
+	})
+}
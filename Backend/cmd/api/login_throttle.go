@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"project/internal/data"
+	"project/internal/logging"
+	"strconv"
+	"time"
+)
+
+var (
+	// loginAccountThrottle holds back guessing the password of one phone
+	// number: five tries, then locks from 30 seconds up to 15 minutes.
+	loginAccountThrottle = data.LoginThrottle{
+		FreeFailures: 5,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       24 * time.Hour,
+	}
+	// loginIPThrottle holds back one address trying many phone numbers. It
+	// is looser, as many users can share an address.
+	loginIPThrottle = data.LoginThrottle{
+		FreeFailures: 20,
+		BaseDelay:    30 * time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+// loginFailureRetention is how long failure counts are kept; the longest
+// throttle window.
+const loginFailureRetention = 24 * time.Hour
+
+// recordLoginFailure counts a failed sign-in against the phone number and
+// the client address, and writes every lock it causes to the security log.
+// Failures are logged and never fail the request.
+func (app *application) recordLoginFailure(r *http.Request, phoneNumber string) {
+	ip := app.requestIP(r)
+	for _, counter := range []struct {
+		key      string
+		subject  string
+		throttle data.LoginThrottle
+	}{
+		{data.LoginFailureKeyPhone(phoneNumber), "phone:" + logging.MaskPhone(phoneNumber), loginAccountThrottle},
+		{data.LoginFailureKeyIP(ip), "ip:" + ip, loginIPThrottle},
+	} {
+		failures, lockedUntil, err := app.Model.LoginFailureDB.RecordFailure(r.Context(), counter.key, counter.throttle)
+		if err != nil {
+			app.logError(r, err)
+			continue
+		}
+		if !lockedUntil.IsZero() {
+			app.securityLog.WarnContext(r.Context(), "Sign-in locked",
+				"subject", counter.subject, "failures", failures, "locked_until", lockedUntil.UTC(), "ip", ip)
+		}
+	}
+}
+
+// loginLockedResponse answers a sign-in while its phone number or address
+// is locked.
+func (app *application) loginLockedResponse(w http.ResponseWriter, r *http.Request, lockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	app.errorResponse(w, r, http.StatusTooManyRequests, data.ErrLoginLocked.Error())
+}
@@ -2,44 +2,93 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+	_ "time/tzdata" // section time zones must resolve on hosts without tzdata
 
 	"project/internal/data"
+	"project/internal/hijri"
+	"project/internal/leader"
+	"project/internal/logging"
+	"project/internal/notify"
+	"project/internal/sms"
+	"project/utils"
 
-	"firebase.google.com/go/v4/messaging"
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/robfig/cron/v3"
-	"google.golang.org/api/option"
 )
 
+// schedulerLockKey is the PostgreSQL advisory lock that elects the instance
+// running the prayer-time scheduler.
+const schedulerLockKey int64 = 0x5052415945520001
+
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port        int
+	metricsPort int
+	env         string
+	logLevel    string
+	instanceID  string
+	auth        struct {
+		accessTokenTTL  time.Duration
+		refreshTokenTTL time.Duration
+		keys            string
+		secret          string
+		issuer          string
+		audience        string
+	}
+	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
 	}
-	fcmCredentials string
+	notifier struct {
+		backend         string
+		fcmCredentials  string
+		vapidPublicKey  string
+		vapidPrivateKey string
+		vapidSubject    string
+	}
+	trustedProxies string
+	hijriCalendar  string
+	publicURL      string
+	ramadan        struct {
+		imsakOffset    int
+		suhoorReminder int
+	}
 }
 
 type application struct {
-	cfg     config
-	log     *log.Logger
-	Model   data.Model
-	infoLog *log.Logger
-	cron    *cron.Cron
-	fcm     *messaging.Client
+	cfg         config
+	log         *slog.Logger
+	securityLog *slog.Logger
+	Model       data.Model
+	cron        *cron.Cron
+	scheduler   *leader.Elector
+	notifier    notify.Notifier
+	sms         sms.Sender
+	metrics     *appMetrics
+
+	permissions    *permissionCache
+	trustedProxies []netip.Prefix
+
+	// otpSends bounds the codes sent after the request that asked for them
+	// has been answered; background tracks them so shutdown can wait.
+	otpSends   chan struct{}
+	background sync.WaitGroup
 }
 
 func main() {
@@ -50,35 +99,122 @@ func main() {
 
 	DATABASE_URL := os.Getenv("DATABASE_URL")
 	FCM_CREDENTIALS := os.Getenv("FCM_CREDENTIALS")
+	NOTIFIER := os.Getenv("NOTIFIER")
+	VAPID_PUBLIC_KEY := os.Getenv("VAPID_PUBLIC_KEY")
+	VAPID_PRIVATE_KEY := os.Getenv("VAPID_PRIVATE_KEY")
+	VAPID_SUBJECT := os.Getenv("VAPID_SUBJECT")
+	JWT_KEYS := os.Getenv("JWT_KEYS")
+	JWT_SECRET := os.Getenv("JWT_SECRET")
+	TRUSTED_PROXIES := os.Getenv("TRUSTED_PROXIES")
+	LOG_LEVEL := os.Getenv("LOG_LEVEL")
+	PUBLIC_URL := os.Getenv("PUBLIC_URL")
+	if PUBLIC_URL == "" {
+		PUBLIC_URL = data.Domain
+	}
+	if LOG_LEVEL == "" {
+		LOG_LEVEL = "info"
+	}
+
+	// fly.io names each machine; elsewhere the host name is unique enough.
+	INSTANCE_ID := os.Getenv("FLY_MACHINE_ID")
+	if INSTANCE_ID == "" {
+		INSTANCE_ID, _ = os.Hostname()
+	}
 
 	var cfg config
 	flag.IntVar(&cfg.port, "Port", 8080, "Port of the server")
+	flag.IntVar(&cfg.metricsPort, "metrics-port", 9091, "Port of the private metrics listener (0 disables it)")
 	flag.StringVar(&cfg.env, "Environment", "Development", "Development environment of the server")
+	flag.StringVar(&cfg.logLevel, "log-level", LOG_LEVEL, "Least level logged: debug, info, warn or error")
+	flag.StringVar(&cfg.instanceID, "instance-id", INSTANCE_ID, "Name of this instance in scheduler leader election")
+	flag.DurationVar(&cfg.auth.accessTokenTTL, "access-token-ttl", 15*time.Minute, "Lifetime of access tokens")
+	flag.DurationVar(&cfg.auth.refreshTokenTTL, "refresh-token-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+	flag.StringVar(&cfg.auth.keys, "jwt-keys", JWT_KEYS, "JWT signing key set as JSON, inline or a file path")
+	flag.StringVar(&cfg.auth.secret, "jwt-secret", JWT_SECRET, "Single HS256 signing secret, used when no key set is given")
+	flag.StringVar(&cfg.auth.issuer, "jwt-issuer", "islambackend", "iss claim of issued tokens")
+	flag.StringVar(&cfg.auth.audience, "jwt-audience", "islambackend-api", "aud claim of issued tokens")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", DATABASE_URL, "PostgreSQL DSN")
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
-	flag.StringVar(&cfg.fcmCredentials, "fcm-credentials", FCM_CREDENTIALS, "Firebase credentials JSON path")
+	flag.StringVar(&cfg.notifier.backend, "notifier", NOTIFIER, "Notification backend: fcm, webpush or log (default fcm when credentials are set, otherwise log)")
+	flag.StringVar(&cfg.notifier.fcmCredentials, "fcm-credentials", FCM_CREDENTIALS, "Firebase credentials JSON path")
+	flag.StringVar(&cfg.notifier.vapidPublicKey, "vapid-public-key", VAPID_PUBLIC_KEY, "Web Push VAPID public key (base64url)")
+	flag.StringVar(&cfg.notifier.vapidPrivateKey, "vapid-private-key", VAPID_PRIVATE_KEY, "Web Push VAPID private key (base64url)")
+	flag.StringVar(&cfg.notifier.vapidSubject, "vapid-subject", VAPID_SUBJECT, "Web Push VAPID contact, a mailto: or https: URL")
+	flag.StringVar(&cfg.trustedProxies, "trusted-proxies", TRUSTED_PROXIES, "Comma separated addresses or CIDR ranges of proxies whose Fly-Client-IP and X-Forwarded-For headers are believed")
+	flag.StringVar(&cfg.hijriCalendar, "hijri-calendar", string(hijri.UmmAlQura), "Hijri calendar: ummalqura or tabular")
+	flag.StringVar(&cfg.publicURL, "public-url", PUBLIC_URL, "Base URL clients reach the service at, used in links and notifications")
+	flag.IntVar(&cfg.ramadan.imsakOffset, "ramadan-imsak-offset", 10, "Minutes between Imsak and Fajr during Ramadan")
+	flag.IntVar(&cfg.ramadan.suhoorReminder, "ramadan-suhoor-reminder", 30, "Minutes before Imsak to send the suhoor reminder (0 disables it)")
 	flag.Parse()
+	cfg.publicURL = strings.TrimSuffix(cfg.publicURL, "/")
+	data.Domain = cfg.publicURL
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	level, err := logging.ParseLevel(cfg.logLevel)
+	if err != nil {
+		log.Fatalf("Invalid log-level %q (expected debug, info, warn or error)", cfg.logLevel)
+	}
+	logger := logging.New(os.Stdout, level)
+	// Libraries that use the standard log package write through it too
+	slog.SetDefault(logger)
+	securityLog := logger.With("log", "security")
+
+	if _, ok := hijri.CalendarByName(cfg.hijriCalendar); !ok {
+		fatal("Unknown Hijri calendar", "calendar", cfg.hijriCalendar, "expected", strings.Join(hijri.CalendarNames(), ", "))
+	}
+
+	if cfg.ramadan.imsakOffset < 0 || cfg.ramadan.imsakOffset > 60 {
+		fatal("ramadan-imsak-offset must be between 0 and 60 minutes")
+	}
+	if cfg.ramadan.suhoorReminder < 0 || cfg.ramadan.suhoorReminder > 180 {
+		fatal("ramadan-suhoor-reminder must be between 0 and 180 minutes")
+	}
+
+	trustedProxies, err := parseTrustedProxies(cfg.trustedProxies)
+	if err != nil {
+		fatal("Invalid trusted-proxies", "error", err)
+	}
+
+	if cfg.auth.accessTokenTTL < time.Minute || cfg.auth.refreshTokenTTL < cfg.auth.accessTokenTTL {
+		fatal("access-token-ttl must be at least a minute and refresh-token-ttl at least as long")
+	}
+	utils.AccessTokenTTL = cfg.auth.accessTokenTTL
+	utils.RefreshTokenTTL = cfg.auth.refreshTokenTTL
+	if err := configureTokenKeys(&cfg, logger); err != nil {
+		fatal("Failed to configure token signing", "error", err)
+	}
 
 	db, err := openDB(&cfg)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Failed to connect to the database", "error", err)
 	}
 	defer db.Close()
+	utils.SetDB(db)
 
-	// Initialize Firebase
-	ctx := context.Background()
-	fbApp, err := firebase.NewApp(ctx, nil, option.WithCredentialsFile(cfg.fcmCredentials))
+	// Initialize the notification backend
+	ctx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	notifier, err := notify.New(ctx, notify.Config{
+		Backend:            cfg.notifier.backend,
+		FCMCredentialsFile: cfg.notifier.fcmCredentials,
+		VAPIDPublicKey:     cfg.notifier.vapidPublicKey,
+		VAPIDPrivateKey:    cfg.notifier.vapidPrivateKey,
+		VAPIDSubject:       cfg.notifier.vapidSubject,
+	}, logger.With("component", "notify"))
 	if err != nil {
-		logger.Fatalf("Failed to initialize Firebase: %v", err)
+		fatal("Failed to initialize notifications", "error", err)
 	}
-	fcmClient, err := fbApp.Messaging(ctx)
-	if err != nil {
-		logger.Fatalf("Failed to initialize FCM: %v", err)
+	logger.Info("Sending notifications", "backend", notifier.Name())
+
+	// No SMS provider is integrated yet. In development codes are written to
+	// the log; elsewhere nothing can deliver them, so the endpoints that
+	// send codes are switched off.
+	var smsSender sms.Sender
+	if cfg.env == "Development" {
+		smsSender = sms.NewConsole(logger.With("component", "sms"), true)
+	} else {
+		logger.Warn("No SMS provider configured; phone verification and password reset are disabled")
 	}
 
 	// Initialize cron
@@ -86,22 +222,61 @@ func main() {
 
 	model := data.NewModels(db)
 	app := application{
-		cfg:     cfg,
-		log:     logger,
-		Model:   model,
-		infoLog: infoLog,
-		cron:    cronScheduler,
-		fcm:     fcmClient,
+		cfg:         cfg,
+		log:         logger,
+		Model:       model,
+		securityLog: securityLog,
+		cron:        cronScheduler,
+		notifier:    notifier,
+		sms:         smsSender,
+		metrics:     newAppMetrics(db.DB),
+
+		permissions:    newPermissionCache(),
+		trustedProxies: trustedProxies,
+		otpSends:       make(chan struct{}, otpBackgroundSends),
 	}
 
 	// Schedule prayer time checks
-	_, err = cronScheduler.AddFunc("* * * * *", func() { // Every minute
-		app.checkPrayerTimes(ctx)
-	})
+	_, err = cronScheduler.AddFunc("* * * * *", app.metrics.timed("check_prayer_times", app.checkPrayerTimes)) // Every minute
+	if err != nil {
+		fatal("Failed to schedule cron job", "error", err)
+	}
+	_, err = cronScheduler.AddFunc("30 3 * * *", app.metrics.timed("cleanup", func() { // Daily
+		ctx := context.Background()
+		if n, err := app.Model.RefreshTokenDB.DeleteExpired(ctx); err != nil {
+			logger.Error("Failed to delete expired refresh tokens", "error", err)
+		} else if n > 0 {
+			logger.Info("Deleted expired refresh tokens", "count", n)
+		}
+		if n, err := app.Model.OTPDB.DeleteExpired(ctx); err != nil {
+			logger.Error("Failed to delete expired verification codes", "error", err)
+		} else if n > 0 {
+			logger.Info("Deleted expired verification codes", "count", n)
+		}
+		if n, err := app.Model.LoginFailureDB.DeleteExpired(ctx, loginFailureRetention); err != nil {
+			logger.Error("Failed to delete old sign-in failures", "error", err)
+		} else if n > 0 {
+			logger.Info("Deleted old sign-in failure counts", "count", n)
+		}
+	}))
 	if err != nil {
-		logger.Fatalf("Failed to schedule cron job: %v", err)
+		fatal("Failed to schedule cron job", "error", err)
 	}
-	cronScheduler.Start()
+
+	// Only the elected instance runs the scheduler; the others take over
+	// if it goes away.
+	app.scheduler = leader.New(db.DB, leader.Config{
+		LockKey:    schedulerLockKey,
+		InstanceID: cfg.instanceID,
+		Interval:   10 * time.Second,
+		OnElected:  cronScheduler.Start,
+		OnDemoted:  func() { <-cronScheduler.Stop().Done() },
+		Logger:     logger.With("component", "leader"),
+	})
+	go app.scheduler.Run(ctx)
+
+	// Deliver what the scheduler enqueues
+	go app.runNotificationOutbox(ctx)
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.port),
@@ -110,6 +285,25 @@ func main() {
 		ReadTimeout:  2 * time.Minute,
 		WriteTimeout: 5 * time.Minute,
 	}
+	// Metrics are served apart from the API, on a port the public service
+	// does not forward, so only the platform's scraper reaches them.
+	var metricsSrv *http.Server
+	if cfg.metricsPort != 0 {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", app.metrics.registry.Handler())
+		metricsSrv = &http.Server{
+			Addr:         fmt.Sprintf(":%d", cfg.metricsPort),
+			Handler:      mux,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Error("Metrics server error", "error", err)
+			}
+		}()
+	}
+
 	shutdownCh := make(chan os.Signal, 1)
 	signal.Notify(shutdownCh, os.Interrupt, syscall.SIGTERM)
 
@@ -117,33 +311,78 @@ func main() {
 
 	go func() {
 		sig := <-shutdownCh
-		log.Printf("Received signal: %v. Initiating graceful shutdown.", sig)
+		logger.Info("Received signal; initiating graceful shutdown", "signal", sig.String())
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
 		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("Error during shutdown: %v", err)
+			logger.Error("Error during shutdown", "error", err)
 		} else {
-			log.Println("Server shutdown completed.")
+			logger.Info("Server shutdown completed")
 		}
+		if metricsSrv != nil {
+			metricsSrv.Shutdown(ctx)
+		}
+		stopWorkers()
 		app.cleanup()
 
 		done <- true
 	}()
 
-	log.Printf("Starting %s server on %s", cfg.env, srv.Addr)
+	logger.Info("Starting server", "env", cfg.env, "addr", srv.Addr)
 	err = srv.ListenAndServe()
 	if err != http.ErrServerClosed {
-		logger.Fatalf("Server error: %v", err)
+		fatal("Server error", "error", err)
 	}
 	<-done
-	log.Println("Application stopped.")
+	logger.Info("Application stopped")
+}
+
+// configureTokenKeys installs the JWT signing keys: the key set if one is
+// configured, otherwise the single secret. A development server without
+// either signs with a random key, so its tokens do not survive a restart.
+func configureTokenKeys(cfg *config, logger *slog.Logger) error {
+	var keys []*utils.SigningKey
+	var active string
+
+	switch {
+	case cfg.auth.keys != "":
+		var err error
+		keys, active, err = utils.LoadSigningKeys(cfg.auth.keys)
+		if err != nil {
+			return err
+		}
+	case cfg.auth.secret != "":
+		key, err := utils.NewHMACKey("default", []byte(cfg.auth.secret))
+		if err != nil {
+			return err
+		}
+		keys, active = []*utils.SigningKey{key}, key.ID
+	case cfg.env == "Development":
+		key, err := utils.NewRandomHMACKey("development")
+		if err != nil {
+			return err
+		}
+		logger.Warn("No JWT_KEYS or JWT_SECRET configured; signing tokens with a random development key")
+		keys, active = []*utils.SigningKey{key}, key.ID
+	default:
+		return errors.New("set JWT_KEYS or JWT_SECRET")
+	}
+
+	return utils.ConfigureTokens(cfg.auth.issuer, cfg.auth.audience, keys, active)
 }
 
 func openDB(cfg *config) (*sqlx.DB, error) {
+	// Sessions run in UTC; prayer times are interpreted in each section's
+	// own zone by the application. Migration 000011 converted the columns
+	// written in Africa/Tripoli time to TIMESTAMPTZ.
 	connStr := cfg.db.dsn
-	connStr += "&TimeZone=Africa/Tripoli"
+	if strings.Contains(connStr, "?") {
+		connStr += "&TimeZone=UTC"
+	} else {
+		connStr += "?TimeZone=UTC"
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -167,5 +406,12 @@ func openDB(cfg *config) (*sqlx.DB, error) {
 
 func (app *application) cleanup() {
 	app.cron.Stop()
-	log.Println("Performing cleanup tasks...")
+	app.log.Info("Performing cleanup tasks")
+	app.background.Wait()
+}
+
+// fatal logs msg and its attributes as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"project/internal/metrics"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// appMetrics are what the private metrics listener reports about the server.
+type appMetrics struct {
+	registry *metrics.Registry
+
+	requests            *metrics.CounterVec
+	requestDuration     *metrics.HistogramVec
+	rateLimitRejections *metrics.CounterVec
+	cronDuration        *metrics.HistogramVec
+	notifications       *metrics.CounterVec
+	cacheRequests       *metrics.CounterVec
+}
+
+// Outcomes of a notification delivery attempt, as counted in
+// notifications_total.
+const (
+	notificationSent      = "sent"
+	notificationRetry     = "retry"
+	notificationFailed    = "failed"
+	notificationExpired   = "expired"
+	notificationCancelled = "cancelled"
+)
+
+// newAppMetrics registers the server's metrics, reading connection pool
+// statistics from db when scraped.
+func newAppMetrics(db *sql.DB) *appMetrics {
+	reg := metrics.NewRegistry()
+	m := &appMetrics{
+		registry: reg,
+		requests: reg.NewCounterVec("http_requests_total",
+			"HTTP requests answered, by route and status.", "method", "route", "status"),
+		requestDuration: reg.NewHistogramVec("http_request_duration_seconds",
+			"Time taken to answer HTTP requests, by route.", metrics.DefaultBuckets, "method", "route"),
+		rateLimitRejections: reg.NewCounterVec("rate_limit_rejections_total",
+			"Requests rejected by the rate limiter, by policy.", "policy"),
+		cronDuration: reg.NewHistogramVec("cron_job_duration_seconds",
+			"Time taken by scheduled jobs.", []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 15, 30, 60}, "job"),
+		notifications: reg.NewCounterVec("notifications_total",
+			"Notification delivery attempts, by prayer, section and outcome.", "prayer", "section", "result"),
+		cacheRequests: reg.NewCounterVec("cache_requests_total",
+			"Cache lookups, by cache and whether they hit.", "cache", "result"),
+	}
+
+	gauges := []struct {
+		name, help string
+		value      func(sql.DBStats) float64
+	}{
+		{"db_max_open_connections", "Most connections the pool may open.", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }},
+		{"db_open_connections", "Connections open, in use or idle.", func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"db_in_use_connections", "Connections in use.", func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"db_idle_connections", "Idle connections.", func(s sql.DBStats) float64 { return float64(s.Idle) }},
+	}
+	for _, g := range gauges {
+		reg.NewGaugeFunc(g.name, g.help, func() float64 { return g.value(db.Stats()) })
+	}
+
+	counters := []struct {
+		name, help string
+		value      func(sql.DBStats) float64
+	}{
+		{"db_wait_count_total", "Times a query waited for a free connection.", func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"db_wait_duration_seconds_total", "Time spent waiting for a free connection.", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+		{"db_max_idle_closed_total", "Connections closed for exceeding the idle limit.", func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }},
+		{"db_max_idle_time_closed_total", "Connections closed for being idle too long.", func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }},
+		{"db_max_lifetime_closed_total", "Connections closed for reaching their lifetime.", func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }},
+	}
+	for _, c := range counters {
+		reg.NewCounterFunc(c.name, c.help, func() float64 { return c.value(db.Stats()) })
+	}
+
+	return m
+}
+
+// instrument counts and times every request by the route that served it.
+// The route is the pattern the router matched, so path values such as ids
+// do not each get a series of their own.
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		// The router sets the pattern on the request it was handed
+		route := "unmatched"
+		if r.Pattern != "" {
+			_, path, found := strings.Cut(r.Pattern, " ")
+			if !found {
+				path = r.Pattern
+			}
+			route = path
+		}
+
+		app.metrics.requests.Inc(r.Method, route, strconv.Itoa(rw.statusCode()))
+		app.metrics.requestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// timed returns job wrapped to record how long each run takes.
+func (m *appMetrics) timed(name string, job func()) func() {
+	return func() {
+		start := time.Now()
+		defer func() {
+			m.cronDuration.Observe(time.Since(start).Seconds(), name)
+		}()
+		job()
+	}
+}
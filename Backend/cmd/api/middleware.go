@@ -1,15 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"project/internal/logging"
 	"project/utils"
+	"regexp"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 )
 
@@ -18,93 +21,45 @@ type contextKey string
 const UserIDKey contextKey = "userID"
 const UserRoleKey contextKey = "userRole"
 
+// authenticatedUserID returns the user AuthMiddleware or PassTokenMiddleware
+// identified, or nil when the request is anonymous.
+func authenticatedUserID(r *http.Request) *uuid.UUID {
+	idStr, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		return nil
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
 func (app *application) AuthMiddleware(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tokenString string
 		if r.Header.Get("Upgrade") == "websocket" {
-			tokenString := r.URL.Query().Get("token")
-			if tokenString == "" {
-				app.jwtErrorResponse(w, r, utils.ErrMissingToken)
-				return
-			}
-			token, err := utils.ValidateToken(tokenString)
-			if err != nil {
-				app.jwtErrorResponse(w, r, utils.ErrInvalidToken)
-				return
-			}
-
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok || !token.Valid {
-				app.jwtErrorResponse(w, r, utils.ErrInvalidClaims)
-				return
-			}
-
-			userID, okID := claims["id"].(string)
-			if !okID {
-				app.jwtErrorResponse(w, r, utils.ErrInvalidClaims)
-				return
-			}
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
-			r = r.WithContext(ctx)
-		} else {
-			var tokenString string
-			cookie, err := r.Cookie("accessToken")
-			if err != nil {
-				authHeader := r.Header.Get("Authorization")
-				if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
-					tokenString = strings.TrimPrefix(authHeader, "Bearer ")
-				} else {
-					app.jwtErrorResponse(w, r, utils.ErrMissingToken)
-					return
-				}
-			} else {
-				tokenString = cookie.Value
-			}
-
-			token, err := utils.ValidateToken(tokenString)
-			if err != nil {
-				app.jwtErrorResponse(w, r, utils.ErrInvalidToken)
-				return
-			}
-
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok || !token.Valid {
-				app.jwtErrorResponse(w, r, utils.ErrInvalidClaims)
-				return
-			}
-
-			if exp, ok := claims["exp"].(float64); ok {
-				expTime := time.Unix(int64(exp), 0)
-				if expTime.Before(time.Now()) {
-					app.jwtErrorResponse(w, r, utils.ErrExpiredToken)
-					return
-				}
-			} else {
-				app.jwtErrorResponse(w, r, utils.ErrInvalidClaims)
-				return
-			}
-
-			userID, okID := claims["id"].(string)
-			if !okID {
-				app.jwtErrorResponse(w, r, utils.ErrInvalidClaims)
-				return
-			}
-
-			var userRoles []string
-			userRolesInterface, okRoles := claims["user_role"].([]interface{})
+			tokenString = r.URL.Query().Get("token")
+		} else if cookie, err := r.Cookie("accessToken"); err == nil {
+			tokenString = cookie.Value
+		} else if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+		}
+		if tokenString == "" {
+			app.jwtErrorResponse(w, r, utils.ErrMissingToken)
+			return
+		}
 
-			if okRoles && len(userRolesInterface) > 0 {
-				userRoles = make([]string, 0, len(userRolesInterface))
-				for _, role := range userRolesInterface {
-					if roleStr, ok := role.(string); ok && roleStr != "NULL" && roleStr != "" {
-						userRoles = append(userRoles, roleStr)
-					}
-				}
-			}
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
-			ctx = context.WithValue(ctx, UserRoleKey, userRoles)
-			r = r.WithContext(ctx)
+		userID, userRoles, err := app.authenticate(r.Context(), tokenString)
+		if err != nil {
+			app.jwtErrorResponse(w, r, err)
+			return
 		}
 
+		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		ctx = context.WithValue(ctx, UserRoleKey, userRoles)
+		r = r.WithContext(ctx)
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -131,85 +86,117 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) logRequest(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method,
-			r.URL.RequestURI())
-		next.ServeHTTP(w, r)
-	})
-}
-func (app *application) recoverPanic(next http.Handler) http.Handler {
+// requestIDPattern is what an X-Request-ID sent by the client must look
+// like to be kept.
+var requestIDPattern = regexp.MustCompile(`^[0-9A-Za-z._-]{1,64}$`)
+
+// requestID tags the request with an id: the X-Request-ID the client sent,
+// when it is sensible, or a new one. The id is returned in X-Request-ID and
+// added to every record logged with the request's context.
+func requestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer func() {
-			if err := recover(); err != nil {
-				w.Header().Set("Connection", "close")
-				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
-			}
-		}()
-		next.ServeHTTP(w, r)
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
 	})
 }
-func (app *application) AdminOnlyMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userRoles, ok := r.Context().Value(UserRoleKey).([]string)
-		if !ok {
-			app.unauthorizedResponse(w, r)
-			return
-		}
 
-		isAdmin := false
-		for _, role := range userRoles {
-			if role == "admin" {
-				isAdmin = true
-				break
-			}
-			if role == "user" {
-			}
-		}
-		fmt.Print("False")
+// responseRecorder remembers the status and size of the response written
+// through it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
 
-		if !isAdmin {
-			app.forbiddenResponse(w, r)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+func (rw *responseRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
 }
 
-func (app *application) AdminOrSelfMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userRoles, ok := r.Context().Value(UserRoleKey).([]string)
-		if !ok {
-			app.unauthorizedResponse(w, r)
-			return
-		}
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
 
-		currentUserID := uuid.MustParse(r.Context().Value(UserIDKey).(string))
+// Flush keeps streamed responses streaming.
+func (rw *responseRecorder) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
 
-		vars := r.PathValue("id")
-		requestedUserID, err := uuid.Parse(vars)
-		if err != nil {
-			app.badRequestResponse(w, r, err)
-			return
-		}
+// Hijack keeps websocket upgrades working.
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err == nil && rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
 
-		isAdmin := false
-		for _, role := range userRoles {
-			if role == "admin" {
-				isAdmin = true
-				break
-			}
-		}
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
 
-		if !isAdmin && currentUserID != requestedUserID {
-			app.forbiddenResponse(w, r)
-			return
-		}
+// statusCode returns the status sent; a handler that wrote nothing sent 200.
+func (rw *responseRecorder) statusCode() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
 
+// logRequest logs every request once it is answered, with its status,
+// latency and response size. Sensitive query parameters are redacted.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		status := rw.statusCode()
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		app.log.LogAttrs(r.Context(), level, "Request",
+			slog.String("ip", app.requestIP(r)),
+			slog.String("proto", r.Proto),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("query", logging.RedactQuery(r.URL.Query())),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int64("size", rw.size),
+		)
+	})
+}
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				w.Header().Set("Connection", "close")
+				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
+			}
+		}()
 		next.ServeHTTP(w, r)
 	})
 }
-
 func (app *application) PassTokenMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Try to get token from multiple sources
@@ -235,48 +222,14 @@ func (app *application) PassTokenMiddleware(next http.HandlerFunc) http.HandlerF
 			return
 		}
 
-		// Validate the token
-		token, err := utils.ValidateToken(tokenString)
+		// Validate the token; an invalid or revoked one is ignored
+		userID, userRoles, err := app.authenticate(r.Context(), tokenString)
 		if err != nil {
-			// Log the token validation error (optional)
-			app.infoLog.Printf("Token validation error: %v", err)
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
+			app.log.DebugContext(r.Context(), "Ignoring invalid token", "error", err)
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Safely extract user ID
-		userID, ok := claims["id"].(string)
-		if !ok {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		// Extract user roles with robust type checking
-		var userRoles []string
-		if rolesInterface, ok := claims["user_role"].([]interface{}); ok {
-			userRoles = make([]string, 0, len(rolesInterface))
-			for _, role := range rolesInterface {
-				if roleStr, ok := role.(string); ok {
-					// Additional filtering for valid roles
-					if roleStr != "" && roleStr != "NULL" {
-						userRoles = append(userRoles, roleStr)
-					}
-				}
-			}
-		} else if roleSingleInterface, ok := claims["user_role"].(string); ok {
-			// Handle case where user_role might be a single string
-			if roleSingleInterface != "" && roleSingleInterface != "NULL" {
-				userRoles = []string{roleSingleInterface}
-			}
-		}
-
 		// Create a new context with user ID and roles
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
 		ctx = context.WithValue(ctx, UserRoleKey, userRoles)
@@ -288,70 +241,3 @@ func (app *application) PassTokenMiddleware(next http.HandlerFunc) http.HandlerF
 		next.ServeHTTP(w, r)
 	}
 }
-
-type RateLimiterConfig struct {
-	Skipper             func(r *http.Request) bool
-	Rate                int
-	Burst               int
-	ExpiresIn           time.Duration
-	IdentifierExtractor func(r *http.Request) (string, error)
-	ErrorHandler        func(w http.ResponseWriter, r *http.Request, err error)
-	DenyHandler         func(w http.ResponseWriter, r *http.Request, identifier string, err error)
-}
-
-type RateLimiter struct {
-	config   RateLimiterConfig
-	visitors map[string]*Visitor
-	mu       sync.Mutex
-}
-
-type Visitor struct {
-	lastRequest time.Time
-	requests    int
-}
-
-func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
-	return &RateLimiter{
-		config:   config,
-		visitors: make(map[string]*Visitor),
-	}
-}
-
-func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if rl.config.Skipper != nil && rl.config.Skipper(r) {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		identifier, err := rl.config.IdentifierExtractor(r)
-		if err != nil {
-			rl.config.ErrorHandler(w, r, err)
-			return
-		}
-
-		rl.mu.Lock()
-		visitor, exists := rl.visitors[identifier]
-		if !exists {
-			visitor = &Visitor{
-				lastRequest: time.Now(),
-				requests:    0,
-			}
-			rl.visitors[identifier] = visitor
-		}
-		rl.mu.Unlock()
-
-		now := time.Now()
-		if now.Sub(visitor.lastRequest) > rl.config.ExpiresIn {
-			visitor.requests = 0
-		}
-
-		if visitor.requests < rl.config.Burst {
-			visitor.requests++
-			visitor.lastRequest = now
-			next.ServeHTTP(w, r)
-		} else {
-			rl.config.DenyHandler(w, r, identifier, nil)
-		}
-	})
-}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/data"
+	"project/internal/notify"
+	"project/utils"
+	"project/utils/validator"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// notificationWorkers bounds how many notifications are sent at once.
+	notificationWorkers = 10
+	// outboxPollInterval is how often the worker looks for due entries.
+	outboxPollInterval = 5 * time.Second
+	// outboxBatchSize is how many entries the worker claims at a time.
+	outboxBatchSize = 200
+	// outboxMaxAttempts is how many times delivery is tried before failing.
+	outboxMaxAttempts = 3
+	// outboxStaleAfter is how long an entry may stay in sending before
+	// another worker assumes its worker died and claims it again.
+	outboxStaleAfter = 2 * time.Minute
+	// notificationExpiry is how late an alert may still be delivered; an
+	// athan alert after the prayer has moved on is worse than none. It is
+	// also how far back the scheduler looks, so a restart loses nothing
+	// younger than this.
+	notificationExpiry = 15 * time.Minute
+	// notificationLookahead is how far ahead the scheduler enqueues, so the
+	// worker can deliver on time between cron ticks.
+	notificationLookahead = time.Minute
+)
+
+// outboxRetryDelay returns how long to wait before the next attempt after
+// the given number of failed attempts.
+func outboxRetryDelay(attempts int) time.Duration {
+	return time.Duration(attempts*attempts) * 15 * time.Second
+}
+
+// runNotificationOutbox delivers due outbox entries until ctx is cancelled.
+// Entries are claimed with SKIP LOCKED, so any number of instances may run
+// it side by side without sending an entry twice.
+func (app *application) runNotificationOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		app.deliverDueNotifications(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDueNotifications claims and delivers batches of due entries until
+// none are left.
+func (app *application) deliverDueNotifications(ctx context.Context) {
+	for ctx.Err() == nil {
+		entries, err := app.Model.NotificationOutboxDB.ClaimDue(ctx, outboxBatchSize, outboxStaleAfter)
+		if err != nil {
+			app.log.ErrorContext(ctx, "Failed to claim notifications", "error", err)
+			return
+		}
+		if len(entries) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		workers := make(chan struct{}, notificationWorkers)
+		for i := range entries {
+			wg.Add(1)
+			workers <- struct{}{}
+			go func(entry *data.NotificationOutbox) {
+				defer func() {
+					<-workers
+					wg.Done()
+				}()
+				app.deliverNotification(ctx, entry)
+			}(&entries[i])
+		}
+		wg.Wait()
+
+		if len(entries) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// deliverNotification makes one delivery attempt for a claimed entry and
+// records the outcome. A token the push service no longer recognises is not
+// retried; its subscription is removed instead.
+func (app *application) deliverNotification(ctx context.Context, entry *data.NotificationOutbox) {
+	label := fmt.Sprintf("%s on %s for subscription %s", entry.Prayer, entry.PrayerDate.Format("2006-01-02"), subscriptionLabel(entry.SubscriptionID))
+	outbox := &app.Model.NotificationOutboxDB
+
+	// The outcome is recorded even when shutdown cancels ctx mid-attempt, so a
+	// message that went out is not sent again.
+	record := context.WithoutCancel(ctx)
+
+	var err error
+	var result string
+	switch {
+	case entry.DeviceToken == "":
+		result = notificationCancelled
+		err = outbox.MarkFinished(record, entry.ID, data.OutboxCancelled, "subscription was removed")
+	case time.Since(entry.DeliverAt) > notificationExpiry:
+		result = notificationExpired
+		err = outbox.MarkFinished(record, entry.ID, data.OutboxExpired, "delivery window passed")
+	default:
+		message := notify.Message{Title: entry.Title, Body: entry.Body}
+		if err := json.Unmarshal(entry.Data, &message.Data); err != nil {
+			app.log.WarnContext(ctx, "Ignoring unreadable notification data", "notification", entry.ID, "error", err)
+		}
+
+		sendErr := app.notifier.Send(ctx, entry.DeviceToken, message)
+		switch {
+		case sendErr == nil:
+			app.log.InfoContext(ctx, "Sent notification", "notification", label)
+			result = notificationSent
+			err = outbox.MarkSent(record, entry.ID)
+		case errors.Is(sendErr, notify.ErrInvalidToken):
+			app.log.InfoContext(ctx, "Removing subscription with an invalid token", "notification", label)
+			result = notificationFailed
+			err = outbox.MarkFinished(record, entry.ID, data.OutboxFailed, sendErr.Error())
+			if err == nil {
+				err = app.Model.NotificationSubscriptionDB.DeleteSubscriptionByToken(record, entry.DeviceToken)
+				if errors.Is(err, data.ErrNotificationSubscriptionNotFound) {
+					err = nil
+				}
+			}
+		case entry.Attempts >= outboxMaxAttempts:
+			app.log.ErrorContext(ctx, "Giving up on notification", "notification", label, "attempts", entry.Attempts, "error", sendErr)
+			result = notificationFailed
+			err = outbox.MarkFinished(record, entry.ID, data.OutboxFailed, sendErr.Error())
+		default:
+			app.log.WarnContext(ctx, "Retrying notification", "notification", label, "attempt", entry.Attempts, "max_attempts", outboxMaxAttempts, "error", sendErr)
+			result = notificationRetry
+			err = outbox.MarkRetry(record, entry.ID, sendErr.Error(), time.Now().Add(outboxRetryDelay(entry.Attempts)))
+		}
+	}
+	app.metrics.notifications.Inc(entry.Prayer, strconv.Itoa(entry.SectionID), result)
+	if err != nil {
+		app.log.ErrorContext(ctx, "Failed to record notification delivery", "notification", entry.ID, "error", err)
+	}
+}
+
+func subscriptionLabel(id *int) string {
+	if id == nil {
+		return "(removed)"
+	}
+	return strconv.Itoa(*id)
+}
+
+// ListNotificationOutboxHandler handles GET requests for the notification
+// delivery history. Filters: date (YYYY-MM-DD, the prayer's day), section (id
+// or name), prayer and status; plus the usual page, per_page, q and sort.
+// The response also counts the matching entries per status.
+func (app *application) ListNotificationOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filters []string
+
+	if value := query.Get("date"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("صيغة التاريخ يجب أن تكون YYYY-MM-DD"))
+			return
+		}
+		filters = append(filters, fmt.Sprintf("notification_outbox.prayer_date = '%s'", date.Format("2006-01-02")))
+	}
+
+	if value := query.Get("section"); value != "" {
+		sectionID, err := app.sectionIDFromValue(r.Context(), value)
+		if err != nil {
+			if errors.Is(err, data.ErrSectionNotFound) {
+				app.errorResponse(w, r, http.StatusNotFound, err.Error())
+				return
+			}
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		filters = append(filters, fmt.Sprintf("notification_outbox.section_id = %d", sectionID))
+	}
+
+	if value := query.Get("prayer"); value != "" {
+		if !validator.In(value, data.NotificationAlerts...) {
+			app.badRequestResponse(w, r, fmt.Errorf("الصلاة %q غير معروفة", value))
+			return
+		}
+		filters = append(filters, fmt.Sprintf("notification_outbox.prayer = '%s'", value))
+	}
+
+	if value := query.Get("status"); value != "" {
+		if !validator.In(value, data.OutboxStatuses...) {
+			app.badRequestResponse(w, r, fmt.Errorf("الحالة %q غير معروفة", value))
+			return
+		}
+		filters = append(filters, fmt.Sprintf("notification_outbox.status = '%s'", value))
+	}
+
+	entries, meta, err := app.Model.NotificationOutboxDB.ListOutbox(r.Context(), query, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	counts, err := app.Model.NotificationOutboxDB.CountOutboxByStatus(r.Context(), filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"notifications": entries,
+		"summary":       counts,
+		"meta":          meta,
+	})
+}
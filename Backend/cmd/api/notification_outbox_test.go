@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"project/internal/data"
+	"project/internal/data/datatest"
+	"project/internal/notify"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// outboxStore keeps the notification_subscriptions and notification_outbox
+// rows of a scripted database.
+type outboxStore struct {
+	subscriptions map[int64]*subscriptionRow
+	entries       []*outboxRow
+}
+
+type subscriptionRow struct {
+	token, prayers, language string
+	sectionID                int64
+}
+
+type outboxRow struct {
+	id, subscriptionID, sectionID int64
+	prayer, title, body           string
+	prayerDate                    time.Time
+	data                          []byte
+	deliverAt, nextAttemptAt      time.Time
+	status                        string
+	attempts                      int64
+	lastError, sentAt             driver.Value
+}
+
+var assignment = regexp.MustCompile(`(\w+) = \$(\d+)`)
+
+func newOutboxStore(db *datatest.DB) *outboxStore {
+	store := &outboxStore{subscriptions: make(map[int64]*subscriptionRow)}
+
+	db.Handle("FROM notification_subscriptions WHERE section_id", func(_ string, args []driver.Value) (*datatest.Result, error) {
+		result := &datatest.Result{Columns: []string{"id", "user_id", "device_token", "section_id", "prayers",
+			"reminder_offset_minutes", "quiet_hours_start", "quiet_hours_end", "language", "created_at", "updated_at"}}
+		for id, s := range store.subscriptions {
+			if s.sectionID == args[0] {
+				result.Rows = append(result.Rows, []driver.Value{id, nil, s.token, s.sectionID,
+					[]byte("{" + s.prayers + "}"), int64(0), nil, nil, s.language, time.Now(), time.Now()})
+			}
+		}
+		return result, nil
+	})
+	db.Handle("DELETE FROM notification_subscriptions", func(_ string, args []driver.Value) (*datatest.Result, error) {
+		for id, s := range store.subscriptions {
+			if s.token == args[0] {
+				delete(store.subscriptions, id)
+				return &datatest.Result{RowsAffected: 1}, nil
+			}
+		}
+		return nil, nil
+	})
+
+	db.Handle("INSERT INTO notification_outbox", func(_ string, args []driver.Value) (*datatest.Result, error) {
+		result := &datatest.Result{}
+	rows:
+		for i := 0; i+9 <= len(args); i += 9 {
+			date, err := time.Parse("2006-01-02", args[i+3].(string))
+			if err != nil {
+				return nil, err
+			}
+			row := &outboxRow{
+				id:             int64(len(store.entries) + 1),
+				subscriptionID: args[i].(int64),
+				sectionID:      args[i+1].(int64),
+				prayer:         args[i+2].(string),
+				prayerDate:     date,
+				title:          args[i+4].(string),
+				body:           args[i+5].(string),
+				data:           []byte(args[i+6].(string)),
+				deliverAt:      args[i+7].(time.Time),
+				nextAttemptAt:  args[i+8].(time.Time),
+				status:         data.OutboxPending,
+			}
+			// ON CONFLICT (subscription_id, section_id, prayer, prayer_date) DO NOTHING
+			for _, e := range store.entries {
+				if e.subscriptionID == row.subscriptionID && e.sectionID == row.sectionID &&
+					e.prayer == row.prayer && e.prayerDate.Equal(row.prayerDate) {
+					continue rows
+				}
+			}
+			store.entries = append(store.entries, row)
+			result.RowsAffected++
+		}
+		return result, nil
+	})
+	db.Handle("FOR UPDATE SKIP LOCKED", func(_ string, args []driver.Value) (*datatest.Result, error) {
+		result := &datatest.Result{Columns: []string{"id", "subscription_id", "section_id", "prayer", "prayer_date",
+			"title", "body", "data", "deliver_at", "status", "attempts", "next_attempt_at", "last_error", "sent_at",
+			"created_at", "updated_at", "device_token"}}
+		for _, e := range store.entries {
+			if e.status != data.OutboxPending || e.nextAttemptAt.After(time.Now()) || int64(len(result.Rows)) == args[1] {
+				continue
+			}
+			e.status = data.OutboxSending
+			e.attempts++
+			token := ""
+			if s, ok := store.subscriptions[e.subscriptionID]; ok {
+				token = s.token
+			}
+			result.Rows = append(result.Rows, []driver.Value{e.id, e.subscriptionID, e.sectionID, e.prayer, e.prayerDate,
+				e.title, e.body, e.data, e.deliverAt, e.status, e.attempts, e.nextAttemptAt, e.lastError, e.sentAt,
+				time.Now(), time.Now(), token})
+		}
+		return result, nil
+	})
+	db.Handle("UPDATE notification_outbox SET", func(query string, args []driver.Value) (*datatest.Result, error) {
+		set := make(map[string]driver.Value)
+		for _, m := range assignment.FindAllStringSubmatch(query, -1) {
+			n, _ := strconv.Atoi(m[2])
+			set[m[1]] = args[n-1]
+		}
+		for _, e := range store.entries {
+			if e.id != set["id"] {
+				continue
+			}
+			e.status = set["status"].(string)
+			e.lastError = set["last_error"]
+			if at, ok := set["next_attempt_at"].(time.Time); ok {
+				e.nextAttemptAt = at
+			}
+			if strings.Contains(query, "sent_at = CURRENT_TIMESTAMP") {
+				e.sentAt = time.Now()
+			}
+			return &datatest.Result{RowsAffected: 1}, nil
+		}
+		return nil, nil
+	})
+
+	return store
+}
+
+func TestNotificationOutboxDelivery(t *testing.T) {
+	db, conn := datatest.New()
+	defer conn.Close()
+	store := newOutboxStore(db)
+	store.subscriptions[1] = &subscriptionRow{token: "device-a", prayers: "maghrib", language: "en", sectionID: 1}
+	store.subscriptions[2] = &subscriptionRow{token: "device-b", prayers: "maghrib,isha", language: "ar", sectionID: 1}
+	store.subscriptions[3] = &subscriptionRow{token: "device-c", prayers: "isha", language: "ar", sectionID: 1}
+	store.subscriptions[4] = &subscriptionRow{token: "device-d", prayers: "maghrib", language: "ar", sectionID: 2}
+
+	recorder := notify.NewRecorder()
+	recorder.Reject("device-b")
+	app := &application{
+		cfg:      config{publicURL: "https://prayers.example"},
+		log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Model:    data.NewModels(conn),
+		notifier: recorder,
+		metrics:  newAppMetrics(conn.DB),
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	pt := data.PrayerTimes{
+		SectionID:   1,
+		Name:        "Tripoli",
+		MaghribTime: now.Add(-time.Minute),
+		IshaTime:    now.Add(90 * time.Minute),
+	}
+
+	// Overlapping ticks enqueue each alert once; Isha is not due yet
+	app.enqueueDueNotifications(ctx, pt, now, false)
+	app.enqueueDueNotifications(ctx, pt, now.Add(30*time.Second), false)
+	if len(store.entries) != 2 {
+		t.Fatalf("enqueued %d entries, want Maghrib for devices a and b", len(store.entries))
+	}
+
+	app.deliverDueNotifications(ctx)
+
+	sent := recorder.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1: %v", len(sent), sent)
+	}
+	msg := sent[0]
+	if msg.Token != "device-a" || !strings.Contains(msg.Message.Title, "Maghrib") || !strings.Contains(msg.Message.Body, "Tripoli") {
+		t.Errorf("sent %q to %s, want the Maghrib alert for Tripoli to device-a", msg.Message.Title, msg.Token)
+	}
+	if got := msg.Message.Data["click_action"]; got != "https://prayers.example" {
+		t.Errorf("click_action = %q, want the public URL", got)
+	}
+	if got := msg.Message.Data["prayer"]; got != data.AlertMaghrib {
+		t.Errorf("prayer = %q, want maghrib", got)
+	}
+
+	for _, e := range store.entries {
+		want := data.OutboxSent
+		if e.subscriptionID == 2 {
+			want = data.OutboxFailed
+		}
+		if e.status != want || e.attempts != 1 {
+			t.Errorf("entry of subscription %d: %s after %d attempts, want %s after 1", e.subscriptionID, e.status, e.attempts, want)
+		}
+		if (e.sentAt != nil) != (want == data.OutboxSent) {
+			t.Errorf("entry of subscription %d: sent_at = %v", e.subscriptionID, e.sentAt)
+		}
+	}
+
+	// The device the push service rejected is unsubscribed
+	if _, ok := store.subscriptions[2]; ok {
+		t.Error("subscription with a rejected token was kept")
+	}
+	if len(store.subscriptions) != 3 {
+		t.Errorf("%d subscriptions left, want 3", len(store.subscriptions))
+	}
+
+	// Nothing is delivered twice
+	app.deliverDueNotifications(ctx)
+	if n := len(recorder.Sent()); n != 1 {
+		t.Errorf("second run sent %d messages in all, want 1", n)
+	}
+}
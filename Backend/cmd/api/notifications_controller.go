@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/data"
+	"project/internal/notify"
+	"project/utils"
+	"project/utils/validator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prayerAlert is a notification due at a moment of the day. key is the
+// preference a subscription opts into; text selects the wording, which only
+// differs from key for Maghrib announced as Iftar. related carries the time
+// the wording refers to (Imsak for the suhoor reminder, Fajr for Imsak).
+type prayerAlert struct {
+	key     string
+	text    string
+	time    time.Time
+	related time.Time
+}
+
+// alertIftar is the wording used for Maghrib during Ramadan.
+const alertIftar = "iftar"
+
+// alertNames holds the display name of each prayer per language.
+var alertNames = map[string]map[string]string{
+	"ar": {
+		data.AlertFajrFirst:  "الفجر الأول",
+		data.AlertFajrSecond: "الفجر الثاني",
+		data.AlertDhuhr:      "الظهر",
+		data.AlertAsr:        "العصر",
+		data.AlertMaghrib:    "المغرب",
+		data.AlertIsha:       "العشاء",
+	},
+	"en": {
+		data.AlertFajrFirst:  "First Fajr",
+		data.AlertFajrSecond: "Fajr",
+		data.AlertDhuhr:      "Dhuhr",
+		data.AlertAsr:        "Asr",
+		data.AlertMaghrib:    "Maghrib",
+		data.AlertIsha:       "Isha",
+	},
+}
+
+// alertMessage returns the title and body of an alert for a subscriber.
+// offset is how many minutes before the alert's time it is being sent.
+func alertMessage(alert prayerAlert, section, language string, offset int) (title, body string) {
+	at := alert.time.Format("15:04")
+	related := alert.related.Format("15:04")
+	en := language == "en"
+
+	switch alert.text {
+	case data.AlertSuhoor:
+		minutes := int(alert.related.Sub(alert.time).Minutes())
+		if en {
+			return "Suhoor reminder in " + section,
+				fmt.Sprintf("%d minutes left until Imsak in %s (Imsak at %s)", minutes, section, related)
+		}
+		return fmt.Sprintf("تذكير بالسحور في %s", section),
+			fmt.Sprintf("بقي %d دقيقة على الإمساك في %s، الإمساك الساعة %s", minutes, section, related)
+	case data.AlertImsak:
+		if en {
+			return "Imsak in " + section, fmt.Sprintf("Imsak is at %s and Fajr at %s", at, related)
+		}
+		return fmt.Sprintf("حان وقت الإمساك في %s", section),
+			fmt.Sprintf("الإمساك الساعة %s وأذان الفجر الساعة %s", at, related)
+	case alertIftar:
+		if offset > 0 {
+			if en {
+				return "Iftar in " + section, fmt.Sprintf("Iftar in %s is in %d minutes, at %s", section, offset, at)
+			}
+			return fmt.Sprintf("اقترب موعد الإفطار في %s", section),
+				fmt.Sprintf("بقي %d دقيقة على الإفطار في %s، المغرب الساعة %s", offset, section, at)
+		}
+		if en {
+			return "Iftar time in " + section, fmt.Sprintf("It is time for Maghrib and Iftar in %s at %s", section, at)
+		}
+		return fmt.Sprintf("حان وقت الإفطار في %s", section),
+			fmt.Sprintf("حان وقت أذان المغرب والإفطار في %s الساعة %s، تقبل الله صيامكم", section, at)
+	}
+
+	if en {
+		name := alertNames["en"][alert.text]
+		if offset > 0 {
+			return fmt.Sprintf("%s in %d minutes", name, offset),
+				fmt.Sprintf("%s prayer in %s is at %s", name, section, at)
+		}
+		return fmt.Sprintf("%s prayer time in %s", name, section),
+			fmt.Sprintf("It is time for %s prayer in %s at %s", name, section, at)
+	}
+	name := alertNames["ar"][alert.text]
+	if offset > 0 {
+		return fmt.Sprintf("تذكير: صلاة %s بعد %d دقيقة", name, offset),
+			fmt.Sprintf("صلاة %s في %s الساعة %s", name, section, at)
+	}
+	return fmt.Sprintf("وقت صلاة %s في %s", name, section),
+		fmt.Sprintf("حان وقت صلاة %s في %s الساعة %s", name, section, at)
+}
+
+// enqueueDueNotifications adds to the outbox every alert of the section that
+// falls due for a subscriber between notificationExpiry ago and
+// notificationLookahead from currentTime, honouring their chosen prayers,
+// reminder offset, quiet hours and language. The outbox drops alerts that
+// were already enqueued, so overlapping or missed ticks neither duplicate nor
+// lose alerts. During Ramadan the suhoor reminder and Imsak are added and
+// Maghrib is announced as Iftar.
+func (app *application) enqueueDueNotifications(ctx context.Context, pt data.PrayerTimes, currentTime time.Time, ramadan bool) {
+	alerts := []prayerAlert{
+		{key: data.AlertFajrFirst, time: pt.FajrFirstTime},
+		{key: data.AlertFajrSecond, time: pt.FajrSecondTime},
+		{key: data.AlertDhuhr, time: pt.DhuhrTime},
+		{key: data.AlertAsr, time: pt.AsrTime},
+		{key: data.AlertMaghrib, time: pt.MaghribTime},
+		{key: data.AlertIsha, time: pt.IshaTime},
+	}
+	for i := range alerts {
+		alerts[i].text = alerts[i].key
+	}
+	if ramadan {
+		alerts = app.withRamadanAlerts(pt, alerts)
+	}
+
+	subscriptions, err := app.Model.NotificationSubscriptionDB.ListSubscriptionsBySection(ctx, pt.SectionID)
+	if err != nil {
+		app.log.Error("Failed to fetch subscriptions", "section", pt.Name, "error", err)
+		return
+	}
+
+	from := currentTime.Add(-notificationExpiry)
+	until := currentTime.Add(notificationLookahead)
+
+	var entries []data.NotificationOutbox
+	for i := range subscriptions {
+		subscription := &subscriptions[i]
+		for _, alert := range alerts {
+			if !subscription.Wants(alert.key) {
+				continue
+			}
+
+			// Suhoor and Imsak are reminders in their own right; the
+			// subscriber's offset applies to the prayers.
+			offset := subscription.ReminderOffsetMinutes
+			if alert.key == data.AlertSuhoor || alert.key == data.AlertImsak {
+				offset = 0
+			}
+			sendAt := alert.time.Add(-time.Duration(offset) * time.Minute)
+			if sendAt.Before(from) || sendAt.After(until) || subscription.InQuietHours(sendAt) {
+				continue
+			}
+
+			title, body := alertMessage(alert, pt.Name, subscription.Language, offset)
+			payload, err := json.Marshal(map[string]string{
+				"prayer":       alert.text,
+				"section":      pt.Name,
+				"click_action": app.cfg.publicURL,
+			})
+			if err != nil {
+				app.log.Error("Failed to encode notification data", "error", err)
+				continue
+			}
+
+			subscriptionID := subscription.ID
+			entries = append(entries, data.NotificationOutbox{
+				SubscriptionID: &subscriptionID,
+				SectionID:      pt.SectionID,
+				Prayer:         alert.key,
+				PrayerDate:     alert.time,
+				Title:          title,
+				Body:           body,
+				Data:           payload,
+				DeliverAt:      sendAt,
+			})
+		}
+	}
+
+	inserted, err := app.Model.NotificationOutboxDB.Enqueue(ctx, entries)
+	if err != nil {
+		app.log.Error("Failed to enqueue notifications", "section", pt.Name, "error", err)
+		return
+	}
+	if inserted > 0 {
+		app.log.Info("Enqueued notifications", "section", pt.Name, "count", inserted)
+	}
+}
+
+// SubscribeToNotificationsHandler handles POST requests that register a
+// device for prayer notifications or change its preferences. Fields that are
+// not submitted keep their current values (or the defaults for a new device).
+// When the caller is signed in the subscription is linked to their account.
+//
+// Form fields: token, section_id (or section), prayers (comma separated),
+// reminder_offset_minutes, quiet_hours_start, quiet_hours_end, language.
+func (app *application) SubscribeToNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	if token == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "رمز الجهاز مطلوب")
+		return
+	}
+
+	subscription, err := app.Model.NotificationSubscriptionDB.GetSubscriptionByToken(r.Context(), token)
+	if err != nil {
+		if !errors.Is(err, data.ErrNotificationSubscriptionNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		subscription = &data.NotificationSubscription{
+			DeviceToken: token,
+			Prayers:     data.NotificationAlerts,
+			Language:    "ar",
+		}
+	}
+
+	if userID, ok := r.Context().Value(UserIDKey).(string); ok && userID != "" {
+		subscription.UserID = &userID
+	}
+
+	if err := app.readSubscriptionForm(r, subscription); err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateNotificationSubscription(v, subscription)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.Model.NotificationSubscriptionDB.UpsertSubscription(r.Context(), subscription)
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message":      "تم حفظ إعدادات الإشعارات بنجاح",
+		"subscription": subscription,
+	})
+}
+
+// readSubscriptionForm copies the submitted preferences onto subscription,
+// leaving fields that were not submitted untouched. quiet_hours=off clears
+// the quiet hours.
+func (app *application) readSubscriptionForm(r *http.Request, subscription *data.NotificationSubscription) error {
+	if value := r.FormValue("section_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return errors.New("معرف القسم يجب أن يكون رقمًا صحيحًا موجبًا")
+		}
+		subscription.SectionID = id
+	} else if name := r.FormValue("section"); name != "" {
+		section, err := app.Model.SectionsDB.GetSectionByName(r.Context(), name)
+		if err != nil {
+			return err
+		}
+		subscription.SectionID = section.ID
+	}
+
+	if value := r.FormValue("prayers"); value != "" {
+		var prayers []string
+		for _, p := range strings.Split(value, ",") {
+			if p = strings.TrimSpace(strings.ToLower(p)); p != "" {
+				prayers = append(prayers, p)
+			}
+		}
+		subscription.Prayers = prayers
+	}
+
+	if value := r.FormValue("reminder_offset_minutes"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("مدة التذكير يجب أن تكون رقمًا صحيحًا")
+		}
+		subscription.ReminderOffsetMinutes = offset
+	}
+
+	if r.FormValue("quiet_hours") == "off" {
+		subscription.QuietHoursStart, subscription.QuietHoursEnd = nil, nil
+	}
+	if value := r.FormValue("quiet_hours_start"); value != "" {
+		subscription.QuietHoursStart = &value
+	}
+	if value := r.FormValue("quiet_hours_end"); value != "" {
+		subscription.QuietHoursEnd = &value
+	}
+
+	if value := r.FormValue("language"); value != "" {
+		subscription.Language = strings.ToLower(value)
+	}
+
+	return nil
+}
+
+// GetNotificationSubscriptionHandler handles GET requests for the preferences
+// of a device, identified by ?token=.
+func (app *application) GetNotificationSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "رمز الجهاز مطلوب")
+		return
+	}
+
+	subscription, err := app.Model.NotificationSubscriptionDB.GetSubscriptionByToken(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, data.ErrNotificationSubscriptionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"subscription": subscription,
+	})
+}
+
+// UnsubscribeFromNotificationsHandler handles DELETE requests that stop all
+// notifications to a device.
+func (app *application) UnsubscribeFromNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	if token == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "رمز الجهاز مطلوب")
+		return
+	}
+
+	err := app.Model.NotificationSubscriptionDB.DeleteSubscriptionByToken(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, data.ErrNotificationSubscriptionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message": "تم إلغاء الاشتراك في الإشعارات بنجاح",
+	})
+}
+
+// ListMySubscriptionsHandler handles GET requests for the subscriptions of
+// the signed-in user's devices.
+func (app *application) ListMySubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok || userID == "" {
+		app.unauthorizedResponse(w, r)
+		return
+	}
+
+	subscriptions, err := app.Model.NotificationSubscriptionDB.ListSubscriptionsByUser(r.Context(), userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"subscriptions": subscriptions,
+	})
+}
+
+// NotificationConfigHandler handles GET requests for what a client needs to
+// subscribe: the delivery backend and, for Web Push, the VAPID public key.
+func (app *application) NotificationConfigHandler(w http.ResponseWriter, r *http.Request) {
+	response := utils.Envelope{
+		"backend": app.notifier.Name(),
+	}
+	if wp, ok := app.notifier.(*notify.WebPush); ok {
+		response["vapid_public_key"] = wp.PublicKey()
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"project/internal/data"
+	"project/utils"
+	"project/utils/validator"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// otpTTL is how long a code sent by SMS stays valid.
+	otpTTL = 10 * time.Minute
+	// otpResendCooldown is the least time between two codes to one number.
+	otpResendCooldown = time.Minute
+	// otpMaxAttempts is how many wrong guesses a code survives.
+	otpMaxAttempts = 5
+	// otpBackgroundSends bounds the password reset codes being sent at once;
+	// requests past it are answered as usual but send nothing.
+	otpBackgroundSends = 8
+	// otpSendTimeout bounds one background send.
+	otpSendTimeout = 30 * time.Second
+)
+
+// forgotPasswordMessage is the answer to every well-formed forgot-password
+// request, so it does not tell which numbers are registered.
+const forgotPasswordMessage = "إذا كان رقم الهاتف مسجلاً لدينا فستصلك رسالة تحتوي على رمز إعادة تعيين كلمة المرور"
+
+// sendOTP generates a code for purpose, stores it and sends it to the phone
+// number by SMS. It returns when the next code may be requested, and
+// data.ErrOTPCooldown when it is too soon to send another.
+func (app *application) sendOTP(ctx context.Context, phoneNumber, purpose string) (time.Time, error) {
+	code, err := utils.GenerateRandomCode()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في توليد رمز التحقق: %v", err)
+	}
+
+	resendAt, err := app.Model.OTPDB.Create(ctx, phoneNumber, purpose, code, otpTTL, otpResendCooldown)
+	if err != nil {
+		return resendAt, err
+	}
+
+	minutes := int(otpTTL.Minutes())
+	var body string
+	switch purpose {
+	case data.OTPPurposeResetPassword:
+		body = fmt.Sprintf("رمز إعادة تعيين كلمة المرور هو %s، صالح لمدة %d دقائق. إذا لم تطلبه فتجاهل هذه الرسالة.", code, minutes)
+	default:
+		body = fmt.Sprintf("رمز تأكيد رقم الهاتف هو %s، صالح لمدة %d دقائق.", code, minutes)
+	}
+
+	if err := app.sms.Send(ctx, phoneNumber, body); err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في إرسال الرسالة النصية: %v", err)
+	}
+
+	return resendAt, nil
+}
+
+// smsUnavailableResponse answers a request for a code while no SMS provider
+// is configured.
+func (app *application) smsUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusServiceUnavailable, "خدمة الرسائل النصية غير متاحة حالياً")
+}
+
+// otpErrorResponse answers a failed code check or a code requested too soon.
+func (app *application) otpErrorResponse(w http.ResponseWriter, r *http.Request, err error, resendAt time.Time) {
+	switch {
+	case errors.Is(err, data.ErrOTPCooldown):
+		retryAfter := int(math.Ceil(time.Until(resendAt).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		app.errorResponse(w, r, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, data.ErrOTPTooManyAttempts):
+		app.errorResponse(w, r, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, data.ErrOTPInvalid), errors.Is(err, data.ErrOTPExpired):
+		app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// SendPhoneVerificationHandler handles POST requests that send a code to the
+// current user's phone number to prove they own it. It responds 503 while no
+// SMS provider is configured.
+func (app *application) SendPhoneVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if app.sms == nil {
+		app.smsUnavailableResponse(w, r)
+		return
+	}
+
+	userID, err := uuid.Parse(r.Context().Value(UserIDKey).(string))
+	if err != nil {
+		app.unauthorizedResponse(w, r)
+		return
+	}
+
+	user, err := app.Model.UserDB.GetUser(r.Context(), userID)
+	if err != nil {
+		app.handleRetrievalError(w, r, err)
+		return
+	}
+	if user.PhoneVerifiedAt != nil {
+		app.errorResponse(w, r, http.StatusConflict, "رقم الهاتف مؤكد مسبقاً")
+		return
+	}
+
+	resendAt, err := app.sendOTP(r.Context(), user.PhoneNumber, data.OTPPurposeVerifyPhone)
+	if err != nil {
+		app.otpErrorResponse(w, r, err, resendAt)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message":      "تم إرسال رمز التحقق إلى رقم هاتفك",
+		"expires_in":   int(otpTTL.Seconds()),
+		"resend_after": resendAt,
+	})
+}
+
+// VerifyPhoneHandler handles POST requests that confirm the current user's
+// phone number with the code sent to it.
+func (app *application) VerifyPhoneHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.Context().Value(UserIDKey).(string))
+	if err != nil {
+		app.unauthorizedResponse(w, r)
+		return
+	}
+
+	code := strings.TrimSpace(r.FormValue("code"))
+	if code == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "رمز التحقق مطلوب")
+		return
+	}
+
+	user, err := app.Model.UserDB.GetUser(r.Context(), userID)
+	if err != nil {
+		app.handleRetrievalError(w, r, err)
+		return
+	}
+	if user.PhoneVerifiedAt != nil {
+		app.errorResponse(w, r, http.StatusConflict, "رقم الهاتف مؤكد مسبقاً")
+		return
+	}
+
+	if err := app.Model.OTPDB.Verify(r.Context(), user.PhoneNumber, data.OTPPurposeVerifyPhone, code, otpMaxAttempts); err != nil {
+		app.otpErrorResponse(w, r, err, time.Time{})
+		return
+	}
+
+	if err := app.Model.UserDB.MarkPhoneVerified(r.Context(), userID); err != nil {
+		app.handleRetrievalError(w, r, err)
+		return
+	}
+
+	user, err = app.Model.UserDB.GetUser(r.Context(), userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message": "تم تأكيد رقم الهاتف بنجاح",
+		"user":    user,
+	})
+}
+
+// ForgotPasswordHandler handles POST requests that send a password reset
+// code. The response is the same whether or not the number is registered,
+// and the code is sent in the background so the timing is the same too. It
+// responds 503 while no SMS provider is configured.
+func (app *application) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if app.sms == nil {
+		app.smsUnavailableResponse(w, r)
+		return
+	}
+
+	phoneNumber := strings.TrimSpace(r.FormValue("phone_number"))
+
+	v := validator.New()
+	data.ValidateUser(v, &data.User{PhoneNumber: phoneNumber}, "phone_number")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	select {
+	case app.otpSends <- struct{}{}:
+		// The send outlives the request but keeps its request id for the log
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), otpSendTimeout)
+		app.background.Add(1)
+		go func() {
+			defer func() {
+				cancel()
+				<-app.otpSends
+				app.background.Done()
+			}()
+
+			if _, err := app.Model.UserDB.GetUserByPhoneNumber(r.Context(), phoneNumber); err != nil {
+				if !errors.Is(err, data.ErrUserNotFound) {
+					app.log.ErrorContext(ctx, "Forgot password", "error", err)
+				}
+				return
+			}
+
+			_, err := app.sendOTP(ctx, phoneNumber, data.OTPPurposeResetPassword)
+			if err != nil && !errors.Is(err, data.ErrOTPCooldown) {
+				app.log.ErrorContext(ctx, "Forgot password", "error", err)
+			}
+		}()
+	default:
+		app.log.WarnContext(r.Context(), "Too many password reset codes being sent; request dropped")
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message":    forgotPasswordMessage,
+		"expires_in": int(otpTTL.Seconds()),
+	})
+}
+
+// ResetPasswordHandler handles POST requests that set a new password with a
+// code from ForgotPasswordHandler. It signs the user out of every device.
+func (app *application) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	phoneNumber := strings.TrimSpace(r.FormValue("phone_number"))
+	code := strings.TrimSpace(r.FormValue("code"))
+	password := r.FormValue("password")
+
+	if phoneNumber == "" || code == "" || password == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "يجب إدخال رقم الهاتف ورمز التحقق وكلمة المرور الجديدة")
+		return
+	}
+
+	v := validator.New()
+	data.ValidateUser(v, &data.User{PhoneNumber: phoneNumber, Password: password}, "phone_number", "password")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := app.Model.OTPDB.Verify(r.Context(), phoneNumber, data.OTPPurposeResetPassword, code, otpMaxAttempts); err != nil {
+		app.otpErrorResponse(w, r, err, time.Time{})
+		return
+	}
+
+	user, err := app.Model.UserDB.GetUserByPhoneNumber(r.Context(), phoneNumber)
+	if err != nil {
+		app.handleRetrievalError(w, r, err)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusInternalServerError, "خطأ في تشفير كلمة المرور")
+		return
+	}
+
+	if err := app.Model.UserDB.ResetPassword(r.Context(), user.ID, hashedPassword); err != nil {
+		app.handleRetrievalError(w, r, err)
+		return
+	}
+	if err := app.endAllSessions(r.Context(), user.ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.ClearTokenCookies(w)
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message": "تم تغيير كلمة المرور بنجاح، يرجى تسجيل الدخول",
+	})
+}
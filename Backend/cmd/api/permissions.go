@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"project/internal/data"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// permissionCacheTTL bounds how long a role or permission change made on
+// another instance takes to apply here; changes made on this instance apply
+// at once.
+const permissionCacheTTL = 30 * time.Second
+
+// permissionScope returns the section a request acts on, zero when it is
+// not about one section, or anySection.
+type permissionScope func(r *http.Request) (int, error)
+
+// anySection is returned by a scope whose handler checks sections itself;
+// holding the permission for some section is enough to get that far.
+const anySection = -1
+
+// permissionCache keeps each user's permissions for permissionCacheTTL, so
+// checks follow the database without a query per request.
+type permissionCache struct {
+	mu      sync.Mutex
+	entries map[uuid.UUID]permissionCacheEntry
+}
+
+type permissionCacheEntry struct {
+	set     *data.PermissionSet
+	expires time.Time
+}
+
+func newPermissionCache() *permissionCache {
+	return &permissionCache{entries: make(map[uuid.UUID]permissionCacheEntry)}
+}
+
+func (c *permissionCache) get(userID uuid.UUID) (*data.PermissionSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[userID]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.set, true
+}
+
+func (c *permissionCache) put(userID uuid.UUID, set *data.PermissionSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for id, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[userID] = permissionCacheEntry{set: set, expires: now.Add(permissionCacheTTL)}
+}
+
+func (c *permissionCache) invalidate(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+}
+
+// permissionsFor returns the user's current permissions.
+func (app *application) permissionsFor(ctx context.Context, userID uuid.UUID) (*data.PermissionSet, error) {
+	if set, ok := app.permissions.get(userID); ok {
+		app.metrics.cacheRequests.Inc("permissions", "hit")
+		return set, nil
+	}
+	app.metrics.cacheRequests.Inc("permissions", "miss")
+	set, err := app.Model.PermissionDB.ForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	app.permissions.put(userID, set)
+	return set, nil
+}
+
+// can reports whether the authenticated user holds permission, everywhere
+// or, when sectionID is set, for that section.
+func (app *application) can(r *http.Request, permission string, sectionID int) (bool, error) {
+	idStr, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		return false, nil
+	}
+	userID, err := uuid.Parse(idStr)
+	if err != nil {
+		return false, nil
+	}
+
+	set, err := app.permissionsFor(r.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+	if sectionID == anySection {
+		return set.AllowsSomeSection(permission), nil
+	}
+	return set.Allows(permission, sectionID), nil
+}
+
+// RequirePermission lets a request through when the authenticated user
+// holds permission for the section scope picks out of it; a nil scope
+// requires the permission everywhere. It must run after AuthMiddleware.
+func (app *application) RequirePermission(permission string, scope permissionScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Value(UserIDKey).(string); !ok {
+				app.unauthorizedResponse(w, r)
+				return
+			}
+
+			sectionID := 0
+			if scope != nil {
+				var err error
+				sectionID, err = scope(r)
+				if err != nil {
+					if errors.Is(err, data.ErrSectionNotFound) {
+						app.errorResponse(w, r, http.StatusNotFound, err.Error())
+						return
+					}
+					app.serverErrorResponse(w, r, err)
+					return
+				}
+			}
+
+			allowed, err := app.can(r, permission, sectionID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if !allowed {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sectionScope scopes a request to the section named by its section query
+// or form value.
+func (app *application) sectionScope(r *http.Request) (int, error) {
+	value := r.FormValue("section")
+	if value == "" {
+		return 0, nil
+	}
+	return app.sectionIDFromValue(r.Context(), value)
+}
+
+// anySectionScope defers the section check to the handler.
+func anySectionScope(r *http.Request) (int, error) {
+	return anySection, nil
+}
+
+// sectionIDFromValue resolves a section given by id or by name.
+func (app *application) sectionIDFromValue(ctx context.Context, value string) (int, error) {
+	if id, err := strconv.Atoi(value); err == nil {
+		return id, nil
+	}
+	section, err := app.Model.SectionsDB.GetSectionByName(ctx, value)
+	if err != nil {
+		return 0, err
+	}
+	return section.ID, nil
+}
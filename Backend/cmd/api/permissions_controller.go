@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"project/internal/data"
+	"project/utils"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ListPermissionsHandler lists every permission with the roles that grant it
+func (app *application) ListPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.Model.PermissionDB.ListPermissions(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{"permissions": permissions})
+}
+
+// GetUserPermissionsHandler shows what a user may do and which of it was
+// granted to them directly.
+func (app *application) GetUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("معرف المستخدم غير صالح"))
+		return
+	}
+
+	if _, err := app.Model.UserDB.GetUser(r.Context(), userID); err != nil {
+		app.handleRetrievalError(w, r, err)
+		return
+	}
+
+	effective, err := app.Model.PermissionDB.ForUser(r.Context(), userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	grants, err := app.Model.PermissionDB.ListUserPermissions(r.Context(), userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"permissions": effective,
+		"grants":      grants,
+	})
+}
+
+// userPermissionFromRequest reads the user_id, permission and optional
+// section (id or name) form values of a grant or revoke. On failure it
+// writes the error response and returns ok false.
+func (app *application) userPermissionFromRequest(w http.ResponseWriter, r *http.Request) (userID uuid.UUID, permission string, sectionID *int, ok bool) {
+	userID, err := uuid.Parse(r.FormValue("user_id"))
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("معرف المستخدم غير صالح"))
+		return uuid.Nil, "", nil, false
+	}
+
+	permission = strings.TrimSpace(r.FormValue("permission"))
+	if permission == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "الصلاحية مطلوبة")
+		return uuid.Nil, "", nil, false
+	}
+
+	if value := strings.TrimSpace(r.FormValue("section")); value != "" {
+		id, err := app.sectionIDFromValue(r.Context(), value)
+		if err != nil {
+			if errors.Is(err, data.ErrSectionNotFound) {
+				app.errorResponse(w, r, http.StatusNotFound, err.Error())
+				return uuid.Nil, "", nil, false
+			}
+			app.serverErrorResponse(w, r, err)
+			return uuid.Nil, "", nil, false
+		}
+		sectionID = &id
+	}
+
+	return userID, permission, sectionID, true
+}
+
+// GrantPermissionHandler grants a permission to a user directly, for one
+// section when section is given and everywhere otherwise.
+func (app *application) GrantPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, permission, sectionID, ok := app.userPermissionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.Model.PermissionDB.GrantToUser(r.Context(), userID, permission, sectionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPermissionNotFound), errors.Is(err, data.ErrSectionNotFound):
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+		case errors.Is(err, data.ErrDuplicatedPermission):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.handleRetrievalError(w, r, err)
+		}
+		return
+	}
+	app.permissions.invalidate(userID)
+	grant := map[string]any{"user_id": userID, "permission": permission, "section_id": sectionID}
+	app.audit(r, data.AuditGrant, data.AuditEntityUserPermission, userID, nil, grant)
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{"message": "تم منح الصلاحية بنجاح"})
+}
+
+// RevokePermissionHandler removes a permission granted to a user directly.
+// Permissions that come from a role are removed by revoking the role.
+func (app *application) RevokePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, permission, sectionID, ok := app.userPermissionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.Model.PermissionDB.RevokeFromUser(r.Context(), userID, permission, sectionID)
+	if err != nil {
+		if errors.Is(err, data.ErrUserPermissionMissing) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.permissions.invalidate(userID)
+	grant := map[string]any{"user_id": userID, "permission": permission, "section_id": sectionID}
+	app.audit(r, data.AuditRevoke, data.AuditEntityUserPermission, userID, grant, nil)
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{"message": "تم سحب الصلاحية بنجاح"})
+}
@@ -5,21 +5,59 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"project/internal/data"
+	"project/internal/hijri"
+	"project/internal/prayertime"
 	"project/utils"
 	"project/utils/validator"
 	"strconv"
 	"time"
 )
 
+// sectionFromRequest resolves the section named by ?section= or, when only
+// ?lat=&lng= are given, the section nearest to that position. On failure it
+// writes the error response and returns nil.
+func (app *application) sectionFromRequest(w http.ResponseWriter, r *http.Request) *data.Section {
+	var section *data.Section
+	var err error
+
+	if sectionName := r.URL.Query().Get("section"); sectionName != "" {
+		section, err = app.Model.SectionsDB.GetSectionByName(r.Context(), sectionName)
+	} else {
+		lat, lng, ok, parseErr := parseCoordinates(r.URL.Query())
+		if parseErr != nil {
+			app.badRequestResponse(w, r, parseErr)
+			return nil
+		}
+		if !ok {
+			app.errorResponse(w, r, http.StatusBadRequest, "القسم أو الإحداثيات مطلوبة")
+			return nil
+		}
+
+		var nearest []data.NearestSection
+		nearest, err = app.Model.SectionsDB.GetNearestSections(r.Context(), lat, lng, 1)
+		if err == nil {
+			section = &nearest[0].Section
+		}
+	}
+
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return nil
+		}
+		app.serverErrorResponse(w, r, err)
+		return nil
+	}
+	return section
+}
+
 func (app *application) GetPrayerTimesHandler(w http.ResponseWriter, r *http.Request) {
 	dayStr := r.URL.Query().Get("day")
 	monthStr := r.URL.Query().Get("month")
-	sectionName := r.URL.Query().Get("section")
 
-	if dayStr == "" || monthStr == "" || sectionName == "" {
-		app.errorResponse(w, r, http.StatusBadRequest, "اليوم، الشهر، والقسم مطلوبة")
+	if dayStr == "" || monthStr == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "اليوم والشهر مطلوبان")
 		return
 	}
 
@@ -35,14 +73,26 @@ func (app *application) GetPrayerTimesHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	sectionID, err := app.Model.PrayerTimesDB.GetSectionIDByName(sectionName)
-	if err != nil {
-		app.errorResponse(w, r, http.StatusNotFound, err.Error())
+	section := app.sectionFromRequest(w, r)
+	if section == nil {
 		return
 	}
 
-	prayer, err := app.Model.PrayerTimesDB.GetPrayerTimes(day, month, sectionID)
+	source := data.PrayerTimesSourceTable
+	prayer, err := app.Model.PrayerTimesDB.GetPrayerTimes(r.Context(), day, month, section.ID)
+	if err == nil && prayer.Derived {
+		source = data.PrayerTimesSourceDerived
+	}
+	if errors.Is(err, data.ErrPrayerTimesNotFound) {
+		// No curated row for this day; fall back to the astronomical calculation.
+		source = data.PrayerTimesSourceCalculated
+		prayer, err = app.calculatePrayerTimes(section, day, month)
+	}
 	if err != nil {
+		if errors.Is(err, data.ErrPrayerTimesNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
 		app.handleRetrievalError(w, r, err)
 		return
 	}
@@ -51,20 +101,122 @@ func (app *application) GetPrayerTimesHandler(w http.ResponseWriter, r *http.Req
 	type Response struct {
 		PrayerTimes *data.PrayerTimes `json:"prayer_times"`
 		Section     string            `json:"section"`
+		Source      string            `json:"source"`
+		Hijri       *hijri.DateInfo   `json:"hijri,omitempty"`
+		Imsak       string            `json:"imsak,omitempty"`
+	}
+
+	response := Response{
+		PrayerTimes: prayer,
+		Section:     section.Name,
+		Source:      source,
+	}
+	if loc, err := section.Location(); err == nil {
+		date := time.Date(time.Now().In(loc).Year(), time.Month(month), day, 0, 0, 0, 0, loc)
+		if date.Day() == day {
+			info := app.hijriDate(section, date).Info()
+			response.Hijri = &info
+			if info.Month == ramadanMonth {
+				response.Imsak = app.imsakTime(prayer.FajrSecondTime).Format("15:04")
+			}
+		}
 	}
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
-		"prayer_times": Response{
-			PrayerTimes: prayer,
-			Section:     sectionName,
-		},
+		"prayer_times": response,
 	})
 }
 
+// calculatePrayerTimes computes the times for a day that has no curated row,
+// from the section's coordinates and calculation method. Sections without
+// coordinates yield ErrPrayerTimesNotFound.
+func (app *application) calculatePrayerTimes(section *data.Section, day, month int) (*data.PrayerTimes, error) {
+	loc, err := section.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	date := time.Date(time.Now().In(loc).Year(), time.Month(month), day, 0, 0, 0, 0, loc)
+	if date.Day() != day {
+		return nil, data.ErrPrayerTimesNotFound
+	}
+	return app.calculatePrayerTimesOn(section, date)
+}
+
+// calculatePrayerTimesOn is calculatePrayerTimes for a specific date, which
+// must be in the section's location.
+func (app *application) calculatePrayerTimesOn(section *data.Section, date time.Time) (*data.PrayerTimes, error) {
+	if !section.HasCoordinates() {
+		return nil, data.ErrPrayerTimesNotFound
+	}
+	loc := date.Location()
+	day, month := date.Day(), int(date.Month())
+
+	method, ok := prayertime.MethodByName(section.CalculationMethod)
+	if !ok {
+		method = prayertime.Egyptian
+	}
+	asr, ok := prayertime.AsrMethodByName(section.AsrMethod)
+	if !ok {
+		asr = prayertime.Shafii
+	}
+
+	times, err := prayertime.Calculate(date, prayertime.Location{
+		Latitude:  *section.Latitude,
+		Longitude: *section.Longitude,
+		Elevation: section.Elevation,
+		TimeZone:  loc,
+	}, prayertime.Params{Method: method, Asr: asr})
+	if err != nil {
+		if errors.Is(err, prayertime.ErrUnreachable) {
+			return nil, data.ErrPrayerTimesNotFound
+		}
+		return nil, err
+	}
+
+	// The calculation has no notion of a separate first Fajr, so both
+	// columns carry the same time.
+	return &data.PrayerTimes{
+		Day:            day,
+		Month:          month,
+		FajrFirstTime:  clockTime(times.Fajr),
+		FajrSecondTime: clockTime(times.Fajr),
+		SunriseTime:    clockTime(times.Sunrise),
+		DhuhrTime:      clockTime(times.Dhuhr),
+		AsrTime:        clockTime(times.Asr),
+		MaghribTime:    clockTime(times.Maghrib),
+		IshaTime:       clockTime(times.Isha),
+		SectionID:      section.ID,
+		Name:           section.Name,
+	}, nil
+}
+
+// prayerTimesOn returns the section's times for a date in its location: the
+// timetable row when there is one, its own or derived from its parent, the
+// calculated times otherwise. The second result names which it is.
+func (app *application) prayerTimesOn(ctx context.Context, section *data.Section, date time.Time) (*data.PrayerTimes, string, error) {
+	prayer, err := app.Model.PrayerTimesDB.GetPrayerTimes(ctx, date.Day(), int(date.Month()), section.ID)
+	if errors.Is(err, data.ErrPrayerTimesNotFound) {
+		prayer, err = app.calculatePrayerTimesOn(section, date)
+		return prayer, data.PrayerTimesSourceCalculated, err
+	}
+	if err == nil && prayer.Derived {
+		return prayer, data.PrayerTimesSourceDerived, nil
+	}
+	return prayer, data.PrayerTimesSourceTable, err
+}
+
+// clockTime rounds t to the minute and strips the date, matching how TIME
+// columns are scanned from the prayer_times table.
+func clockTime(t time.Time) time.Time {
+	t = t.Round(time.Minute)
+	return time.Date(0, 1, 1, t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
 func (app *application) ListPrayerTimesHandler(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
-	prayers, meta, err := app.Model.PrayerTimesDB.ListPrayerTimes(queryParams)
+	prayers, meta, err := app.Model.PrayerTimesDB.ListPrayerTimes(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -105,8 +257,17 @@ func (app *application) SearchPrayerTimesHandler(w http.ResponseWriter, r *http.
 		}
 	}
 
+	// A position may stand in for the section name
+	if sectionName == "" && (r.URL.Query().Get("lat") != "" || r.URL.Query().Get("lng") != "") {
+		section := app.sectionFromRequest(w, r)
+		if section == nil {
+			return
+		}
+		sectionName = section.Name
+	}
+
 	// Search for prayer times
-	prayers, err := app.Model.PrayerTimesDB.SearchPrayerTimes(day, month, sectionName)
+	prayers, err := app.Model.PrayerTimesDB.SearchPrayerTimes(r.Context(), day, month, sectionName)
 	if err != nil {
 		if errors.Is(err, data.ErrPrayerTimesNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "لم يتم العثور على مواقيت صلاة مطابقة")
@@ -129,7 +290,7 @@ func (app *application) CreatePrayerTimesHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	sectionID, err := app.Model.PrayerTimesDB.GetSectionIDByName(sectionName)
+	sectionID, err := app.Model.PrayerTimesDB.GetSectionIDByName(r.Context(), sectionName)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusNotFound, err.Error())
 		return
@@ -186,7 +347,7 @@ func (app *application) CreatePrayerTimesHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if err := app.Model.PrayerTimesDB.InsertPrayerTimes(prayer); err != nil {
+	if err := app.Model.PrayerTimesDB.InsertPrayerTimes(r.Context(), prayer); err != nil {
 		if errors.Is(err, data.ErrPrayerTimesAlreadyInserted) {
 			app.errorResponse(w, r, http.StatusConflict, "مواقيت الصلاة لهذا اليوم والشهر والقسم موجودة مسبقاً")
 			return
@@ -194,6 +355,8 @@ func (app *application) CreatePrayerTimesHandler(w http.ResponseWriter, r *http.
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, data.AuditEntityPrayerTimes, prayerTimesAuditID(sectionID, prayer.Month, prayer.Day),
+		nil, app.prayerTimesSnapshot(r.Context(), prayer.Day, prayer.Month, sectionID))
 
 	utils.SendJSONResponse(w, http.StatusCreated, utils.Envelope{
 		"message":      "تم إنشاء مواقيت الصلاة بنجاح",
@@ -224,17 +387,20 @@ func (app *application) DeletePrayerTimesHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	sectionID, err := app.Model.PrayerTimesDB.GetSectionIDByName(sectionName)
+	sectionID, err := app.Model.PrayerTimesDB.GetSectionIDByName(r.Context(), sectionName)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusNotFound, err.Error())
 		return
 	}
 
-	err = app.Model.PrayerTimesDB.DeletePrayerTimes(day, month, sectionID)
+	before := app.prayerTimesSnapshot(r.Context(), day, month, sectionID)
+
+	err = app.Model.PrayerTimesDB.DeletePrayerTimes(r.Context(), day, month, sectionID, authenticatedUserID(r))
 	if err != nil {
 		app.handleRetrievalError(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditDelete, data.AuditEntityPrayerTimes, prayerTimesAuditID(sectionID, month, day), before, nil)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message": "تم حذف مواقيت الصلاة بنجاح",
@@ -266,7 +432,7 @@ func (app *application) UpdatePrayerTimesHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	sectionID, err := app.Model.PrayerTimesDB.GetSectionIDByName(sectionName)
+	sectionID, err := app.Model.PrayerTimesDB.GetSectionIDByName(r.Context(), sectionName)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusNotFound, err.Error())
 		return
@@ -323,7 +489,8 @@ func (app *application) UpdatePrayerTimesHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	if err := app.Model.PrayerTimesDB.UpdatePrayerTimes(prayer); err != nil {
+	before := app.prayerTimesSnapshot(r.Context(), day, month, sectionID)
+	if err := app.Model.PrayerTimesDB.UpdatePrayerTimes(r.Context(), prayer, authenticatedUserID(r)); err != nil {
 		if errors.Is(err, data.ErrPrayerTimesNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "مواقيت الصلاة المطلوبة غير موجودة")
 			return
@@ -335,6 +502,8 @@ func (app *application) UpdatePrayerTimesHandler(w http.ResponseWriter, r *http.
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditUpdate, data.AuditEntityPrayerTimes, prayerTimesAuditID(sectionID, month, day),
+		before, app.prayerTimesSnapshot(r.Context(), day, month, sectionID))
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message":      "تم تحديث مواقيت الصلاة بنجاح",
@@ -343,6 +512,75 @@ func (app *application) UpdatePrayerTimesHandler(w http.ResponseWriter, r *http.
 	})
 }
 
+// MaterializePrayerTimesHandler handles POST requests that store the prayer
+// times a section derives from its parent as rows of its own. The section
+// keeps its parent for days the parent adds later.
+func (app *application) MaterializePrayerTimesHandler(w http.ResponseWriter, r *http.Request) {
+	sectionValue := r.FormValue("section")
+	if sectionValue == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "القسم مطلوب")
+		return
+	}
+	sectionID, err := app.sectionIDFromValue(r.Context(), sectionValue)
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	section, err := app.Model.SectionsDB.GetSectionByID(r.Context(), sectionID)
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if section.ParentSectionID == nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "القسم لا يتبع قسمًا مرجعيًا")
+		return
+	}
+
+	rows, err := app.Model.PrayerTimesDB.MaterializePrayerTimes(r.Context(), section.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if rows > 0 {
+		app.audit(r, data.AuditMaterialize, data.AuditEntityPrayerTimes, section.ID, nil, map[string]any{
+			"section_id":        section.ID,
+			"parent_section_id": *section.ParentSectionID,
+			"rows":              rows,
+		})
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message": "تم تثبيت مواقيت الصلاة المشتقة بنجاح",
+		"section": section.Name,
+		"rows":    rows,
+	})
+}
+
+// prayerTimesAuditID identifies a day's prayer times in the audit log as
+// section:month-day.
+func prayerTimesAuditID(sectionID, month, day int) string {
+	return fmt.Sprintf("%d:%d-%d", sectionID, month, day)
+}
+
+// prayerTimesSnapshot returns the stored prayer times for the audit log, or
+// nil when there are none.
+func (app *application) prayerTimesSnapshot(ctx context.Context, day, month, sectionID int) any {
+	prayer, err := app.Model.PrayerTimesDB.GetPrayerTimes(ctx, day, month, sectionID)
+	if err != nil {
+		return nil
+	}
+	return prayer.ToResponse()
+}
+
 // Helper function to parse integer form values
 func parseIntFormValue(value string) int {
 	if value == "" {
@@ -366,116 +604,54 @@ func parseTime(value string) (time.Time, error) {
 	}
 	return time.Date(0, 1, 1, t.Hour(), t.Minute(), 0, 0, time.UTC), nil
 }
-func (app *application) checkPrayerTimes(ctx context.Context) {
-	currentTime := time.Now()
-	currentDay := currentTime.Day()
-	currentMonth := int(currentTime.Month())
-
-	// Query prayer times for today
-	prayers, _, err := app.Model.PrayerTimesDB.ListPrayerTimes(url.Values{
-		"day":   []string{fmt.Sprintf("%d", currentDay)},
-		"month": []string{fmt.Sprintf("%d", currentMonth)},
-	})
+
+// checkPrayerTimes runs every minute and enqueues the alerts that are due in
+// each section; the outbox worker delivers them.
+func (app *application) checkPrayerTimes() {
+	ctx := context.Background()
+
+	sections, err := app.Model.SectionsDB.GetAllSections(ctx)
 	if err != nil {
-		app.log.Printf("Failed to fetch prayer times: %v", err)
+		app.log.Error("Failed to fetch sections", "error", err)
 		return
 	}
 
-	// Check each prayer time
-	for _, prayer := range prayers {
-		pt := data.PrayerTimes{
-			FajrFirstTime:  parseTimeForDate(prayer.FajrFirstTime, currentTime, app.log),
-			FajrSecondTime: parseTimeForDate(prayer.FajrSecondTime, currentTime, app.log),
-			SunriseTime:    parseTimeForDate(prayer.SunriseTime, currentTime, app.log),
-			DhuhrTime:      parseTimeForDate(prayer.DhuhrTime, currentTime, app.log),
-			AsrTime:        parseTimeForDate(prayer.AsrTime, currentTime, app.log),
-			MaghribTime:    parseTimeForDate(prayer.MaghribTime, currentTime, app.log),
-			IshaTime:       parseTimeForDate(prayer.IshaTime, currentTime, app.log),
-			SectionID:      prayer.SectionID,
-			Name:           prayer.Name,
+	// Each section is checked against its own local day and clock.
+	for i := range sections {
+		section := &sections[i]
+		loc, err := section.Location()
+		if err != nil {
+			app.log.Warn("Skipping section", "section", section.Name, "error", err)
+			continue
 		}
-		app.notifyIfPrayerTime(ctx, pt, currentTime)
-	}
-}
+		currentTime := time.Now().In(loc)
 
-func parseTimeForDate(timeStr string, currentTime time.Time) time.Time {
-	t, err := time.Parse("15:04", timeStr)
-	if err != nil {
-		return time.Time{}
-	}
-	return time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(),
-		t.Hour(), t.Minute(), 0, 0, currentTime.Location())
-}
-func (app *application) notifyIfPrayerTime(ctx context.Context, pt data.PrayerTimes, currentTime time.Time) {
-	timeWindow := time.Minute // 1-minute window to avoid duplicate notifications
-	prayerTimes := []struct {
-		name string
-		time time.Time
-	}{
-		{"الفجر الأول", pt.FajrFirstTime},
-		{"الفجر الثاني", pt.FajrSecondTime},
-		{"الظهر", pt.DhuhrTime},
-		{"العصر", pt.AsrTime},
-		{"المغرب", pt.MaghribTime},
-		{"العشاء", pt.IshaTime},
-	}
-
-	topic := fmt.Sprintf("prayer_notifications_%d", pt.SectionID) // Section-specific topic
-
-	for _, prayer := range prayerTimes {
-		if isWithinTimeWindow(currentTime, prayer.time, timeWindow) {
-			message := &messaging.Message{
-				Notification: &messaging.Notification{
-					Title: fmt.Sprintf("وقت صلاة %s في %s", prayer.name, pt.Name),
-					Body:  fmt.Sprintf("حان وقت صلاة %s في %s الساعة %s", prayer.name, pt.Name, prayer.time.Format("15:04")),
-				},
-				Data: map[string]string{
-					"prayer":       prayer.name,
-					"section":      pt.Name,
-					"click_action": "http://localhost:8080", // Updated to local web page
-				},
-				Topic: topic, // Use section-specific topic
-			}
-			// Retry up to 3 times
-			for retries := 3; retries > 0; retries-- {
-				_, err := app.fcm.Send(ctx, message)
-				if err == nil {
-					app.infoLog.Printf("Sent notification for %s in %s at %s", prayer.name, pt.Name, prayer.time.Format("15:04"))
-					break
-				}
-				app.log.Printf("Retrying notification for %s in %s (%d retries left): %v", prayer.name, pt.Name, retries-1, err)
-				time.Sleep(time.Second)
+		prayer, _, err := app.prayerTimesOn(ctx, section, currentTime)
+		if err != nil {
+			if !errors.Is(err, data.ErrPrayerTimesNotFound) {
+				app.log.Error("Failed to fetch prayer times", "section", section.Name, "error", err)
 			}
+			continue
 		}
-	}
-}
 
-func isWithinTimeWindow(currentTime, prayerTime time.Time, window time.Duration) bool {
-	return currentTime.After(prayerTime) && currentTime.Sub(prayerTime) <= window
-}
-
-func (app *application) SubscribeToNotificationsHandler(w http.ResponseWriter, r *http.Request) {
-	token := r.FormValue("token")
-	sectionID := r.FormValue("section_id") // New parameter for section ID
-	if token == "" || sectionID == "" {
-		utils.SendJSONResponse(w, http.StatusBadRequest, utils.Envelope{
-			"error": "FCM token and section_id are required",
-		})
-		return
-	}
-
-	ctx := r.Context()
-	topic := fmt.Sprintf("prayer_notifications_%s", sectionID) // Section-specific topic
-	_, err := app.fcm.SubscribeToTopic(ctx, []string{token}, topic)
-	if err != nil {
-		app.log.Printf("Failed to subscribe to topic %s: %v", topic, err)
-		utils.SendJSONResponse(w, http.StatusInternalServerError, utils.Envelope{
-			"error": "Failed to subscribe to notifications",
-		})
-		return
+		pt := data.PrayerTimes{
+			FajrFirstTime:  timeOnDate(prayer.FajrFirstTime, currentTime),
+			FajrSecondTime: timeOnDate(prayer.FajrSecondTime, currentTime),
+			SunriseTime:    timeOnDate(prayer.SunriseTime, currentTime),
+			DhuhrTime:      timeOnDate(prayer.DhuhrTime, currentTime),
+			AsrTime:        timeOnDate(prayer.AsrTime, currentTime),
+			MaghribTime:    timeOnDate(prayer.MaghribTime, currentTime),
+			IshaTime:       timeOnDate(prayer.IshaTime, currentTime),
+			SectionID:      section.ID,
+			Name:           section.Name,
+		}
+		app.enqueueDueNotifications(ctx, pt, currentTime, app.isRamadan(section, currentTime))
 	}
+}
 
-	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
-		"message": fmt.Sprintf("Successfully subscribed to notifications for section %s", sectionID),
-	})
+// timeOnDate places the clock time of t on the calendar day of date, in
+// date's location.
+func timeOnDate(t time.Time, date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(),
+		t.Hour(), t.Minute(), 0, 0, date.Location())
 }
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"project/internal/data"
+	"project/internal/hijri"
+	"project/internal/ical"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// exportRefreshInterval is how often calendar apps are asked to re-fetch a
+// subscribed feed.
+const exportRefreshInterval = 24 * time.Hour
+
+// exportEventDuration is the length given to each prayer event in the feed.
+const exportEventDuration = 15 * time.Minute
+
+var arabicMonths = [...]string{"", "يناير", "فبراير", "مارس", "أبريل", "مايو", "يونيو",
+	"يوليو", "أغسطس", "سبتمبر", "أكتوبر", "نوفمبر", "ديسمبر"}
+
+var arabicWeekdays = [...]string{"الأحد", "الاثنين", "الثلاثاء", "الأربعاء", "الخميس", "الجمعة", "السبت"}
+
+// exportDay is one timetable row placed on a concrete date.
+type exportDay struct {
+	Date    time.Time
+	Weekday string
+	Hijri   hijri.Date
+	data.PrayerTimesResponse
+}
+
+// ExportPrayerTimesHandler handles GET requests that export a section's
+// timetable as CSV, printable HTML or an iCalendar feed.
+//
+// Query options:
+//   - section, or lat/lng for the nearest section
+//   - month (optional) limits the export to one month
+//   - year (optional) fixes the year; without it the export covers the
+//     coming twelve months so a subscribed feed never runs dry
+//   - format=csv|html|ics (default csv)
+func (app *application) ExportPrayerTimesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "html" && format != "ics" {
+		app.badRequestResponse(w, r, errors.New("الصيغة يجب أن تكون csv أو html أو ics"))
+		return
+	}
+
+	var month, year int
+	var err error
+	if monthStr := query.Get("month"); monthStr != "" {
+		month, err = strconv.Atoi(monthStr)
+		if err != nil || month < 1 || month > 12 {
+			app.badRequestResponse(w, r, errors.New("الشهر يجب أن يكون بين 1 و 12"))
+			return
+		}
+	}
+	if yearStr := query.Get("year"); yearStr != "" {
+		year, err = strconv.Atoi(yearStr)
+		if err != nil || year < 1900 || year > 2200 {
+			app.badRequestResponse(w, r, errors.New("السنة غير صالحة"))
+			return
+		}
+	}
+
+	section := app.sectionFromRequest(w, r)
+	if section == nil {
+		return
+	}
+
+	loc, err := section.Location()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rows, err := app.Model.PrayerTimesDB.SearchPrayerTimes(r.Context(), 0, month, section.Name)
+	if err != nil && !errors.Is(err, data.ErrPrayerTimesNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The search matches names loosely; keep only the requested section.
+	var sectionRows []data.PrayerTimesResponse
+	for _, row := range rows {
+		if row.SectionID == section.ID {
+			sectionRows = append(sectionRows, row)
+		}
+	}
+	if len(sectionRows) == 0 {
+		app.errorResponse(w, r, http.StatusNotFound, "لم يتم العثور على مواقيت صلاة مطابقة")
+		return
+	}
+
+	days := exportDates(sectionRows, year, time.Now().In(loc), loc)
+	if len(days) == 0 {
+		app.errorResponse(w, r, http.StatusNotFound, "لم يتم العثور على مواقيت صلاة مطابقة")
+		return
+	}
+	for i := range days {
+		days[i].Hijri = app.hijriDate(section, days[i].Date)
+	}
+
+	filename := fmt.Sprintf("prayer-times-%d", section.ID)
+	if year > 0 {
+		filename += fmt.Sprintf("-%d", year)
+	}
+	if month > 0 {
+		filename += fmt.Sprintf("-%02d", month)
+	}
+
+	switch format {
+	case "csv":
+		err = writeExportCSV(w, filename, days)
+	case "html":
+		err = writeExportHTML(w, r, section, month, days)
+	case "ics":
+		err = writeExportICS(w, r, filename, section, loc, days)
+	}
+	if err != nil {
+		app.log.ErrorContext(r.Context(), "Error writing export", "format", format, "section", section.ID, "error", err)
+	}
+}
+
+// exportDates places every day/month row on a date. With an explicit year
+// every row lands in that year; otherwise each row takes the next occurrence
+// counted from the start of the current month.
+func exportDates(rows []data.PrayerTimesResponse, year int, now time.Time, loc *time.Location) []exportDay {
+	days := make([]exportDay, 0, len(rows))
+	for _, row := range rows {
+		y := year
+		if y == 0 {
+			y = now.Year()
+			if row.Month < int(now.Month()) {
+				y++
+			}
+		}
+		date := time.Date(y, time.Month(row.Month), row.Day, 0, 0, 0, 0, loc)
+		if date.Day() != row.Day {
+			continue // 29 February outside a leap year
+		}
+		days = append(days, exportDay{
+			Date:                date,
+			Weekday:             arabicWeekdays[date.Weekday()],
+			PrayerTimesResponse: row,
+		})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date.Before(days[j].Date) })
+	return days
+}
+
+func writeExportCSV(w http.ResponseWriter, filename string, days []exportDay) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+	w.WriteHeader(http.StatusOK)
+
+	// A BOM lets spreadsheet programs detect UTF-8 for the Arabic names.
+	if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(append([]string{"date", "hijri_date"}, importColumns...))
+	for _, d := range days {
+		writer.Write([]string{
+			d.Date.Format("2006-01-02"), d.Hijri.String(),
+			strconv.Itoa(d.Day), strconv.Itoa(d.Month), d.Name,
+			d.FajrFirstTime, d.FajrSecondTime, d.SunriseTime,
+			d.DhuhrTime, d.AsrTime, d.MaghribTime, d.IshaTime,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+var exportHTMLTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html lang="ar" dir="rtl">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: "Amiri", "Noto Naskh Arabic", serif; margin: 2rem; color: #222; }
+  h1 { text-align: center; font-size: 1.6rem; margin-bottom: 1.5rem; }
+  table { width: 100%; border-collapse: collapse; font-size: 0.95rem; }
+  th, td { border: 1px solid #999; padding: 0.35rem 0.5rem; text-align: center; }
+  th { background: #eee; }
+  tr.friday td { background: #f6f6f6; font-weight: bold; }
+  thead { display: table-header-group; }
+  tr { page-break-inside: avoid; }
+  @page { size: A4; margin: 1.2cm; }
+  .subscribe { text-align: center; margin-top: 1.5rem; font-size: 0.9rem; }
+  @media print { body { margin: 0; } .subscribe { display: none; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table>
+<thead>
+<tr>
+  <th>التاريخ</th><th>الهجري</th><th>اليوم</th><th>الفجر الأول</th><th>الفجر الثاني</th><th>الشروق</th>
+  <th>الظهر</th><th>العصر</th><th>المغرب</th><th>العشاء</th>
+</tr>
+</thead>
+<tbody>
+{{range .Days}}<tr{{if eq .Date.Weekday 5}} class="friday"{{end}}>
+  <td>{{.Date.Format "2006-01-02"}}</td><td>{{.Hijri.Display}}</td><td>{{.Weekday}}</td><td>{{.FajrFirstTime}}</td><td>{{.FajrSecondTime}}</td><td>{{.SunriseTime}}</td>
+  <td>{{.DhuhrTime}}</td><td>{{.AsrTime}}</td><td>{{.MaghribTime}}</td><td>{{.IshaTime}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+<p class="subscribe"><a href="{{.FeedURL}}">اشترك في تقويم المواقيت</a></p>
+</body>
+</html>
+`))
+
+func writeExportHTML(w http.ResponseWriter, r *http.Request, section *data.Section, month int, days []exportDay) error {
+	title := "مواقيت الصلاة - " + section.Name
+	if month > 0 {
+		title += " - " + arabicMonths[month] + " " + strconv.Itoa(days[0].Date.Year())
+	}
+
+	// The page carries its own inline styles, which the default policy blocks.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	return exportHTMLTemplate.Execute(w, map[string]any{
+		"Title":   title,
+		"Days":    days,
+		"FeedURL": template.URL(exportFeedURL(r, section)),
+	})
+}
+
+func writeExportICS(w http.ResponseWriter, r *http.Request, filename string, section *data.Section, loc *time.Location, days []exportDay) error {
+	calendar := &ical.Calendar{
+		ProductID:       "-//Athan//Prayer Times//AR",
+		Name:            "مواقيت الصلاة - " + section.Name,
+		Location:        loc,
+		RefreshInterval: exportRefreshInterval,
+	}
+
+	host := r.Host
+	if host == "" {
+		host = "prayer-times"
+	}
+
+	for _, d := range days {
+		prayers := []struct {
+			key, name, time string
+		}{
+			{"fajr-first", "الفجر الأول", d.FajrFirstTime},
+			{"fajr-second", "الفجر الثاني", d.FajrSecondTime},
+			{"dhuhr", "الظهر", d.DhuhrTime},
+			{"asr", "العصر", d.AsrTime},
+			{"maghrib", "المغرب", d.MaghribTime},
+			{"isha", "العشاء", d.IshaTime},
+		}
+		for _, prayer := range prayers {
+			t, err := parseTime(prayer.time)
+			if err != nil {
+				continue
+			}
+			calendar.Events = append(calendar.Events, ical.Event{
+				UID:         fmt.Sprintf("%s-%s-%d@%s", d.Date.Format("20060102"), prayer.key, section.ID, host),
+				Start:       timeOnDate(t, d.Date),
+				Duration:    exportEventDuration,
+				Summary:     "صلاة " + prayer.name,
+				Description: d.Hijri.Display(),
+				Location:    section.Name,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename+".ics"))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(time.Hour.Seconds())))
+	w.WriteHeader(http.StatusOK)
+
+	return calendar.Write(w)
+}
+
+// exportFeedURL returns the webcal:// URL calendar apps subscribe to for a
+// section's feed.
+func exportFeedURL(r *http.Request, section *data.Section) string {
+	query := url.Values{"section": {section.Name}, "format": {"ics"}}
+	return fmt.Sprintf("webcal://%s/prayer-times/export?%s", r.Host, query.Encode())
+}
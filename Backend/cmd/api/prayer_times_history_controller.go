@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"project/internal/data"
+	"project/utils"
+	"strconv"
+)
+
+// PrayerTimesHistoryHandler handles GET requests for the history of a day's
+// prayer times: the current values and every earlier version, newest
+// first. It takes ?day=&month=&section= where section is an id or a name.
+func (app *application) PrayerTimesHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("day") == "" || query.Get("month") == "" || query.Get("section") == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "اليوم، الشهر، والقسم مطلوبة")
+		return
+	}
+
+	day, err := strconv.Atoi(query.Get("day"))
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("اليوم يجب أن يكون رقمًا صحيحًا"))
+		return
+	}
+	month, err := strconv.Atoi(query.Get("month"))
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("الشهر يجب أن يكون رقمًا صحيحًا"))
+		return
+	}
+
+	sectionID, err := app.sectionIDFromValue(r.Context(), query.Get("section"))
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var current any
+	prayer, err := app.Model.PrayerTimesDB.GetPrayerTimes(r.Context(), day, month, sectionID)
+	switch {
+	case err == nil:
+		current = prayer.ToResponse()
+	case !errors.Is(err, data.ErrPrayerTimesNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	revisions, err := app.Model.PrayerTimesDB.ListRevisions(r.Context(), day, month, sectionID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"current":   current,
+		"revisions": revisions,
+	})
+}
+
+// RevertPrayerTimesHandler handles POST requests that restore the prayer
+// times kept by revision_id. The values it replaces become a revision too.
+func (app *application) RevertPrayerTimesHandler(w http.ResponseWriter, r *http.Request) {
+	revisionID, err := strconv.ParseInt(r.FormValue("revision_id"), 10, 64)
+	if err != nil || revisionID <= 0 {
+		app.badRequestResponse(w, r, errors.New("معرف النسخة غير صالح"))
+		return
+	}
+
+	revision, err := app.Model.PrayerTimesDB.GetRevision(r.Context(), revisionID)
+	if err != nil {
+		if errors.Is(err, data.ErrRevisionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	allowed, err := app.can(r, data.PermPrayerTimesWrite, revision.SectionID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	before := app.prayerTimesSnapshot(r.Context(), revision.Day, revision.Month, revision.SectionID)
+
+	prayer, err := app.Model.PrayerTimesDB.RevertPrayerTimes(r.Context(), revisionID, authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, data.ErrRevisionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.audit(r, data.AuditRevert, data.AuditEntityPrayerTimes, prayerTimesAuditID(prayer.SectionID, prayer.Month, prayer.Day),
+		before, prayer.ToResponse())
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message":      "تمت استعادة مواقيت الصلاة بنجاح",
+		"prayer_times": prayer.ToResponse(),
+	})
+}
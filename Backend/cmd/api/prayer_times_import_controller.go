@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"project/internal/data"
+	"project/utils"
+	"project/utils/validator"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportSize bounds the size of an uploaded timetable.
+const maxImportSize = 10 << 20
+
+// importColumns is the expected column order when the file has no header.
+var importColumns = []string{
+	"day", "month", "section",
+	"fajr_first_time", "fajr_second_time", "sunrise_time",
+	"dhuhr_time", "asr_time", "maghrib_time", "isha_time",
+}
+
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// ImportPrayerTimesHandler handles POST requests that import a whole timetable
+// from CSV. The file is sent as the multipart field "file" or as a text/csv
+// body. Every row is validated before anything is written; any invalid row
+// rejects the whole import.
+//
+// Query/form options:
+//   - dry_run=true validates and counts without saving
+//   - on_conflict=skip|upsert decides what happens to rows that already exist
+func (app *application) ImportPrayerTimesHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var file io.Reader
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		file = r.Body
+	} else {
+		if err := r.ParseMultipartForm(maxImportSize); err != nil {
+			app.badRequestResponse(w, r, errors.New("تعذر قراءة الملف المرفوع"))
+			return
+		}
+		upload, _, err := r.FormFile("file")
+		if err != nil {
+			app.errorResponse(w, r, http.StatusBadRequest, "ملف CSV مطلوب")
+			return
+		}
+		defer upload.Close()
+		file = upload
+	}
+
+	dryRun, err := utils.ParseBoolOrDefault(r.FormValue("dry_run"), false)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("قيمة dry_run غير صالحة"))
+		return
+	}
+
+	onConflict := r.FormValue("on_conflict")
+	if onConflict == "" {
+		onConflict = "skip"
+	}
+	if onConflict != "skip" && onConflict != "upsert" {
+		app.badRequestResponse(w, r, errors.New("on_conflict يجب أن يكون skip أو upsert"))
+		return
+	}
+
+	records, err := readImportCSV(file)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	sections, err := app.Model.SectionsDB.GetAllSections(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	sectionIDs := make(map[string]int, len(sections))
+	for _, section := range sections {
+		sectionIDs[section.Name] = section.ID
+	}
+
+	prayers, rowErrors := parseImportRows(records, sectionIDs)
+	if len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, rowErrors)
+		return
+	}
+	if len(prayers) == 0 {
+		app.errorResponse(w, r, http.StatusBadRequest, "الملف لا يحتوي على أي صفوف")
+		return
+	}
+
+	// Section editors may only import their own sections' rows
+	sectionNames := make(map[int]string, len(sectionIDs))
+	for name, id := range sectionIDs {
+		sectionNames[id] = name
+	}
+	checked := make(map[int]bool)
+	for _, prayer := range prayers {
+		if checked[prayer.SectionID] {
+			continue
+		}
+		checked[prayer.SectionID] = true
+
+		allowed, err := app.can(r, data.PermPrayerTimesWrite, prayer.SectionID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !allowed {
+			app.errorResponse(w, r, http.StatusForbidden, "ليس لديك صلاحية تعديل مواقيت القسم "+sectionNames[prayer.SectionID])
+			return
+		}
+	}
+
+	result, err := app.Model.PrayerTimesDB.ImportPrayerTimes(r.Context(), prayers, onConflict == "upsert", dryRun, authenticatedUserID(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	message := "تم استيراد مواقيت الصلاة بنجاح"
+	if dryRun {
+		message = "تم التحقق من الملف بنجاح ولم يتم حفظ أي بيانات"
+	}
+	if !dryRun {
+		imported := make([]string, 0, len(checked))
+		for id := range checked {
+			imported = append(imported, sectionNames[id])
+		}
+		sort.Strings(imported)
+		app.audit(r, data.AuditImport, data.AuditEntityPrayerTimes, "", nil, map[string]any{
+			"sections":    imported,
+			"rows":        len(prayers),
+			"on_conflict": onConflict,
+			"result":      result,
+		})
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message": message,
+		"dry_run": dryRun,
+		"rows":    len(prayers),
+		"result":  result,
+	})
+}
+
+// importRecord is one CSV row keyed by column name, with its line number.
+type importRecord struct {
+	line   int
+	fields map[string]string
+}
+
+// readImportCSV reads the uploaded file. A header row is optional; when
+// present it may list the columns in any order. Spreadsheet exports that use
+// semicolons or start with a UTF-8 BOM are accepted.
+func readImportCSV(file io.Reader) ([]importRecord, error) {
+	raw, err := io.ReadAll(file)
+	if err != nil {
+		return nil, errors.New("تعذر قراءة الملف أو أن حجمه يتجاوز الحد المسموح")
+	}
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(raw))
+	firstLine, _, _ := bytes.Cut(raw, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("ملف CSV غير صالح: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := importColumns
+	start := 0
+	if _, err := strconv.Atoi(strings.TrimSpace(rows[0][0])); err != nil {
+		columns = make([]string, len(rows[0]))
+		for i, name := range rows[0] {
+			columns[i] = strings.ToLower(strings.TrimSpace(name))
+		}
+		for _, required := range importColumns {
+			found := false
+			for _, name := range columns {
+				if name == required {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("العمود %s مفقود من رأس الملف", required)
+			}
+		}
+		start = 1
+	}
+
+	records := make([]importRecord, 0, len(rows)-start)
+	for i := start; i < len(rows); i++ {
+		if len(rows[i]) == 1 && strings.TrimSpace(rows[i][0]) == "" {
+			continue
+		}
+		fields := make(map[string]string, len(columns))
+		for j, name := range columns {
+			if j < len(rows[i]) {
+				fields[name] = strings.TrimSpace(rows[i][j])
+			}
+		}
+		records = append(records, importRecord{line: i + 1, fields: fields})
+	}
+	return records, nil
+}
+
+// parseImportRows converts and validates every record, collecting all row
+// errors rather than stopping at the first.
+func parseImportRows(records []importRecord, sectionIDs map[string]int) ([]*data.PrayerTimes, []importRowError) {
+	var prayers []*data.PrayerTimes
+	var rowErrors []importRowError
+	seen := make(map[[3]int]int, len(records))
+
+	for _, record := range records {
+		v := validator.New()
+		prayer := &data.PrayerTimes{}
+
+		prayer.Day, _ = strconv.Atoi(record.fields["day"])
+		prayer.Month, _ = strconv.Atoi(record.fields["month"])
+
+		sectionName := record.fields["section"]
+		sectionID, ok := sectionIDs[sectionName]
+		v.Check(ok, "section", fmt.Sprintf("القسم %q غير موجود", sectionName))
+		prayer.SectionID = sectionID
+
+		times := []struct {
+			field string
+			dest  *time.Time
+		}{
+			{"fajr_first_time", &prayer.FajrFirstTime},
+			{"fajr_second_time", &prayer.FajrSecondTime},
+			{"sunrise_time", &prayer.SunriseTime},
+			{"dhuhr_time", &prayer.DhuhrTime},
+			{"asr_time", &prayer.AsrTime},
+			{"maghrib_time", &prayer.MaghribTime},
+			{"isha_time", &prayer.IshaTime},
+		}
+		for _, t := range times {
+			value := record.fields[t.field]
+			parsed, err := parseImportTime(value)
+			if value != "" && err != nil {
+				v.AddError(t.field, "صيغة الوقت يجب أن تكون HH:MM")
+				continue
+			}
+			*t.dest = parsed
+		}
+
+		data.ValidatePrayerTimes(v, prayer, "day", "month", "fajr_first_time", "fajr_second_time",
+			"sunrise_time", "dhuhr_time", "asr_time", "maghrib_time", "isha_time", "section_id")
+
+		if v.Valid() {
+			key := [3]int{prayer.Day, prayer.Month, prayer.SectionID}
+			if line, dup := seen[key]; dup {
+				v.AddError("day", fmt.Sprintf("مكرر مع الصف %d", line))
+			}
+			seen[key] = record.line
+		}
+
+		if !v.Valid() {
+			rowErrors = append(rowErrors, importRowError{Row: record.line, Errors: v.Errors})
+			continue
+		}
+		prayers = append(prayers, prayer)
+	}
+
+	return prayers, rowErrors
+}
+
+// parseImportTime accepts HH:MM as well as the HH:MM:SS that spreadsheets
+// tend to emit.
+func parseImportTime(value string) (time.Time, error) {
+	if t, err := parseTime(value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("15:04:05", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(0, 1, 1, t.Hour(), t.Minute(), 0, 0, time.UTC), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/data"
+	"project/utils"
+	"project/utils/validator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShiftPrayerTimesHandler handles POST requests that move chosen prayers of
+// a section by a signed number of minutes over a range of days, for
+// corrections announced by an authority. Form values:
+//   - section: id or name
+//   - prayers: comma separated, any of fajr_first, fajr_second, sunrise,
+//     dhuhr, asr, maghrib, isha
+//   - minutes: signed, e.g. 2 or -1
+//   - from, to: MM-DD, inclusive; to before from wraps over the new year
+//   - dry_run=true returns the affected days without saving
+func (app *application) ShiftPrayerTimesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	sectionValue := r.FormValue("section")
+	if sectionValue == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "القسم مطلوب")
+		return
+	}
+	sectionID, err := app.sectionIDFromValue(r.Context(), sectionValue)
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	shift := &data.PrayerTimesShift{SectionID: sectionID}
+	for _, prayer := range strings.Split(r.FormValue("prayers"), ",") {
+		if prayer = strings.TrimSpace(prayer); prayer != "" {
+			shift.Prayers = append(shift.Prayers, prayer)
+		}
+	}
+
+	if value := r.FormValue("minutes"); value != "" {
+		shift.Minutes, err = strconv.Atoi(value)
+		v.Check(err == nil, "minutes", "عدد الدقائق يجب أن يكون رقمًا صحيحًا")
+	}
+
+	from, err := parseMonthDay(r.FormValue("from"))
+	v.Check(err == nil, "from", "تاريخ البداية يجب أن يكون بصيغة MM-DD")
+	to, err := parseMonthDay(r.FormValue("to"))
+	v.Check(err == nil, "to", "تاريخ النهاية يجب أن يكون بصيغة MM-DD")
+	shift.FromMonth, shift.FromDay = int(from.Month()), from.Day()
+	shift.ToMonth, shift.ToDay = int(to.Month()), to.Day()
+
+	dryRun, err := utils.ParseBoolOrDefault(r.FormValue("dry_run"), false)
+	v.Check(err == nil, "dry_run", "قيمة dry_run غير صالحة")
+
+	data.ValidatePrayerTimesShift(v, shift)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	shifted, err := app.Model.PrayerTimesDB.ShiftPrayerTimes(r.Context(), shift, dryRun, authenticatedUserID(r))
+	if err != nil {
+		if errors.Is(err, data.ErrShiftOutOfOrder) {
+			app.errorResponse(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	message := "تم تعديل مواقيت الصلاة بنجاح"
+	if dryRun {
+		message = "معاينة التعديل، لم يتم حفظ أي بيانات"
+	} else if len(shifted) > 0 {
+		fromDay, toDay := from.Format("01-02"), to.Format("01-02")
+		app.audit(r, data.AuditShift, data.AuditEntityPrayerTimes, fmt.Sprintf("%d:%s..%s", sectionID, fromDay, toDay), nil, map[string]any{
+			"section_id": sectionID,
+			"prayers":    shift.Prayers,
+			"minutes":    shift.Minutes,
+			"from":       fromDay,
+			"to":         toDay,
+			"rows":       len(shifted),
+		})
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"message": message,
+		"dry_run": dryRun,
+		"rows":    len(shifted),
+		"changes": shifted,
+	})
+}
+
+// parseMonthDay reads a MM-DD day of the year.
+func parseMonthDay(value string) (time.Time, error) {
+	// Year 2000 is a leap year, so 02-29 is accepted
+	return time.Parse("2006-01-02", "2000-"+strings.TrimSpace(value))
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"project/internal/data"
+	"project/internal/hijri"
+	"project/utils"
+	"strconv"
+	"time"
+)
+
+// ramadanMonth is the Hijri month number of Ramadan.
+const ramadanMonth = 9
+
+// imsakTime returns Imsak for the given Fajr time.
+func (app *application) imsakTime(fajr time.Time) time.Time {
+	return fajr.Add(-time.Duration(app.cfg.ramadan.imsakOffset) * time.Minute)
+}
+
+// isRamadan reports whether the civil day t falls on is in Ramadan for the
+// section.
+func (app *application) isRamadan(section *data.Section, t time.Time) bool {
+	return app.hijriDate(section, t).Month == ramadanMonth
+}
+
+// withRamadanAlerts adds the suhoor reminder and Imsak to the day's alerts and
+// announces Maghrib as Iftar.
+func (app *application) withRamadanAlerts(pt data.PrayerTimes, alerts []prayerAlert) []prayerAlert {
+	imsak := app.imsakTime(pt.FajrSecondTime)
+
+	var ramadanAlerts []prayerAlert
+	if reminder := app.cfg.ramadan.suhoorReminder; reminder > 0 {
+		ramadanAlerts = append(ramadanAlerts, prayerAlert{
+			key:     data.AlertSuhoor,
+			text:    data.AlertSuhoor,
+			time:    imsak.Add(-time.Duration(reminder) * time.Minute),
+			related: imsak,
+		})
+	}
+	ramadanAlerts = append(ramadanAlerts, prayerAlert{
+		key:     data.AlertImsak,
+		text:    data.AlertImsak,
+		time:    imsak,
+		related: pt.FajrSecondTime,
+	})
+
+	for i := range alerts {
+		if alerts[i].key == data.AlertMaghrib {
+			alerts[i].text = alertIftar
+		}
+	}
+
+	return append(ramadanAlerts, alerts...)
+}
+
+// ramadanDay is one day of the Ramadan schedule.
+type ramadanDay struct {
+	Day             int            `json:"day"`
+	Date            string         `json:"date"`
+	Weekday         string         `json:"weekday"`
+	Hijri           hijri.DateInfo `json:"hijri"`
+	Imsak           string         `json:"imsak"`
+	Fajr            string         `json:"fajr"`
+	Sunrise         string         `json:"sunrise"`
+	Dhuhr           string         `json:"dhuhr"`
+	Asr             string         `json:"asr"`
+	Maghrib         string         `json:"maghrib"`
+	Isha            string         `json:"isha"`
+	FastingDuration string         `json:"fasting_duration"`
+	Source          string         `json:"source"`
+
+	imsak   time.Time
+	maghrib time.Time
+}
+
+// ramadanCountdown tells a client what comes next on a Ramadan day.
+type ramadanCountdown struct {
+	Day              int    `json:"day"`
+	Next             string `json:"next"` // "imsak" or "iftar"
+	At               string `json:"at"`
+	SecondsRemaining int64  `json:"seconds_remaining"`
+}
+
+// RamadanScheduleHandler handles GET requests for the whole Ramadan month of a
+// section: Imsak, the prayer times and the fasting duration of every day.
+// ?year= selects the Hijri year; by default the current Ramadan, or the next
+// one once it has passed. While Ramadan is under way the response also holds
+// a countdown to the next Imsak or Iftar.
+func (app *application) RamadanScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	section := app.sectionFromRequest(w, r)
+	if section == nil {
+		return
+	}
+
+	loc, err := section.Location()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	now := time.Now().In(loc)
+	cal := app.hijriCalendar()
+
+	today := app.hijriDate(section, now)
+	year := today.Year
+	if today.Month > ramadanMonth {
+		year++
+	}
+	if value := r.URL.Query().Get("year"); value != "" {
+		year, err = strconv.Atoi(value)
+		if err != nil || year < hijri.MinYear || year > hijri.MaxYear {
+			app.badRequestResponse(w, r, errors.New("السنة الهجرية غير صالحة"))
+			return
+		}
+	}
+
+	start, err := hijri.ToGregorian(hijri.Date{Year: year, Month: ramadanMonth, Day: 1}, cal, section.HijriAdjustment, loc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	length := hijri.MonthLength(year, ramadanMonth, cal)
+
+	days := make([]ramadanDay, 0, length)
+	for i := 0; i < length; i++ {
+		date := start.AddDate(0, 0, i)
+		prayer, source, err := app.prayerTimesOn(r.Context(), section, date)
+		if err != nil {
+			if errors.Is(err, data.ErrPrayerTimesNotFound) {
+				continue
+			}
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		imsak := timeOnDate(app.imsakTime(prayer.FajrSecondTime), date)
+		maghrib := timeOnDate(prayer.MaghribTime, date)
+		fasting := maghrib.Sub(imsak)
+
+		days = append(days, ramadanDay{
+			Day:             i + 1,
+			Date:            date.Format("2006-01-02"),
+			Weekday:         arabicWeekdays[date.Weekday()],
+			Hijri:           hijri.Date{Year: year, Month: ramadanMonth, Day: i + 1}.Info(),
+			Imsak:           imsak.Format("15:04"),
+			Fajr:            prayer.FajrSecondTime.Format("15:04"),
+			Sunrise:         prayer.SunriseTime.Format("15:04"),
+			Dhuhr:           prayer.DhuhrTime.Format("15:04"),
+			Asr:             prayer.AsrTime.Format("15:04"),
+			Maghrib:         maghrib.Format("15:04"),
+			Isha:            prayer.IshaTime.Format("15:04"),
+			FastingDuration: fmt.Sprintf("%02d:%02d", int(fasting.Hours()), int(fasting.Minutes())%60),
+			Source:          source,
+			imsak:           imsak,
+			maghrib:         maghrib,
+		})
+	}
+	if len(days) == 0 {
+		app.errorResponse(w, r, http.StatusNotFound, "لم يتم العثور على مواقيت صلاة لشهر رمضان")
+		return
+	}
+
+	response := utils.Envelope{
+		"section":              section.Name,
+		"year":                 year,
+		"calendar":             cal,
+		"imsak_offset_minutes": app.cfg.ramadan.imsakOffset,
+		"days":                 days,
+	}
+	if countdown := ramadanCountdownAt(days, now); countdown != nil {
+		response["countdown"] = countdown
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, response)
+}
+
+// ramadanCountdownAt finds the next Imsak or Iftar after now, or nil when now
+// is outside the schedule.
+func ramadanCountdownAt(days []ramadanDay, now time.Time) *ramadanCountdown {
+	first, last := days[0], days[len(days)-1]
+	if now.Before(first.imsak.AddDate(0, 0, -1)) || now.After(last.maghrib) {
+		return nil
+	}
+	for _, d := range days {
+		for _, next := range []struct {
+			name string
+			at   time.Time
+		}{{"imsak", d.imsak}, {"iftar", d.maghrib}} {
+			if now.Before(next.at) {
+				return &ramadanCountdown{
+					Day:              d.Day,
+					Next:             next.name,
+					At:               next.at.Format(time.RFC3339),
+					SecondsRemaining: int64(next.at.Sub(now).Seconds()),
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiterConfig configures a RateLimiter. Rate and Burst are the default
+// policy; Policies give the requests they match limits of their own.
+type RateLimiterConfig struct {
+	Skipper func(r *http.Request) bool
+	// Rate is how many requests a minute a client may keep making once
+	// its burst is spent.
+	Rate int
+	// Burst is how many requests a client may make at once.
+	Burst int
+	// ExpiresIn is how long an idle client is remembered after its
+	// bucket has refilled, and how often idle clients are looked for.
+	ExpiresIn           time.Duration
+	Policies            []RateLimitPolicy
+	IdentifierExtractor func(r *http.Request) (string, error)
+	ErrorHandler        func(w http.ResponseWriter, r *http.Request, err error)
+	DenyHandler         func(w http.ResponseWriter, r *http.Request, identifier string, err error)
+}
+
+// RateLimitPolicy limits the requests Match accepts. Each policy keeps its
+// own buckets, so requests under one do not spend the tokens of another.
+// The first policy that matches a request applies.
+type RateLimitPolicy struct {
+	Name  string
+	Rate  int
+	Burst int
+	Match func(r *http.Request) bool
+}
+
+// interval is the time it takes the policy to refill one token.
+func (p *RateLimitPolicy) interval() time.Duration {
+	return time.Minute / time.Duration(p.Rate)
+}
+
+// RateLimitExceededError is passed to DenyHandler when a request finds its
+// bucket empty.
+type RateLimitExceededError struct {
+	Policy string
+}
+
+func (e *RateLimitExceededError) Error() string {
+	return fmt.Sprintf("rate limit %q exceeded", e.Policy)
+}
+
+// RateLimiter is a token bucket limiter: every client has a bucket of Burst
+// tokens per policy that refills at Rate tokens a minute, and each request
+// spends one.
+type RateLimiter struct {
+	config   RateLimiterConfig
+	fallback RateLimitPolicy
+
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+}
+
+type bucketKey struct {
+	policy     string
+	identifier string
+}
+
+type bucket struct {
+	policy *RateLimitPolicy
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the bucket was last used.
+func (b *bucket) refill(now time.Time) {
+	earned := float64(now.Sub(b.last)) / float64(b.policy.interval())
+	b.tokens = math.Min(float64(b.policy.Burst), b.tokens+earned)
+	b.last = now
+}
+
+// NewRateLimiter returns a limiter for config and starts the goroutine that
+// forgets idle clients. It panics on a policy without a positive rate and
+// burst, as that is a programming error.
+func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
+	if config.ExpiresIn <= 0 {
+		config.ExpiresIn = time.Minute
+	}
+
+	rl := &RateLimiter{
+		config:   config,
+		fallback: RateLimitPolicy{Name: "default", Rate: config.Rate, Burst: config.Burst},
+		buckets:  make(map[bucketKey]*bucket),
+	}
+	for _, p := range append([]RateLimitPolicy{rl.fallback}, config.Policies...) {
+		if p.Rate <= 0 || p.Burst <= 0 {
+			panic(fmt.Sprintf("rate limit policy %q needs a positive rate and burst", p.Name))
+		}
+	}
+
+	go rl.janitor()
+	return rl
+}
+
+// policy returns the policy that applies to r.
+func (rl *RateLimiter) policy(r *http.Request) *RateLimitPolicy {
+	for i := range rl.config.Policies {
+		if rl.config.Policies[i].Match(r) {
+			return &rl.config.Policies[i]
+		}
+	}
+	return &rl.fallback
+}
+
+// take spends a token of the client's bucket under policy p. It reports
+// whether there was one, the tokens left, how long until the bucket is full
+// again and, when there was none, how long until the next token.
+func (rl *RateLimiter) take(p *RateLimitPolicy, identifier string, now time.Time) (allowed bool, remaining int, reset, retryAfter time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	key := bucketKey{policy: p.Name, identifier: identifier}
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{policy: p, tokens: float64(p.Burst), last: now}
+		rl.buckets[key] = b
+	}
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		allowed = true
+	} else {
+		retryAfter = time.Duration((1 - b.tokens) * float64(p.interval()))
+	}
+	remaining = int(b.tokens)
+	reset = time.Duration((float64(p.Burst) - b.tokens) * float64(p.interval()))
+
+	return allowed, remaining, reset, retryAfter
+}
+
+// janitor forgets, every ExpiresIn, the clients whose buckets have been
+// idle that long and have refilled; they would start over with a full
+// bucket anyway.
+func (rl *RateLimiter) janitor() {
+	ticker := time.NewTicker(rl.config.ExpiresIn)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		rl.mu.Lock()
+		for key, b := range rl.buckets {
+			if now.Sub(b.last) < rl.config.ExpiresIn {
+				continue
+			}
+			b.refill(now)
+			if b.tokens >= float64(b.policy.Burst) {
+				delete(rl.buckets, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// Limit rejects the requests of clients that have spent their tokens. Every
+// limited response carries the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers; a rejected one also carries Retry-After.
+func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rl.config.Skipper != nil && rl.config.Skipper(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identifier, err := rl.config.IdentifierExtractor(r)
+		if err != nil {
+			rl.config.ErrorHandler(w, r, err)
+			return
+		}
+
+		p := rl.policy(r)
+		allowed, remaining, reset, retryAfter := rl.take(p, identifier, time.Now())
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(p.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(retryAfter))))
+			rl.config.DenyHandler(w, r, identifier, &RateLimitExceededError{Policy: p.Name})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ceilSeconds rounds d up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
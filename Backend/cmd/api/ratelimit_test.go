@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(policies ...RateLimitPolicy) *RateLimiter {
+	return NewRateLimiter(RateLimiterConfig{
+		Rate:      60,
+		Burst:     3,
+		ExpiresIn: time.Hour,
+		Policies:  policies,
+		IdentifierExtractor: func(r *http.Request) (string, error) {
+			return r.RemoteAddr, nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusForbidden)
+		},
+		DenyHandler: func(w http.ResponseWriter, r *http.Request, identifier string, err error) {
+			var exceeded *RateLimitExceededError
+			if !errors.As(err, &exceeded) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("X-Policy", exceeded.Policy)
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+	})
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	rl := newTestLimiter()
+	p := &rl.fallback // 60 a minute: one token a second, three at most
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after        time.Duration
+		allowed      bool
+		remaining    int
+		reset, retry time.Duration
+	}{
+		{0, true, 2, time.Second, 0},
+		{0, true, 1, 2 * time.Second, 0},
+		{0, true, 0, 3 * time.Second, 0},
+		{0, false, 0, 3 * time.Second, time.Second},
+		// Half a token earned: still denied, half a second to wait
+		{500 * time.Millisecond, false, 0, 2500 * time.Millisecond, 500 * time.Millisecond},
+		{500 * time.Millisecond, true, 0, 3 * time.Second, 0},
+		// A long idle refills the bucket but never past Burst
+		{time.Hour, true, 2, time.Second, 0},
+	}
+
+	for i, s := range steps {
+		now = now.Add(s.after)
+		allowed, remaining, reset, retry := rl.take(p, "client", now)
+		if allowed != s.allowed || remaining != s.remaining || reset != s.reset || retry != s.retry {
+			t.Errorf("step %d: take = %v, %d, %s, %s; want %v, %d, %s, %s",
+				i, allowed, remaining, reset, retry, s.allowed, s.remaining, s.reset, s.retry)
+		}
+	}
+
+	// Other clients have buckets of their own
+	if allowed, remaining, _, _ := rl.take(p, "other", now); !allowed || remaining != 2 {
+		t.Errorf("other client: allowed %v, remaining %d; want a full bucket", allowed, remaining)
+	}
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	rl := newTestLimiter(RateLimitPolicy{
+		Name:  "strict",
+		Rate:  1,
+		Burst: 1,
+		Match: func(r *http.Request) bool { return r.URL.Path == "/login" },
+	})
+	handler := rl.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "192.0.2.1"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/login")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("first login: status %d", rec.Code)
+	}
+	for header, want := range map[string]string{"RateLimit-Limit": "1", "RateLimit-Remaining": "0", "RateLimit-Reset": "60"} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("first login: %s = %q, want %q", header, got, want)
+		}
+	}
+
+	rec = do("/login")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second login: status %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("X-Policy"); got != "strict" {
+		t.Errorf("second login: denied under %q, want strict", got)
+	}
+	if got := rec.Header().Get("RateLimit-Limit"); got != "1" {
+		t.Errorf("second login: RateLimit-Limit = %q, want the strict policy's 1", got)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" && got != "59" {
+		t.Errorf("second login: Retry-After = %q, want about 60", got)
+	}
+
+	// The default policy keeps its own bucket
+	rec = do("/other")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("other path: status %d, want 204", rec.Code)
+	}
+	if got := rec.Header().Get("RateLimit-Limit"); got != "3" {
+		t.Errorf("other path: RateLimit-Limit = %q, want 3", got)
+	}
+}
+
+func TestRateLimiterSkipper(t *testing.T) {
+	rl := newTestLimiter()
+	rl.config.Skipper = func(r *http.Request) bool { return r.URL.Path == "/healthz" }
+	handler := rl.Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("request %d: status %d, limited %v", i, rec.Code, rec.Header().Get("RateLimit-Limit") != "")
+		}
+	}
+}
+
+func TestCeilSeconds(t *testing.T) {
+	for d, want := range map[time.Duration]int{0: 0, time.Millisecond: 1, time.Second: 1, 1500 * time.Millisecond: 2} {
+		if got := ceilSeconds(d); got != want {
+			t.Errorf("ceilSeconds(%s) = %d, want %d", d, got, want)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"project/internal/data"
 	"time"
 
 	"github.com/go-michi/michi"
@@ -9,25 +11,64 @@ import (
 
 func (app *application) Router() *michi.Router {
 	r := michi.NewRouter()
+	r.Use(requestID)
+	r.Use(app.instrument)
 	r.Use(app.logRequest)
 	r.Use(app.recoverPanic)
 	r.Use(secureHeaders)
 	r.Use(app.ErrorHandlerMiddleware)
 	rateLimiter := NewRateLimiter(RateLimiterConfig{
 		Skipper: func(r *http.Request) bool {
+			// Probes must never be turned away
+			switch r.URL.Path {
+			case "/healthz", "/readyz", "/version":
+				return true
+			}
 			return false
 		},
-		Rate:      600,
-		Burst:     100,
+		Rate:      120,
+		Burst:     60,
 		ExpiresIn: 1 * time.Minute,
+		Policies: []RateLimitPolicy{
+			{
+				// Password and code guessing, mass sign-ups, and requests
+				// that send an SMS or hash a password
+				Name:  "auth",
+				Rate:  5,
+				Burst: 5,
+				Match: func(r *http.Request) bool {
+					if r.Method != http.MethodPost {
+						return false
+					}
+					switch r.URL.Path {
+					case "/login", "/signup", "/auth/forgot-password", "/auth/reset-password", "/auth/verify-phone/send", "/auth/verify-phone":
+						return true
+					}
+					return false
+				},
+			},
+			{
+				// Reads are cheap and apps poll prayer times
+				Name:  "read",
+				Rate:  600,
+				Burst: 100,
+				Match: func(r *http.Request) bool {
+					return r.Method == http.MethodGet || r.Method == http.MethodHead
+				},
+			},
+		},
 		IdentifierExtractor: func(r *http.Request) (string, error) {
-			return r.RemoteAddr, nil
+			return app.requestIP(r), nil
 		},
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
 			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		},
 		DenyHandler: func(w http.ResponseWriter, r *http.Request, identifier string, err error) {
-			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			var exceeded *RateLimitExceededError
+			if errors.As(err, &exceeded) {
+				app.metrics.rateLimitRejections.Inc(exceeded.Policy)
+			}
+			app.rateLimitExceededResponse(w, r)
 		},
 	})
 
@@ -47,63 +88,111 @@ func (app *application) Router() *michi.Router {
 		}))
 
 		// User endpoints
-		sub.HandleFunc("GET users", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.ListUsersHandler))))
-		sub.HandleFunc("GET users/{id}", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.GetUserHandler))))
+		sub.HandleFunc("GET users", app.AuthMiddleware(app.RequirePermission(data.PermUsersRead, nil)(http.HandlerFunc(app.ListUsersHandler))))
+		sub.HandleFunc("GET users/{id}", app.AuthMiddleware(app.RequirePermission(data.PermUsersRead, nil)(http.HandlerFunc(app.GetUserHandler))))
+		sub.HandleFunc("GET users/{id}/permissions", app.AuthMiddleware(app.RequirePermission(data.PermRolesManage, nil)(http.HandlerFunc(app.GetUserPermissionsHandler))))
 		sub.HandleFunc("POST login", http.HandlerFunc(app.SigninHandler))
 		sub.HandleFunc("POST signup", app.PassTokenMiddleware(app.SignupHandler))
 		sub.HandleFunc("PUT user/{id}", app.AuthMiddleware(http.HandlerFunc(app.UpdateUserHandler)))
 		sub.HandleFunc("PUT me", app.AuthMiddleware(http.HandlerFunc(app.UpdateUserHandler)))
-		sub.HandleFunc("DELETE roles/revoke", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.RevokeRoleHandler))))
+		sub.HandleFunc("GET roles", app.AuthMiddleware(app.RequirePermission(data.PermRolesManage, nil)(http.HandlerFunc(app.ListRolesHandler))))
+		sub.HandleFunc("POST roles/grant", app.AuthMiddleware(app.RequirePermission(data.PermRolesManage, nil)(http.HandlerFunc(app.GrantRoleHandler))))
+		sub.HandleFunc("DELETE roles/revoke", app.AuthMiddleware(app.RequirePermission(data.PermRolesManage, nil)(http.HandlerFunc(app.RevokeRoleHandler))))
 		sub.HandleFunc("GET roles/{id}", app.GetUserRolesHandler)
+		sub.HandleFunc("GET permissions", app.AuthMiddleware(app.RequirePermission(data.PermRolesManage, nil)(http.HandlerFunc(app.ListPermissionsHandler))))
+		sub.HandleFunc("POST permissions/grant", app.AuthMiddleware(app.RequirePermission(data.PermRolesManage, nil)(http.HandlerFunc(app.GrantPermissionHandler))))
+		sub.HandleFunc("DELETE permissions/revoke", app.AuthMiddleware(app.RequirePermission(data.PermRolesManage, nil)(http.HandlerFunc(app.RevokePermissionHandler))))
 		sub.HandleFunc("GET me", app.AuthMiddleware(http.HandlerFunc(app.MeHandler)))
 
+		// Session endpoints
+		sub.HandleFunc("POST auth/refresh", http.HandlerFunc(app.RefreshTokenHandler))                     // Public access
+		sub.HandleFunc("POST auth/logout", http.HandlerFunc(app.LogoutHandler))                            // Public access
+		sub.HandleFunc("POST auth/logout-all", app.AuthMiddleware(http.HandlerFunc(app.LogoutAllHandler))) // Authenticated
+
+		// Verification endpoints
+		sub.HandleFunc("POST auth/verify-phone/send", app.AuthMiddleware(http.HandlerFunc(app.SendPhoneVerificationHandler))) // Authenticated
+		sub.HandleFunc("POST auth/verify-phone", app.AuthMiddleware(http.HandlerFunc(app.VerifyPhoneHandler)))                // Authenticated
+		sub.HandleFunc("POST auth/forgot-password", http.HandlerFunc(app.ForgotPasswordHandler))                              // Public access
+		sub.HandleFunc("POST auth/reset-password", http.HandlerFunc(app.ResetPasswordHandler))                                // Public access
+
 		// PrayerTimes endpoints
-		sub.HandleFunc("GET prayer-times", (app.GetPrayerTimesHandler))                                                                    // Public access
-		sub.HandleFunc("GET prayer-times/list", http.HandlerFunc(app.ListPrayerTimesHandler))                                              // Public access
-		sub.HandleFunc("GET prayer-times/search", http.HandlerFunc(app.SearchPrayerTimesHandler))                                          // Public access
-		sub.HandleFunc("POST prayer-times", http.HandlerFunc(app.CreatePrayerTimesHandler))                                                // Admin only
-		sub.HandleFunc("PUT prayer-times", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.UpdatePrayerTimesHandler))))    // Admin only
-		sub.HandleFunc("DELETE prayer-times", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.DeletePrayerTimesHandler)))) // Admin only
+		sub.HandleFunc("GET prayer-times", (app.GetPrayerTimesHandler))                                                                                                                              // Public access
+		sub.HandleFunc("GET prayer-times/list", http.HandlerFunc(app.ListPrayerTimesHandler))                                                                                                        // Public access
+		sub.HandleFunc("GET prayer-times/search", http.HandlerFunc(app.SearchPrayerTimesHandler))                                                                                                    // Public access
+		sub.HandleFunc("GET prayer-times/export", http.HandlerFunc(app.ExportPrayerTimesHandler))                                                                                                    // Public access
+		sub.HandleFunc("POST prayer-times", app.AuthMiddleware(app.RequirePermission(data.PermPrayerTimesWrite, app.sectionScope)(http.HandlerFunc(app.CreatePrayerTimesHandler))))                  // Requires prayer_times:write (per section)
+		sub.HandleFunc("POST prayer-times/import", app.AuthMiddleware(app.RequirePermission(data.PermPrayerTimesWrite, anySectionScope)(http.HandlerFunc(app.ImportPrayerTimesHandler))))            // Requires prayer_times:write (per section, checked per row)
+		sub.HandleFunc("PUT prayer-times", app.AuthMiddleware(app.RequirePermission(data.PermPrayerTimesWrite, app.sectionScope)(http.HandlerFunc(app.UpdatePrayerTimesHandler))))                   // Requires prayer_times:write (per section)
+		sub.HandleFunc("DELETE prayer-times", app.AuthMiddleware(app.RequirePermission(data.PermPrayerTimesWrite, app.sectionScope)(http.HandlerFunc(app.DeletePrayerTimesHandler))))                // Requires prayer_times:write (per section)
+		sub.HandleFunc("GET prayer-times/history", app.AuthMiddleware(app.RequirePermission(data.PermPrayerTimesWrite, app.sectionScope)(http.HandlerFunc(app.PrayerTimesHistoryHandler))))          // Requires prayer_times:write (per section)
+		sub.HandleFunc("POST prayer-times/revert", app.AuthMiddleware(app.RequirePermission(data.PermPrayerTimesWrite, anySectionScope)(http.HandlerFunc(app.RevertPrayerTimesHandler))))            // Requires prayer_times:write (per section, checked against the revision)
+		sub.HandleFunc("POST prayer-times/shift", app.AuthMiddleware(app.RequirePermission(data.PermPrayerTimesWrite, app.sectionScope)(http.HandlerFunc(app.ShiftPrayerTimesHandler))))             // Requires prayer_times:write (per section)
+		sub.HandleFunc("POST prayer-times/materialize", app.AuthMiddleware(app.RequirePermission(data.PermPrayerTimesWrite, app.sectionScope)(http.HandlerFunc(app.MaterializePrayerTimesHandler)))) // Requires prayer_times:write (per section)
+
+		// Calendar endpoints
+		sub.HandleFunc("GET calendar/hijri", http.HandlerFunc(app.HijriDateHandler))      // Public access
+		sub.HandleFunc("GET calendar/events", http.HandlerFunc(app.IslamicEventsHandler)) // Public access
+
+		// Ramadan endpoints
+		sub.HandleFunc("GET ramadan/schedule", http.HandlerFunc(app.RamadanScheduleHandler)) // Public access
 
 		// Sections endpoints
-		sub.HandleFunc("GET sections", http.HandlerFunc(app.GetSectionHandler))                                                    // Public access
-		sub.HandleFunc("GET sections/list", http.HandlerFunc(app.ListSectionsHandler))                                             // Public access
-		sub.HandleFunc("POST sections", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.CreateSectionHandler))))   // Admin only
-		sub.HandleFunc("PUT sections", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.UpdateSectionHandler))))    // Admin only
-		sub.HandleFunc("DELETE sections", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.DeleteSectionHandler)))) // Admin only
+		sub.HandleFunc("GET sections", http.HandlerFunc(app.GetSectionHandler))                                                                               // Public access
+		sub.HandleFunc("GET sections/list", http.HandlerFunc(app.ListSectionsHandler))                                                                        // Public access
+		sub.HandleFunc("GET sections/nearest", http.HandlerFunc(app.NearestSectionsHandler))                                                                  // Public access
+		sub.HandleFunc("POST sections", app.AuthMiddleware(app.RequirePermission(data.PermSectionsWrite, nil)(http.HandlerFunc(app.CreateSectionHandler))))   // Requires sections:write
+		sub.HandleFunc("PUT sections", app.AuthMiddleware(app.RequirePermission(data.PermSectionsWrite, nil)(http.HandlerFunc(app.UpdateSectionHandler))))    // Requires sections:write
+		sub.HandleFunc("DELETE sections", app.AuthMiddleware(app.RequirePermission(data.PermSectionsWrite, nil)(http.HandlerFunc(app.DeleteSectionHandler)))) // Requires sections:write
 
 		// Hadiths endpoints
-		sub.HandleFunc("GET hadiths", http.HandlerFunc(app.GetHadithHandler))                                                    // Public access
-		sub.HandleFunc("GET hadiths/list", http.HandlerFunc(app.ListHadithsHandler))                                             // Public access
-		sub.HandleFunc("GET hadiths/topic", http.HandlerFunc(app.GetHadithsByTopicHandler))                                      // Public access
-		sub.HandleFunc("POST hadiths", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.CreateHadithHandler))))   // Admin only
-		sub.HandleFunc("PUT hadiths", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.UpdateHadithHandler))))    // Admin only
-		sub.HandleFunc("DELETE hadiths", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.DeleteHadithHandler)))) // Admin only
+		sub.HandleFunc("GET hadiths", http.HandlerFunc(app.GetHadithHandler))                                                                              // Public access
+		sub.HandleFunc("GET hadiths/list", http.HandlerFunc(app.ListHadithsHandler))                                                                       // Public access
+		sub.HandleFunc("GET hadiths/topic", http.HandlerFunc(app.GetHadithsByTopicHandler))                                                                // Public access
+		sub.HandleFunc("POST hadiths", app.AuthMiddleware(app.RequirePermission(data.PermHadithsWrite, nil)(http.HandlerFunc(app.CreateHadithHandler))))   // Requires hadiths:write
+		sub.HandleFunc("PUT hadiths", app.AuthMiddleware(app.RequirePermission(data.PermHadithsWrite, nil)(http.HandlerFunc(app.UpdateHadithHandler))))    // Requires hadiths:write
+		sub.HandleFunc("DELETE hadiths", app.AuthMiddleware(app.RequirePermission(data.PermHadithsWrite, nil)(http.HandlerFunc(app.DeleteHadithHandler)))) // Requires hadiths:write
 
 		// Adhkar endpoints
-		sub.HandleFunc("GET adhkar", http.HandlerFunc(app.GetAdhkarHandler))                                                    // Public access
-		sub.HandleFunc("GET adhkar/list", http.HandlerFunc(app.ListAdhkarHandler))                                              // Public access
-		sub.HandleFunc("GET adhkar/category", http.HandlerFunc(app.GetAdhkarByCategoryIDHandler))                               // Public access
-		sub.HandleFunc("POST adhkar", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.CreateAdhkarHandler))))   // Admin only
-		sub.HandleFunc("PUT adhkar", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.UpdateAdhkarHandler))))    // Admin only
-		sub.HandleFunc("DELETE adhkar", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.DeleteAdhkarHandler)))) // Admin only
+		sub.HandleFunc("GET adhkar", http.HandlerFunc(app.GetAdhkarHandler))                                                                             // Public access
+		sub.HandleFunc("GET adhkar/list", http.HandlerFunc(app.ListAdhkarHandler))                                                                       // Public access
+		sub.HandleFunc("GET adhkar/category", http.HandlerFunc(app.GetAdhkarByCategoryIDHandler))                                                        // Public access
+		sub.HandleFunc("POST adhkar", app.AuthMiddleware(app.RequirePermission(data.PermAdhkarWrite, nil)(http.HandlerFunc(app.CreateAdhkarHandler))))   // Requires adhkar:write
+		sub.HandleFunc("PUT adhkar", app.AuthMiddleware(app.RequirePermission(data.PermAdhkarWrite, nil)(http.HandlerFunc(app.UpdateAdhkarHandler))))    // Requires adhkar:write
+		sub.HandleFunc("DELETE adhkar", app.AuthMiddleware(app.RequirePermission(data.PermAdhkarWrite, nil)(http.HandlerFunc(app.DeleteAdhkarHandler)))) // Requires adhkar:write
 
 		// Adhkar Categories endpoints
-		sub.HandleFunc("GET adhkar-categories", http.HandlerFunc(app.GetAdhkarCategoryHandler))                                                    // Public access
-		sub.HandleFunc("GET adhkar-categories/list", http.HandlerFunc(app.ListAdhkarCategoriesHandler))                                            // Public access
-		sub.HandleFunc("POST adhkar-categories", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.CreateAdhkarCategoryHandler))))   // Admin only
-		sub.HandleFunc("PUT adhkar-categories", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.UpdateAdhkarCategoryHandler))))    // Admin only
-		sub.HandleFunc("DELETE adhkar-categories", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.DeleteAdhkarCategoryHandler)))) // Admin only
+		sub.HandleFunc("GET adhkar-categories", http.HandlerFunc(app.GetAdhkarCategoryHandler))                                                                             // Public access
+		sub.HandleFunc("GET adhkar-categories/list", http.HandlerFunc(app.ListAdhkarCategoriesHandler))                                                                     // Public access
+		sub.HandleFunc("POST adhkar-categories", app.AuthMiddleware(app.RequirePermission(data.PermAdhkarWrite, nil)(http.HandlerFunc(app.CreateAdhkarCategoryHandler))))   // Requires adhkar:write
+		sub.HandleFunc("PUT adhkar-categories", app.AuthMiddleware(app.RequirePermission(data.PermAdhkarWrite, nil)(http.HandlerFunc(app.UpdateAdhkarCategoryHandler))))    // Requires adhkar:write
+		sub.HandleFunc("DELETE adhkar-categories", app.AuthMiddleware(app.RequirePermission(data.PermAdhkarWrite, nil)(http.HandlerFunc(app.DeleteAdhkarCategoryHandler)))) // Requires adhkar:write
 
 		// Special Topics endpoints
-		sub.HandleFunc("GET special-topics", http.HandlerFunc(app.GetSpecialTopicANUARYHandler))                                              // Public access
-		sub.HandleFunc("GET special-topics/list", http.HandlerFunc(app.ListSpecialTopicsHandler))                                             // Public access
-		sub.HandleFunc("GET special-topics/topic", http.HandlerFunc(app.GetSpecialTopicsByTopicHandler))                                      // Public access
-		sub.HandleFunc("POST special-topics", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.CreateSpecialTopicHandler))))   // Admin only
-		sub.HandleFunc("PUT special-topics", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.UpdateSpecialTopicHandler))))    // Admin only
-		sub.HandleFunc("DELETE special-topics", app.AuthMiddleware(app.AdminOnlyMiddleware(http.HandlerFunc(app.DeleteSpecialTopicHandler)))) // Admin only
-
-		sub.HandleFunc("POST subscribe", http.HandlerFunc(app.SubscribeToNotificationsHandler))
+		sub.HandleFunc("GET special-topics", http.HandlerFunc(app.GetSpecialTopicHandler))                                                                                    // Public access
+		sub.HandleFunc("GET special-topics/list", http.HandlerFunc(app.ListSpecialTopicsHandler))                                                                             // Public access
+		sub.HandleFunc("GET special-topics/topic", http.HandlerFunc(app.GetSpecialTopicsByTopicHandler))                                                                      // Public access
+		sub.HandleFunc("POST special-topics", app.AuthMiddleware(app.RequirePermission(data.PermSpecialTopicsWrite, nil)(http.HandlerFunc(app.CreateSpecialTopicHandler))))   // Requires special_topics:write
+		sub.HandleFunc("PUT special-topics", app.AuthMiddleware(app.RequirePermission(data.PermSpecialTopicsWrite, nil)(http.HandlerFunc(app.UpdateSpecialTopicHandler))))    // Requires special_topics:write
+		sub.HandleFunc("DELETE special-topics", app.AuthMiddleware(app.RequirePermission(data.PermSpecialTopicsWrite, nil)(http.HandlerFunc(app.DeleteSpecialTopicHandler)))) // Requires special_topics:write
+
+		// Scheduler endpoints
+		sub.HandleFunc("GET scheduler/health", http.HandlerFunc(app.SchedulerHealthHandler)) // Public access
+
+		// Monitoring endpoints
+		sub.HandleFunc("GET healthz", http.HandlerFunc(app.HealthzHandler)) // Public access, not rate limited
+		sub.HandleFunc("GET readyz", http.HandlerFunc(app.ReadyzHandler))   // Public access, not rate limited
+		sub.HandleFunc("GET version", http.HandlerFunc(app.VersionHandler)) // Public access, not rate limited
+
+		// Notification endpoints
+		sub.HandleFunc("POST subscribe", app.PassTokenMiddleware(app.SubscribeToNotificationsHandler))                                                                             // Public access
+		sub.HandleFunc("GET subscribe", http.HandlerFunc(app.GetNotificationSubscriptionHandler))                                                                                  // Public access
+		sub.HandleFunc("DELETE subscribe", http.HandlerFunc(app.UnsubscribeFromNotificationsHandler))                                                                              // Public access
+		sub.HandleFunc("GET me/subscriptions", app.AuthMiddleware(http.HandlerFunc(app.ListMySubscriptionsHandler)))                                                               // Authenticated
+		sub.HandleFunc("GET notifications/config", http.HandlerFunc(app.NotificationConfigHandler))                                                                                // Public access
+		sub.HandleFunc("GET admin/notifications", app.AuthMiddleware(app.RequirePermission(data.PermNotificationsRead, nil)(http.HandlerFunc(app.ListNotificationOutboxHandler)))) // Requires notifications:read
+
+		// Audit endpoints
+		sub.HandleFunc("GET admin/audit", app.AuthMiddleware(app.RequirePermission(data.PermAuditRead, nil)(http.HandlerFunc(app.ListAuditLogHandler)))) // Requires audit:read
 	})
 
 	return r
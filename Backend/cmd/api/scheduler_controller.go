@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"project/internal/leader"
+	"project/utils"
+)
+
+// SchedulerHealthHandler handles GET requests for the state of the
+// prayer-time scheduler: which instance answered, whether it is the
+// scheduler, and which instance currently holds the scheduler lock. It
+// responds 503 when no live instance is running the scheduler.
+func (app *application) SchedulerHealthHandler(w http.ResponseWriter, r *http.Request) {
+	response := utils.Envelope{
+		"instance":     app.scheduler.InstanceID(),
+		"is_scheduler": app.scheduler.IsLeader(),
+	}
+
+	current, err := app.scheduler.Current(r.Context())
+	if err != nil && !errors.Is(err, leader.ErrNoLeader) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	response["scheduler"] = current
+
+	status := http.StatusOK
+	if current == nil || !current.Alive {
+		status = http.StatusServiceUnavailable
+	}
+	utils.SendJSONResponse(w, status, response)
+}
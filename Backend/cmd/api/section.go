@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"net/url"
 	"project/internal/data"
 	"project/utils"
 	"project/utils/validator"
 	"strconv"
+	"strings"
 )
 
 // CreateSectionHandler handles POST requests to create a new section
@@ -20,19 +23,30 @@ func (app *application) CreateSectionHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	section := &data.Section{
+		Name:              name,
+		CalculationMethod: data.DefaultCalculationMethod,
+		AsrMethod:         data.DefaultAsrMethod,
+		Timezone:          data.DefaultSectionTimezone,
+	}
+	if err := readSectionForm(r, section); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	// Validate input
-	v.Check(len(name) <= 50, "name", "اسم القسم يجب ألا يتجاوز 50 حرفًا")
+	data.ValidateSection(v, section)
+	if err := app.checkSectionParent(r.Context(), v, section); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	section := &data.Section{
-		Name: name,
-	}
-
 	// Insert the section
-	err := app.Model.SectionsDB.InsertSection(section)
+	err := app.Model.SectionsDB.InsertSection(r.Context(), section)
 	if err != nil {
 		if errors.Is(err, data.ErrSectionAlreadyExists) {
 			app.errorResponse(w, r, http.StatusConflict, "القسم موجود بالفعل")
@@ -41,6 +55,7 @@ func (app *application) CreateSectionHandler(w http.ResponseWriter, r *http.Requ
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, data.AuditEntitySection, section.ID, nil, section)
 
 	// Send response
 	utils.SendJSONResponse(w, http.StatusCreated, utils.Envelope{
@@ -63,7 +78,7 @@ func (app *application) GetSectionHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	section, err := app.Model.SectionsDB.GetSectionByID(id)
+	section, err := app.Model.SectionsDB.GetSectionByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrSectionNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "القسم غير موجود")
@@ -78,16 +93,15 @@ func (app *application) GetSectionHandler(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// UpdateSectionHandler handles PUT requests to update a section’s name
+// UpdateSectionHandler handles PUT requests to update a section. Fields that
+// are not submitted keep their current values.
 func (app *application) UpdateSectionHandler(w http.ResponseWriter, r *http.Request) {
 	v := validator.New()
 
 	// Parse form data
 	idStr := r.FormValue("id")
-	name := r.FormValue("name")
-
-	if idStr == "" || name == "" {
-		app.errorResponse(w, r, http.StatusBadRequest, "معرف القسم واسم القسم مطلوبان")
+	if idStr == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "معرف القسم مطلوب")
 		return
 	}
 
@@ -97,20 +111,35 @@ func (app *application) UpdateSectionHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	section, err := app.Model.SectionsDB.GetSectionByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "القسم غير موجود")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	before := *section
+	if err := readSectionForm(r, section); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	// Validate input
-	v.Check(len(name) <= 50, "name", "اسم القسم يجب ألا يتجاوز 50 حرفًا")
+	data.ValidateSection(v, section)
+	if err := app.checkSectionParent(r.Context(), v, section); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	section := &data.Section{
-		ID:   id,
-		Name: name,
-	}
-
 	// Update the section
-	err = app.Model.SectionsDB.UpdateSection(section)
+	err = app.Model.SectionsDB.UpdateSection(r.Context(), section)
 	if err != nil {
 		if errors.Is(err, data.ErrSectionAlreadyExists) {
 			app.errorResponse(w, r, http.StatusConflict, "القسم موجود بالفعل")
@@ -123,6 +152,7 @@ func (app *application) UpdateSectionHandler(w http.ResponseWriter, r *http.Requ
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditUpdate, data.AuditEntitySection, section.ID, &before, section)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message": "تم تحديث القسم بنجاح",
@@ -144,12 +174,18 @@ func (app *application) DeleteSectionHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.Model.SectionsDB.DeleteSection(id)
+	before, _ := app.Model.SectionsDB.GetSectionByID(r.Context(), id)
+
+	err = app.Model.SectionsDB.DeleteSection(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrSectionNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "القسم غير موجود")
 			return
 		}
+		if errors.Is(err, data.ErrSectionHasDerived) {
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+			return
+		}
 		if err.Error() == "لا يمكن حذف القسم لأنه يحتوي على مواقيت صلاة مرتبطة" {
 			app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 			return
@@ -157,6 +193,7 @@ func (app *application) DeleteSectionHandler(w http.ResponseWriter, r *http.Requ
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditDelete, data.AuditEntitySection, id, before, nil)
 
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
 		"message": "تم حذف القسم بنجاح",
@@ -167,7 +204,7 @@ func (app *application) DeleteSectionHandler(w http.ResponseWriter, r *http.Requ
 func (app *application) ListSectionsHandler(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
-	sections, meta, err := app.Model.SectionsDB.ListSections(queryParams)
+	sections, meta, err := app.Model.SectionsDB.ListSections(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -178,3 +215,176 @@ func (app *application) ListSectionsHandler(w http.ResponseWriter, r *http.Reque
 		"meta":     meta,
 	})
 }
+
+// NearestSectionsHandler handles GET requests to find the sections closest to
+// a GPS position
+func (app *application) NearestSectionsHandler(w http.ResponseWriter, r *http.Request) {
+	lat, lng, ok, err := parseCoordinates(r.URL.Query())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.errorResponse(w, r, http.StatusBadRequest, "خط العرض وخط الطول مطلوبان")
+		return
+	}
+
+	limit := 1
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > 10 {
+			app.badRequestResponse(w, r, errors.New("عدد النتائج يجب أن يكون بين 1 و10"))
+			return
+		}
+	}
+
+	sections, err := app.Model.SectionsDB.GetNearestSections(r.Context(), lat, lng, limit)
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "لا توجد أقسام ذات إحداثيات")
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+		"sections": sections,
+	})
+}
+
+// parseCoordinates reads the lat/lng query parameters. ok is false when
+// neither is present.
+func parseCoordinates(query url.Values) (lat, lng float64, ok bool, err error) {
+	latStr, lngStr := query.Get("lat"), query.Get("lng")
+	if latStr == "" && lngStr == "" {
+		return 0, 0, false, nil
+	}
+	if latStr == "" || lngStr == "" {
+		return 0, 0, false, errors.New("يجب إدخال خط العرض وخط الطول معًا")
+	}
+
+	lat, err = strconv.ParseFloat(latStr, 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false, errors.New("خط العرض يجب أن يكون رقمًا بين -90 و90")
+	}
+	lng, err = strconv.ParseFloat(lngStr, 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return 0, 0, false, errors.New("خط الطول يجب أن يكون رقمًا بين -180 و180")
+	}
+
+	return lat, lng, true, nil
+}
+
+// readSectionForm copies the submitted section fields onto section, leaving
+// fields that were not submitted untouched.
+func readSectionForm(r *http.Request, section *data.Section) error {
+	if name := r.FormValue("name"); name != "" {
+		section.Name = name
+	}
+
+	if value := r.FormValue("latitude"); value != "" {
+		lat, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("خط العرض يجب أن يكون رقمًا")
+		}
+		section.Latitude = &lat
+	}
+	if value := r.FormValue("longitude"); value != "" {
+		lng, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("خط الطول يجب أن يكون رقمًا")
+		}
+		section.Longitude = &lng
+	}
+	if value := r.FormValue("elevation"); value != "" {
+		elevation, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("الارتفاع يجب أن يكون رقمًا")
+		}
+		section.Elevation = elevation
+	}
+
+	if value := r.FormValue("calculation_method"); value != "" {
+		section.CalculationMethod = strings.ToLower(value)
+	}
+	if value := r.FormValue("asr_method"); value != "" {
+		section.AsrMethod = strings.ToLower(value)
+	}
+	if value := r.FormValue("timezone"); value != "" {
+		section.Timezone = value
+	}
+	if value := r.FormValue("hijri_adjustment"); value != "" {
+		adjustment, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("تعديل التاريخ الهجري يجب أن يكون رقمًا صحيحًا")
+		}
+		section.HijriAdjustment = adjustment
+	}
+
+	// parent_section_id=0 makes the section stand on its own again
+	if value := r.FormValue("parent_section_id"); value != "" {
+		parentID, err := strconv.Atoi(value)
+		if err != nil || parentID < 0 {
+			return errors.New("معرف القسم المرجعي يجب أن يكون رقمًا صحيحًا")
+		}
+		section.ParentSectionID = nil
+		if parentID > 0 {
+			section.ParentSectionID = &parentID
+		}
+	}
+
+	// offset_<prayer> sets a derived section's difference from its parent;
+	// the map is copied so the caller's copy of the section is left alone
+	offsets := make(data.PrayerOffsets, len(section.PrayerOffsets))
+	for prayer, minutes := range section.PrayerOffsets {
+		offsets[prayer] = minutes
+	}
+	for prayer := range data.PrayerColumns {
+		value := r.FormValue("offset_" + prayer)
+		if value == "" {
+			continue
+		}
+		minutes, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("فرق التوقيت يجب أن يكون رقمًا صحيحًا")
+		}
+		if minutes == 0 {
+			delete(offsets, prayer)
+		} else {
+			offsets[prayer] = minutes
+		}
+	}
+	section.PrayerOffsets = offsets
+
+	return nil
+}
+
+// checkSectionParent validates the section's parent: it must exist and
+// follow no other section, and a section others follow cannot take a
+// parent itself.
+func (app *application) checkSectionParent(ctx context.Context, v *validator.Validator, section *data.Section) error {
+	if section.ParentSectionID == nil {
+		return nil
+	}
+
+	parent, err := app.Model.SectionsDB.GetSectionByID(ctx, *section.ParentSectionID)
+	if err != nil {
+		if errors.Is(err, data.ErrSectionNotFound) {
+			v.AddError("parent_section", "القسم المرجعي غير موجود")
+			return nil
+		}
+		return err
+	}
+	v.Check(parent.ParentSectionID == nil, "parent_section", "القسم المرجعي يتبع قسمًا آخر")
+
+	if section.ID > 0 {
+		derived, err := app.Model.SectionsDB.HasDerivedSections(ctx, section.ID)
+		if err != nil {
+			return err
+		}
+		v.Check(!derived, "parent_section", "لا يمكن ربط قسم تتبعه أقسام أخرى بقسم مرجعي")
+	}
+
+	return nil
+}
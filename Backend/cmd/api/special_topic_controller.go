@@ -33,7 +33,7 @@ func (app *application) CreateSpecialTopicHandler(w http.ResponseWriter, r *http
 	}
 
 	// Insert the special topic
-	err := app.Model.SpecialTopicDB.InsertSpecialTopic(specialTopic)
+	err := app.Model.SpecialTopicDB.InsertSpecialTopic(r.Context(), specialTopic)
 	if err != nil {
 		if errors.Is(err, data.ErrSpecialTopicAlreadyExists) {
 			app.errorResponse(w, r, http.StatusConflict, "الموضوع موجود بالفعل")
@@ -42,6 +42,7 @@ func (app *application) CreateSpecialTopicHandler(w http.ResponseWriter, r *http
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditCreate, data.AuditEntitySpecialTopic, specialTopic.ID, nil, specialTopic)
 
 	// Send response
 	utils.SendJSONResponse(w, http.StatusCreated, utils.Envelope{
@@ -66,7 +67,7 @@ func (app *application) GetSpecialTopicHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	// Get the special topic
-	specialTopic, err := app.Model.SpecialTopicDB.GetSpecialTopicByID(id)
+	specialTopic, err := app.Model.SpecialTopicDB.GetSpecialTopicByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrSpecialTopicNotFound) {
 			app.notFoundResponse(w, r, err)
@@ -118,8 +119,10 @@ func (app *application) UpdateSpecialTopicHandler(w http.ResponseWriter, r *http
 		Content: content,
 	}
 
+	before, _ := app.Model.SpecialTopicDB.GetSpecialTopicByID(r.Context(), id)
+
 	// Update the special topic
-	err = app.Model.SpecialTopicDB.UpdateSpecialTopic(specialTopic)
+	err = app.Model.SpecialTopicDB.UpdateSpecialTopic(r.Context(), specialTopic)
 	if err != nil {
 		if errors.Is(err, data.ErrSpecialTopicNotFound) {
 			app.notFoundResponse(w, r, err)
@@ -128,6 +131,7 @@ func (app *application) UpdateSpecialTopicHandler(w http.ResponseWriter, r *http
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.audit(r, data.AuditUpdate, data.AuditEntitySpecialTopic, id, before, specialTopic)
 
 	// Send response
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
@@ -142,7 +146,7 @@ func (app *application) ListSpecialTopicsHandler(w http.ResponseWriter, r *http.
 	queryParams := r.URL.Query()
 
 	// List the special topics
-	specialTopics, meta, err := app.Model.SpecialTopicDB.ListSpecialTopics(queryParams)
+	specialTopics, meta, err := app.Model.SpecialTopicDB.ListSpecialTopics(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -168,7 +172,7 @@ func (app *application) GetSpecialTopicsByTopicHandler(w http.ResponseWriter, r
 	queryParams := r.URL.Query()
 
 	// Get the special topics by topic keyword
-	specialTopics, meta, err := app.Model.SpecialTopicDB.GetSpecialTopicsByTopic(topicKeyword, queryParams)
+	specialTopics, meta, err := app.Model.SpecialTopicDB.GetSpecialTopicsByTopic(r.Context(), topicKeyword, queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -196,8 +200,10 @@ func (app *application) DeleteSpecialTopicHandler(w http.ResponseWriter, r *http
 		return
 	}
 
+	before, _ := app.Model.SpecialTopicDB.GetSpecialTopicByID(r.Context(), id)
+
 	// Delete the special topic
-	err = app.Model.SpecialTopicDB.DeleteSpecialTopic(id)
+	err = app.Model.SpecialTopicDB.DeleteSpecialTopic(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, data.ErrSpecialTopicNotFound) {
 			app.notFoundResponse(w, r, err)
@@ -206,6 +212,7 @@ func (app *application) DeleteSpecialTopicHandler(w http.ResponseWriter, r *http
 		app.serverErrorResponse(w, r, fmt.Errorf("حدث خطأ أثناء حذف الموضوع: %w", err))
 		return
 	}
+	app.audit(r, data.AuditDelete, data.AuditEntitySpecialTopic, id, before, nil)
 
 	// Send response
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
@@ -11,6 +11,10 @@ import (
 	"github.com/google/uuid"
 )
 
+// SigninHandler handles POST requests that sign a user in with their phone
+// number and password. An unknown number and a wrong password get the same
+// answer, and repeated failures lock the number and the client address for
+// a while.
 func (app *application) SigninHandler(w http.ResponseWriter, r *http.Request) {
 	phoneNumber := strings.TrimSpace(r.FormValue("phone_number"))
 	password := r.FormValue("password")
@@ -19,45 +23,54 @@ func (app *application) SigninHandler(w http.ResponseWriter, r *http.Request) {
 		app.errorResponse(w, r, http.StatusBadRequest, "يجب إدخال رقم الهاتف وكلمة المرور")
 		return
 	}
-	user, err := app.Model.UserDB.GetUserByPhoneNumber(phoneNumber)
+
+	lockedUntil, err := app.Model.LoginFailureDB.LockedUntil(r.Context(),
+		data.LoginFailureKeyPhone(phoneNumber), data.LoginFailureKeyIP(app.requestIP(r)))
 	if err != nil {
-		app.handleRetrievalError(w, r, err)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		app.loginLockedResponse(w, r, lockedUntil)
 		return
 	}
 
-	// ── NEW: load roles ─────────────────────────────────────────────
-	roles, err := app.Model.UserRoleDB.GetRolesByUserID(user.ID)
-	if err != nil {
+	var matched bool
+	user, err := app.Model.UserDB.GetUserByPhoneNumber(r.Context(), phoneNumber)
+	switch {
+	case err == nil:
+		matched = utils.CheckPassword(user.Password, password)
+	case errors.Is(err, data.ErrUserNotFound):
+		matched = utils.CheckAbsentPassword(password)
+	default:
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	user.Roles = roles
-	// ────────────────────────────────────────────────────────────────
-
-	if !utils.CheckPassword(user.Password, password) {
+	if !matched {
+		app.recordLoginFailure(r, phoneNumber)
 		app.errorResponse(w, r, http.StatusUnauthorized, "رقم الهاتف أو كلمة المرور غير صحيحة")
 		return
 	}
 
-	// Get actual role names for the token
-	roleNames := make([]string, len(user.Roles))
-	for i, role := range user.Roles {
-		roleNames[i] = role.Name
+	if err := app.Model.LoginFailureDB.ClearFailures(r.Context(), data.LoginFailureKeyPhone(phoneNumber)); err != nil {
+		app.logError(r, err)
 	}
 
-	token, err := utils.GenerateToken(user.ID.String(), roleNames)
+	roles, err := app.Model.UserRoleDB.GetRolesByUserID(r.Context(), user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	user.Roles = roles
 
-	utils.SetTokenCookie(w, token)
+	response, err := app.startSession(w, r, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	response["user"] = user
 
-	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
-		"expires": "24 ساعة",
-		"token":   token,
-		"user":    user,
-	})
+	utils.SendJSONResponse(w, http.StatusOK, response)
 }
 
 func (app *application) GetUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -68,7 +81,7 @@ func (app *application) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.Model.UserDB.GetUser(id)
+	user, err := app.Model.UserDB.GetUser(r.Context(), id)
 	if err != nil {
 		app.handleRetrievalError(w, r, err)
 		return
@@ -79,7 +92,7 @@ func (app *application) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 func (app *application) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
 
-	users, meta, err := app.Model.UserDB.ListUsers(queryParams)
+	users, meta, err := app.Model.UserDB.ListUsers(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -119,7 +132,7 @@ func (app *application) SignupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Store the user in the database
-	if err := app.Model.UserDB.InsertUser(user); err != nil {
+	if err := app.Model.UserDB.InsertUser(r.Context(), user); err != nil {
 		if errors.Is(err, data.ErrPhoneAlreadyInserted) {
 			app.errorResponse(w, r, http.StatusConflict, "رقم الهاتف مسجل مسبقاً")
 			return
@@ -127,22 +140,32 @@ func (app *application) SignupHandler(w http.ResponseWriter, r *http.Request) {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	err = app.Model.UserRoleDB.GrantRole(user.ID, 1)
+	err = app.Model.UserRoleDB.GrantRole(r.Context(), user.ID, data.RoleUser)
 	if err != nil {
 		app.handleRetrievalError(w, r, err)
 		return
 	}
 
 	// Fetch roles and assign to user
-	roles, err := app.Model.UserRoleDB.GetRolesByUserID(user.ID)
+	roles, err := app.Model.UserRoleDB.GetRolesByUserID(r.Context(), user.ID)
 	if err != nil {
 		app.handleRetrievalError(w, r, err)
 		return
 	}
 	user.Roles = roles
 
+	// The number is verified with POST auth/verify-phone; a failed send can be
+	// retried from auth/verify-phone/send.
+	message := "تم التسجيل بنجاح"
+	if app.sms != nil {
+		if _, err := app.sendOTP(r.Context(), user.PhoneNumber, data.OTPPurposeVerifyPhone); err != nil {
+			app.logError(r, err)
+		}
+		message = "تم التسجيل بنجاح، تم إرسال رمز التحقق إلى رقم هاتفك"
+	}
+
 	utils.SendJSONResponse(w, http.StatusCreated, utils.Envelope{
-		"message": "تم التسجيل بنجاح",
+		"message": message,
 		"user":    user,
 	})
 }
@@ -155,7 +178,7 @@ func (app *application) MeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := app.Model.UserDB.GetUser(userID)
+	user, err := app.Model.UserDB.GetUser(r.Context(), userID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -187,17 +210,17 @@ func (app *application) UpdateUserHandler(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		// Check if the authenticated user is an admin (or updating their own account)
+		// Check if the authenticated user may edit other accounts (or is updating their own)
 		targetID, err := uuid.Parse(idStr)
 		if err != nil {
 			app.badRequestResponse(w, r, errors.New("معرف المستخدم المستهدف غير صالح"))
 			return
 		}
 
-		// If not updating their own account, check admin status
+		// If not updating their own account, check the users:write permission
 		if targetID != authUserID {
-			isAdmin, err := app.Model.UserRoleDB.HasRole(authUserID, 1) // Assuming role ID 1 is admin
-			if err != nil || !isAdmin {
+			allowed, err := app.can(r, data.PermUsersWrite, 0)
+			if err != nil || !allowed {
 				app.errorResponse(w, r, http.StatusForbidden, "غير مصرح لك بتعديل بيانات مستخدم آخر")
 				return
 			}
@@ -220,7 +243,7 @@ func (app *application) UpdateUserHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get current user data
-	currentUser, err := app.Model.UserDB.GetUser(userID)
+	currentUser, err := app.Model.UserDB.GetUser(r.Context(), userID)
 	if err != nil {
 		app.handleRetrievalError(w, r, err)
 		return
@@ -281,7 +304,7 @@ func (app *application) UpdateUserHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	// Update the user in the database
-	if err := app.Model.UserDB.UpdateUser(user); err != nil {
+	if err := app.Model.UserDB.UpdateUser(r.Context(), user); err != nil {
 		if errors.Is(err, data.ErrUserNotFound) {
 			app.errorResponse(w, r, http.StatusNotFound, "المستخدم غير موجود")
 			return
@@ -294,25 +317,36 @@ func (app *application) UpdateUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Generate a new token with updated user information
-	roleNames := make([]string, len(user.Roles))
-	for i, role := range user.Roles {
-		roleNames[i] = role.Name
+	// A new password signs the user out of every device
+	if r.FormValue("password") != "" {
+		if err := app.endAllSessions(r.Context(), userID); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 	}
 
-	token, err := utils.GenerateToken(user.ID.String(), roleNames)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+	// Changes made to someone else's account are audited
+	if callerID, _ := r.Context().Value(UserIDKey).(string); callerID != userID.String() {
+		after, _ := app.Model.UserDB.GetUser(r.Context(), userID)
+		app.audit(r, data.AuditUpdate, data.AuditEntityUser, userID, currentUser, after)
 	}
 
-	// Set the new token as a cookie
-	utils.SetTokenCookie(w, token)
-
-	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{
+	response := utils.Envelope{
 		"message": "تم تحديث بيانات المستخدم بنجاح",
 		"user":    user,
-		"token":   token,
-		"expires": "24 ساعة",
-	})
+	}
+
+	// Users updating themselves get fresh tokens on this device
+	if callerID, _ := r.Context().Value(UserIDKey).(string); callerID == userID.String() {
+		session, err := app.startSession(w, r, userID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for key, value := range session {
+			response[key] = value
+		}
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, response)
 }
@@ -3,38 +3,56 @@ package main
 import (
 	"errors"
 	"net/http"
+	"project/internal/data"
 	"project/utils"
 	"strconv"
 
 	"github.com/google/uuid"
 )
 
+// GrantRoleHandler grants a role to a user. The user's next token refresh
+// picks up the new role.
 func (app *application) GrantRoleHandler(w http.ResponseWriter, r *http.Request) {
-	user_id, _ := r.Context().Value(UserIDKey).(string)
-
-	user, err := app.Model.UserDB.GetUser(uuid.MustParse(user_id))
+	userID, err := uuid.Parse(r.FormValue("user_id"))
 	if err != nil {
-		app.handleRetrievalError(w, r, err)
+		app.badRequestResponse(w, r, errors.New("invalid user ID"))
 		return
 	}
-	roleIDStr := r.FormValue("role_id")
 
-	roleID, err := strconv.Atoi(roleIDStr)
+	roleID, err := strconv.Atoi(r.FormValue("role_id"))
 	if err != nil {
 		app.badRequestResponse(w, r, errors.New("invalid role ID"))
 		return
 	}
 
 	// Grant the new role
-	err = app.Model.UserRoleDB.GrantRole(user.ID, roleID)
+	err = app.Model.UserRoleDB.GrantRole(r.Context(), userID, roleID)
 	if err != nil {
+		if errors.Is(err, data.ErrRoleNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, err.Error())
+			return
+		}
 		app.handleRetrievalError(w, r, err)
 		return
 	}
 
+	app.permissions.invalidate(userID)
+	app.audit(r, data.AuditGrant, data.AuditEntityUserRole, userID, nil, map[string]any{"user_id": userID, "role_id": roleID})
+
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{"message": "تم اعطاء الصلاحية بنجاح"})
 }
 
+// ListRolesHandler lists the roles that can be granted
+func (app *application) ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.Model.UserRoleDB.ListRoles(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{"roles": roles})
+}
+
 //if u want the granting by email :D
 /*
 
@@ -42,7 +60,7 @@ func (app *application) GrantRoleHandler(w http.ResponseWriter, r *http.Request)
 	email := r.FormValue("email")
 	roleIDStr := r.FormValue("role_id")
 
-	user, err := app.Model.UserDB.GetUserByEmail(email)
+	user, err := app.Model.UserDB.GetUserByEmail(r.Context(), email)
 	if err != nil {
 		app.errorResponse(w, r, http.StatusBadRequest, "Invalid student email")
 		return
@@ -56,7 +74,7 @@ func (app *application) GrantRoleHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	roles, err := app.Model.UserRoleDB.GetUserRoles(userID)
+	roles, err := app.Model.UserRoleDB.GetUserRoles(r.Context(), userID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -72,14 +90,14 @@ func (app *application) GrantRoleHandler(w http.ResponseWriter, r *http.Request)
 
 	// If the user has role 'student' and is trying to grant role 'admin' or 'teacher', revoke role 'student'
 	if hasRoleStudent && (roleID == 1 || roleID == 2) {
-		err = app.Model.UserRoleDB.RevokeRole(userID, 3)
+		err = app.Model.UserRoleDB.RevokeRole(r.Context(), userID, 3)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
 	}
 
-	err = app.Model.UserRoleDB.GrantRole(userID, roleID)
+	err = app.Model.UserRoleDB.GrantRole(r.Context(), userID, roleID)
 	if err != nil {
 		app.handleRetrievalError(w, r, err)
 		return
@@ -105,12 +123,39 @@ func (app *application) RevokeRoleHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.Model.UserRoleDB.RevokeRole(userID, roleID)
+	// Keep at least one administrator
+	if roleID == data.RoleAdmin {
+		isAdmin, err := app.Model.UserRoleDB.HasRole(r.Context(), userID, data.RoleAdmin)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		admins, err := app.Model.UserRoleDB.CountUsersWithRole(r.Context(), data.RoleAdmin)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if isAdmin && admins <= 1 {
+			app.errorResponse(w, r, http.StatusConflict, "لا يمكن إزالة صلاحية آخر مدير")
+			return
+		}
+	}
+
+	err = app.Model.UserRoleDB.RevokeRole(r.Context(), userID, roleID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	// Tokens issued with the revoked role stop working; the user's next
+	// refresh picks up the remaining roles.
+	if err := app.Model.UserDB.BumpSessionVersion(r.Context(), userID); err != nil {
+		app.handleRetrievalError(w, r, err)
+		return
+	}
+	app.permissions.invalidate(userID)
+	app.audit(r, data.AuditRevoke, data.AuditEntityUserRole, userID, map[string]any{"user_id": userID, "role_id": roleID}, nil)
+
 	utils.SendJSONResponse(w, http.StatusOK, utils.Envelope{"message": "role revoked successfully"})
 }
 
@@ -124,7 +169,7 @@ func (app *application) GetUserRolesHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	roles, err := app.Model.UserRoleDB.GetUserRoles(userID)
+	roles, err := app.Model.UserRoleDB.GetUserRoles(r.Context(), userID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -137,7 +182,7 @@ func (app *application) GetTeachersHandler(w http.ResponseWriter, r *http.Reques
 	queryParams := r.URL.Query()
 
 	// Fetch teachers using the query parameters
-	users, meta, err := app.Model.UserRoleDB.GetTeachers(queryParams)
+	users, meta, err := app.Model.UserRoleDB.GetTeachers(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -157,7 +202,7 @@ func (app *application) GetStudentHandler(w http.ResponseWriter, r *http.Request
 	queryParams := r.URL.Query()
 
 	// Fetch teachers using the query parameters
-	users, meta, err := app.Model.UserRoleDB.GetStudents(queryParams)
+	users, meta, err := app.Model.UserRoleDB.GetStudents(r.Context(), queryParams)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
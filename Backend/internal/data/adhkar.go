@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -38,7 +39,7 @@ type AdhkarDB struct {
 }
 
 // InsertAdhkar inserts a new dhikr into the adhkar table
-func (a *AdhkarDB) InsertAdhkar(adhkar *Adhkar) error {
+func (a *AdhkarDB) InsertAdhkar(ctx context.Context, adhkar *Adhkar) error {
 	query, args, err := QB.Insert("adhkar").
 		Columns("text", "source", "repeat", "category_id").
 		Values(adhkar.Text, adhkar.Source, adhkar.Repeat, adhkar.CategoryID).
@@ -48,7 +49,7 @@ func (a *AdhkarDB) InsertAdhkar(adhkar *Adhkar) error {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = a.db.QueryRowx(query, args...).Scan(&adhkar.ID, &adhkar.CreatedAt, &adhkar.UpdatedAt)
+	err = a.db.QueryRowxContext(ctx, query, args...).Scan(&adhkar.ID, &adhkar.CreatedAt, &adhkar.UpdatedAt)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // PostgreSQL unique_violation error code
@@ -64,7 +65,7 @@ func (a *AdhkarDB) InsertAdhkar(adhkar *Adhkar) error {
 }
 
 // GetAdhkarByID retrieves a dhikr by its ID
-func (a *AdhkarDB) GetAdhkarByID(id int) (*Adhkar, error) {
+func (a *AdhkarDB) GetAdhkarByID(ctx context.Context, id int) (*Adhkar, error) {
 	var adhkar Adhkar
 	query, args, err := QB.Select(
 		"a.id", "a.text", "a.source", "a.repeat",
@@ -78,7 +79,7 @@ func (a *AdhkarDB) GetAdhkarByID(id int) (*Adhkar, error) {
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = a.db.Get(&adhkar, query, args...)
+	err = a.db.GetContext(ctx, &adhkar, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrAdhkarNotFound
@@ -90,7 +91,7 @@ func (a *AdhkarDB) GetAdhkarByID(id int) (*Adhkar, error) {
 }
 
 // UpdateAdhkar updates an existing dhikr
-func (a *AdhkarDB) UpdateAdhkar(adhkar *Adhkar) error {
+func (a *AdhkarDB) UpdateAdhkar(ctx context.Context, adhkar *Adhkar) error {
 	query, args, err := QB.Update("adhkar").
 		Set("text", adhkar.Text).
 		Set("source", adhkar.Source).
@@ -103,7 +104,7 @@ func (a *AdhkarDB) UpdateAdhkar(adhkar *Adhkar) error {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	result, err := a.db.Exec(query, args...)
+	result, err := a.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23503" { // Foreign key violation
@@ -125,7 +126,7 @@ func (a *AdhkarDB) UpdateAdhkar(adhkar *Adhkar) error {
 }
 
 // DeleteAdhkar deletes a dhikr by its ID
-func (a *AdhkarDB) DeleteAdhkar(id int) error {
+func (a *AdhkarDB) DeleteAdhkar(ctx context.Context, id int) error {
 	query, args, err := QB.Delete("adhkar").
 		Where(squirrel.Eq{"id": id}).
 		ToSql()
@@ -133,7 +134,7 @@ func (a *AdhkarDB) DeleteAdhkar(id int) error {
 		return fmt.Errorf("خطأ في إنشاء استعلام الحذف: %v", err)
 	}
 
-	result, err := a.db.Exec(query, args...)
+	result, err := a.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("خطأ في حذف الذكر: %v", err)
 	}
@@ -150,7 +151,7 @@ func (a *AdhkarDB) DeleteAdhkar(id int) error {
 }
 
 // ListAdhkar lists all adhkar with pagination and filtering
-func (a *AdhkarDB) ListAdhkar(queryParams url.Values) ([]Adhkar, *utils.Meta, error) {
+func (a *AdhkarDB) ListAdhkar(ctx context.Context, queryParams url.Values) ([]Adhkar, *utils.Meta, error) {
 	var adhkar []Adhkar
 
 	// Columns to select with joins
@@ -168,6 +169,7 @@ func (a *AdhkarDB) ListAdhkar(queryParams url.Values) ([]Adhkar, *utils.Meta, er
 
 	// Build the query using a utility function
 	meta, err := utils.BuildQuery(
+		ctx,
 		&adhkar,
 		"adhkar a",
 		joins,
@@ -184,7 +186,7 @@ func (a *AdhkarDB) ListAdhkar(queryParams url.Values) ([]Adhkar, *utils.Meta, er
 }
 
 // GetAdhkarByCategoryID retrieves adhkar filtered by category_id
-func (a *AdhkarDB) GetAdhkarByCategoryID(categoryID int, queryParams url.Values) ([]Adhkar, *utils.Meta, error) {
+func (a *AdhkarDB) GetAdhkarByCategoryID(ctx context.Context, categoryID int, queryParams url.Values) ([]Adhkar, *utils.Meta, error) {
 	var adhkar []Adhkar
 
 	// Columns to select with joins
@@ -216,6 +218,7 @@ func (a *AdhkarDB) GetAdhkarByCategoryID(categoryID int, queryParams url.Values)
 
 	// Build the query using a utility function
 	meta, err := utils.BuildQuery(
+		ctx,
 		&adhkar,
 		"adhkar a",
 		joins,
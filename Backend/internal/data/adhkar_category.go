@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -36,7 +37,7 @@ type AdhkarCategoryDB struct {
 }
 
 // InsertAdhkarCategory inserts a new adhkar category into the adhkar_categories table
-func (a *AdhkarCategoryDB) InsertAdhkarCategory(category *AdhkarCategory) error {
+func (a *AdhkarCategoryDB) InsertAdhkarCategory(ctx context.Context, category *AdhkarCategory) error {
 	query, args, err := QB.Insert("adhkar_categories").
 		Columns("name", "description").
 		Values(category.Name, category.Description).
@@ -46,7 +47,7 @@ func (a *AdhkarCategoryDB) InsertAdhkarCategory(category *AdhkarCategory) error
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = a.db.QueryRowx(query, args...).Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt)
+	err = a.db.QueryRowxContext(ctx, query, args...).Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // PostgreSQL unique_violation error code
@@ -60,7 +61,7 @@ func (a *AdhkarCategoryDB) InsertAdhkarCategory(category *AdhkarCategory) error
 }
 
 // GetAdhkarCategoryByID retrieves an adhkar category by its ID
-func (a *AdhkarCategoryDB) GetAdhkarCategoryByID(id int) (*AdhkarCategory, error) {
+func (a *AdhkarCategoryDB) GetAdhkarCategoryByID(ctx context.Context, id int) (*AdhkarCategory, error) {
 	var category AdhkarCategory
 	query, args, err := QB.Select("id", "name", "description", "created_at", "updated_at").
 		From("adhkar_categories").
@@ -70,7 +71,7 @@ func (a *AdhkarCategoryDB) GetAdhkarCategoryByID(id int) (*AdhkarCategory, error
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = a.db.Get(&category, query, args...)
+	err = a.db.GetContext(ctx, &category, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrAdhkarCategoryNotFound
@@ -82,7 +83,7 @@ func (a *AdhkarCategoryDB) GetAdhkarCategoryByID(id int) (*AdhkarCategory, error
 }
 
 // GetAdhkarCategoryByName retrieves an adhkar category by its name
-func (a *AdhkarCategoryDB) GetAdhkarCategoryByName(name string) (*AdhkarCategory, error) {
+func (a *AdhkarCategoryDB) GetAdhkarCategoryByName(ctx context.Context, name string) (*AdhkarCategory, error) {
 	var category AdhkarCategory
 	query, args, err := QB.Select("id", "name", "description", "created_at", "updated_at").
 		From("adhkar_categories").
@@ -92,7 +93,7 @@ func (a *AdhkarCategoryDB) GetAdhkarCategoryByName(name string) (*AdhkarCategory
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = a.db.Get(&category, query, args...)
+	err = a.db.GetContext(ctx, &category, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrAdhkarCategoryNotFound
@@ -104,7 +105,7 @@ func (a *AdhkarCategoryDB) GetAdhkarCategoryByName(name string) (*AdhkarCategory
 }
 
 // UpdateAdhkarCategory updates an existing adhkar category
-func (a *AdhkarCategoryDB) UpdateAdhkarCategory(category *AdhkarCategory) error {
+func (a *AdhkarCategoryDB) UpdateAdhkarCategory(ctx context.Context, category *AdhkarCategory) error {
 	query, args, err := QB.Update("adhkar_categories").
 		Set("name", category.Name).
 		Set("description", category.Description).
@@ -115,7 +116,7 @@ func (a *AdhkarCategoryDB) UpdateAdhkarCategory(category *AdhkarCategory) error
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	result, err := a.db.Exec(query, args...)
+	result, err := a.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // unique_violation
@@ -137,11 +138,11 @@ func (a *AdhkarCategoryDB) UpdateAdhkarCategory(category *AdhkarCategory) error
 }
 
 // DeleteAdhkarCategory deletes an adhkar category by its ID if it's not referenced by any adhkar
-func (a *AdhkarCategoryDB) DeleteAdhkarCategory(id int) error {
+func (a *AdhkarCategoryDB) DeleteAdhkarCategory(ctx context.Context, id int) error {
 	// First check if the category is in use
 	var count int
 	checkQuery := "SELECT COUNT(*) FROM adhkar WHERE category_id = $1"
-	err := a.db.Get(&count, checkQuery, id)
+	err := a.db.GetContext(ctx, &count, checkQuery, id)
 	if err != nil {
 		return fmt.Errorf("خطأ في التحقق من استخدام التصنيف: %v", err)
 	}
@@ -158,7 +159,7 @@ func (a *AdhkarCategoryDB) DeleteAdhkarCategory(id int) error {
 		return fmt.Errorf("خطأ في إنشاء استعلام الحذف: %v", err)
 	}
 
-	result, err := a.db.Exec(query, args...)
+	result, err := a.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("خطأ في حذف تصنيف الأذكار: %v", err)
 	}
@@ -175,7 +176,7 @@ func (a *AdhkarCategoryDB) DeleteAdhkarCategory(id int) error {
 }
 
 // ListAdhkarCategories lists all adhkar categories with pagination and filtering
-func (a *AdhkarCategoryDB) ListAdhkarCategories(queryParams url.Values) ([]AdhkarCategory, *utils.Meta, error) {
+func (a *AdhkarCategoryDB) ListAdhkarCategories(ctx context.Context, queryParams url.Values) ([]AdhkarCategory, *utils.Meta, error) {
 	var categories []AdhkarCategory
 
 	// Columns to select from the adhkar_categories table
@@ -186,6 +187,7 @@ func (a *AdhkarCategoryDB) ListAdhkarCategories(queryParams url.Values) ([]Adhka
 
 	// Build the query using a utility function
 	meta, err := utils.BuildQuery(
+		ctx,
 		&categories,
 		"adhkar_categories",
 		nil, // No joins needed
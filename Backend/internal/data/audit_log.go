@@ -0,0 +1,200 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"time"
+
+	"project/utils"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditCreate      = "create"
+	AuditUpdate      = "update"
+	AuditDelete      = "delete"
+	AuditImport      = "import"
+	AuditGrant       = "grant"
+	AuditRevoke      = "revoke"
+	AuditRevert      = "revert"
+	AuditShift       = "shift"
+	AuditMaterialize = "materialize"
+)
+
+// AuditActions lists every action, for filtering.
+var AuditActions = []string{
+	AuditCreate, AuditUpdate, AuditDelete, AuditImport, AuditGrant, AuditRevoke, AuditRevert, AuditShift,
+	AuditMaterialize,
+}
+
+// Entity types recorded in the audit log
+const (
+	AuditEntitySection        = "section"
+	AuditEntityPrayerTimes    = "prayer_times"
+	AuditEntityHadith         = "hadith"
+	AuditEntityAdhkar         = "adhkar"
+	AuditEntityAdhkarCategory = "adhkar_category"
+	AuditEntitySpecialTopic   = "special_topic"
+	AuditEntityUser           = "user"
+	AuditEntityUserRole       = "user_role"
+	AuditEntityUserPermission = "user_permission"
+)
+
+// AuditEntities lists every entity type, for filtering.
+var AuditEntities = []string{
+	AuditEntitySection, AuditEntityPrayerTimes, AuditEntityHadith, AuditEntityAdhkar,
+	AuditEntityAdhkarCategory, AuditEntitySpecialTopic, AuditEntityUser, AuditEntityUserRole,
+	AuditEntityUserPermission,
+}
+
+// auditIgnoredFields are left out of the changes of an update: they change
+// on every write.
+var auditIgnoredFields = map[string]bool{"created_at": true, "updated_at": true}
+
+// AuditLog represents a record in the audit_log table
+type AuditLog struct {
+	ID         int64           `db:"id" json:"id"`
+	ActorID    *uuid.UUID      `db:"actor_id" json:"actor_id"`
+	ActorName  *string         `db:"actor_name" json:"actor_name"`
+	Action     string          `db:"action" json:"action"`
+	EntityType string          `db:"entity_type" json:"entity_type"`
+	EntityID   string          `db:"entity_id" json:"entity_id"`
+	Before     json.RawMessage `db:"before" json:"before"`
+	After      json.RawMessage `db:"after" json:"after"`
+	Changes    json.RawMessage `db:"changes" json:"changes"`
+	IPAddress  *string         `db:"ip_address" json:"ip_address"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+}
+
+// AuditLogDB handles database operations for the audit_log table
+type AuditLogDB struct {
+	db *sqlx.DB
+}
+
+// NewAuditLog builds an entry from the record before and after the change;
+// either may be nil. Changes lists, for every field that differs, its value
+// before and after.
+func NewAuditLog(actorID *uuid.UUID, action, entityType, entityID string, before, after interface{}) (*AuditLog, error) {
+	entry := &AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+	}
+
+	beforeFields, err := auditSnapshot(before, &entry.Before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditSnapshot(after, &entry.After)
+	if err != nil {
+		return nil, err
+	}
+
+	if beforeFields != nil && afterFields != nil {
+		changes := map[string]map[string]interface{}{}
+		for field, value := range afterFields {
+			if !auditIgnoredFields[field] && !reflect.DeepEqual(beforeFields[field], value) {
+				changes[field] = map[string]interface{}{"from": beforeFields[field], "to": value}
+			}
+		}
+		for field, value := range beforeFields {
+			if _, ok := afterFields[field]; !ok && !auditIgnoredFields[field] {
+				changes[field] = map[string]interface{}{"from": value, "to": nil}
+			}
+		}
+		entry.Changes, err = json.Marshal(changes)
+		if err != nil {
+			return nil, fmt.Errorf("خطأ في تحويل التغييرات: %v", err)
+		}
+	}
+
+	return entry, nil
+}
+
+// auditSnapshot stores the JSON form of record in raw and returns its
+// fields; a nil record leaves raw empty.
+func auditSnapshot(record interface{}, raw *json.RawMessage) (map[string]interface{}, error) {
+	if record == nil {
+		return nil, nil
+	}
+	if v := reflect.ValueOf(record); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في تحويل السجل: %v", err)
+	}
+	*raw = encoded
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		// Not an object: keep the snapshot, there are no fields to compare
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// Insert records an entry.
+func (a *AuditLogDB) Insert(ctx context.Context, entry *AuditLog) error {
+	query, args, err := QB.Insert("audit_log").
+		Columns("actor_id", "action", "entity_type", "entity_id", "before", "after", "changes", "ip_address").
+		Values(entry.ActorID, entry.Action, entry.EntityType, entry.EntityID,
+			nullableJSON(entry.Before), nullableJSON(entry.After), nullableJSON(entry.Changes), entry.IPAddress).
+		Suffix("RETURNING id, created_at").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	if err := a.db.QueryRowxContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt); err != nil {
+		return fmt.Errorf("خطأ في حفظ سجل التدقيق: %v", err)
+	}
+
+	return nil
+}
+
+// nullableJSON stores an empty snapshot as NULL.
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// ListAuditLog lists entries with pagination, newest first unless ?sort=
+// says otherwise. additionalFilters are trusted SQL conditions.
+func (a *AuditLogDB) ListAuditLog(ctx context.Context, queryParams url.Values, additionalFilters []string) ([]AuditLog, *utils.Meta, error) {
+	entries := []AuditLog{}
+
+	if queryParams.Get("sort") == "" {
+		queryParams.Set("sort", "-audit_log.id")
+	}
+
+	meta, err := utils.BuildQuery(
+		ctx,
+		&entries,
+		"audit_log",
+		[]string{"users ON users.id = audit_log.actor_id"},
+		[]string{
+			"audit_log.id", "audit_log.actor_id", "users.name AS actor_name", "audit_log.action",
+			"audit_log.entity_type", "audit_log.entity_id", "audit_log.before", "audit_log.after",
+			"audit_log.changes", "audit_log.ip_address", "audit_log.created_at",
+		},
+		[]string{"audit_log.entity_id", "users.name"},
+		queryParams,
+		additionalFilters,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("خطأ في جلب سجل التدقيق: %v", err)
+	}
+
+	return entries, meta, nil
+}
@@ -0,0 +1,190 @@
+// Package datatest provides a scripted database for testing code built on
+// the data package without a PostgreSQL server. Statements are answered by
+// handlers picked by a fragment of their SQL, and every statement run,
+// including BEGIN, COMMIT and ROLLBACK, is recorded.
+package datatest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Result is a handler's answer: the rows of a query, or the number of rows
+// an update affected.
+type Result struct {
+	Columns      []string
+	Rows         [][]driver.Value
+	RowsAffected int64
+}
+
+// Handler answers a statement. args are the statement's arguments as
+// database/sql passes them to a driver, with driver.Valuers such as
+// uuid.UUID already converted.
+type Handler func(query string, args []driver.Value) (*Result, error)
+
+// Statement is a statement the database ran.
+type Statement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// DB is a scripted database. Handlers run one at a time, so they may share
+// state without locking. Transactions are only recorded: what a handler
+// changed stays changed when its transaction rolls back.
+type DB struct {
+	mu         sync.Mutex
+	handlers   []handler
+	statements []Statement
+}
+
+type handler struct {
+	fragment string
+	fn       Handler
+}
+
+// New returns a scripted database and a connection to it that binds
+// parameters the way PostgreSQL does.
+func New() (*DB, *sqlx.DB) {
+	db := &DB{}
+	return db, sqlx.NewDb(sql.OpenDB(connector{db}), "postgres")
+}
+
+// Handle answers statements containing fragment with fn. The first handler
+// registered for a statement wins; a statement no handler matches fails.
+func (db *DB) Handle(fragment string, fn Handler) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.handlers = append(db.handlers, handler{fragment, fn})
+}
+
+// Statements returns the statements run so far, in order.
+func (db *DB) Statements() []Statement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Statement(nil), db.statements...)
+}
+
+func (db *DB) run(ctx context.Context, query string, args []driver.NamedValue) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = append(db.statements, Statement{query, values})
+	for _, h := range db.handlers {
+		if strings.Contains(query, h.fragment) {
+			result, err := h.fn(query, values)
+			if result == nil && err == nil {
+				result = &Result{}
+			}
+			return result, err
+		}
+	}
+	return nil, fmt.Errorf("datatest: no handler for %q", query)
+}
+
+func (db *DB) record(query string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.statements = append(db.statements, Statement{Query: query})
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &conn{c.db}, nil }
+func (c connector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("datatest: open the database with New")
+}
+
+type conn struct{ db *DB }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{c.db, query}, nil }
+func (c *conn) Close() error                              { return nil }
+func (c *conn) Begin() (driver.Tx, error)                 { return c.BeginTx(context.Background(), driver.TxOptions{}) }
+
+func (c *conn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.db.record("BEGIN")
+	return tx{c.db}, nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.db.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{result: result}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.db.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.RowsAffected), nil
+}
+
+type stmt struct {
+	db    *DB
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return (&conn{s.db}).ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return (&conn{s.db}).QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return values
+}
+
+type tx struct{ db *DB }
+
+func (t tx) Commit() error   { t.db.record("COMMIT"); return nil }
+func (t tx) Rollback() error { t.db.record("ROLLBACK"); return nil }
+
+type rows struct {
+	result *Result
+	next   int
+}
+
+func (r *rows) Columns() []string { return r.result.Columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.Rows) {
+		return io.EOF
+	}
+	copy(dest, r.result.Rows[r.next])
+	r.next++
+	return nil
+}
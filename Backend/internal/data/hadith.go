@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -36,7 +37,7 @@ type HadithDB struct {
 }
 
 // InsertHadith inserts a new hadith into the hadiths table
-func (h *HadithDB) InsertHadith(hadith *Hadith) error {
+func (h *HadithDB) InsertHadith(ctx context.Context, hadith *Hadith) error {
 	query, args, err := QB.Insert("hadiths").
 		Columns("text", "source", "topic").
 		Values(hadith.Text, hadith.Source, hadith.Topic).
@@ -46,7 +47,7 @@ func (h *HadithDB) InsertHadith(hadith *Hadith) error {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = h.db.QueryRowx(query, args...).Scan(&hadith.ID, &hadith.CreatedAt, &hadith.UpdatedAt)
+	err = h.db.QueryRowxContext(ctx, query, args...).Scan(&hadith.ID, &hadith.CreatedAt, &hadith.UpdatedAt)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // PostgreSQL unique_violation error code
@@ -60,7 +61,7 @@ func (h *HadithDB) InsertHadith(hadith *Hadith) error {
 }
 
 // GetHadithByID retrieves a hadith by its ID
-func (h *HadithDB) GetHadithByID(id int) (*Hadith, error) {
+func (h *HadithDB) GetHadithByID(ctx context.Context, id int) (*Hadith, error) {
 	var hadith Hadith
 	query, args, err := QB.Select("id", "text", "source", "topic", "created_at", "updated_at").
 		From("hadiths").
@@ -70,7 +71,7 @@ func (h *HadithDB) GetHadithByID(id int) (*Hadith, error) {
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = h.db.Get(&hadith, query, args...)
+	err = h.db.GetContext(ctx, &hadith, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrHadithNotFound
@@ -82,7 +83,7 @@ func (h *HadithDB) GetHadithByID(id int) (*Hadith, error) {
 }
 
 // UpdateHadith updates an existing hadith
-func (h *HadithDB) UpdateHadith(hadith *Hadith) error {
+func (h *HadithDB) UpdateHadith(ctx context.Context, hadith *Hadith) error {
 	query, args, err := QB.Update("hadiths").
 		Set("text", hadith.Text).
 		Set("source", hadith.Source).
@@ -94,7 +95,7 @@ func (h *HadithDB) UpdateHadith(hadith *Hadith) error {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	result, err := h.db.Exec(query, args...)
+	result, err := h.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("خطأ في تحديث الحديث: %v", err)
 	}
@@ -111,7 +112,7 @@ func (h *HadithDB) UpdateHadith(hadith *Hadith) error {
 }
 
 // DeleteHadith deletes a hadith by its ID
-func (h *HadithDB) DeleteHadith(id int) error {
+func (h *HadithDB) DeleteHadith(ctx context.Context, id int) error {
 	query, args, err := QB.Delete("hadiths").
 		Where(squirrel.Eq{"id": id}).
 		ToSql()
@@ -119,7 +120,7 @@ func (h *HadithDB) DeleteHadith(id int) error {
 		return fmt.Errorf("خطأ في إنشاء استعلام الحذف: %v", err)
 	}
 
-	result, err := h.db.Exec(query, args...)
+	result, err := h.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("خطأ في حذف الحديث: %v", err)
 	}
@@ -136,7 +137,7 @@ func (h *HadithDB) DeleteHadith(id int) error {
 }
 
 // ListHadiths lists all hadiths with pagination and filtering
-func (h *HadithDB) ListHadiths(queryParams url.Values) ([]Hadith, *utils.Meta, error) {
+func (h *HadithDB) ListHadiths(ctx context.Context, queryParams url.Values) ([]Hadith, *utils.Meta, error) {
 	var hadiths []Hadith
 
 	// Columns to select from the hadiths table
@@ -147,6 +148,7 @@ func (h *HadithDB) ListHadiths(queryParams url.Values) ([]Hadith, *utils.Meta, e
 
 	// Build the query using a utility function
 	meta, err := utils.BuildQuery(
+		ctx,
 		&hadiths,
 		"hadiths",
 		nil, // No joins needed
@@ -163,7 +165,7 @@ func (h *HadithDB) ListHadiths(queryParams url.Values) ([]Hadith, *utils.Meta, e
 }
 
 // GetHadithsByTopic retrieves hadiths filtered by topic
-func (h *HadithDB) GetHadithsByTopic(topic string, queryParams url.Values) ([]Hadith, *utils.Meta, error) {
+func (h *HadithDB) GetHadithsByTopic(ctx context.Context, topic string, queryParams url.Values) ([]Hadith, *utils.Meta, error) {
 	var hadiths []Hadith
 
 	// Columns to select from the hadiths table
@@ -189,6 +191,7 @@ func (h *HadithDB) GetHadithsByTopic(topic string, queryParams url.Values) ([]Ha
 
 	// Build the query using a utility function
 	meta, err := utils.BuildQuery(
+		ctx,
 		&hadiths,
 		"hadiths",
 		nil, // No joins needed
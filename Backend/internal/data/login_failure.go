@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrLoginLocked is returned while too many failed sign-ins lock a phone
+// number or client address.
+var ErrLoginLocked = errors.New("تم تجاوز عدد محاولات تسجيل الدخول، يرجى المحاولة لاحقاً")
+
+// LoginThrottle is how failed sign-ins under one key hold back further
+// attempts. The first FreeFailures cost nothing; every failure after them
+// locks the key for BaseDelay, doubled for each failure past the first
+// locking one, up to MaxDelay. Failures are forgotten after Window without
+// one.
+type LoginThrottle struct {
+	FreeFailures int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+// Delay returns how long the key is locked after its failures-th failure.
+func (t LoginThrottle) Delay(failures int) time.Duration {
+	over := failures - t.FreeFailures
+	if over <= 0 {
+		return 0
+	}
+	delay := t.BaseDelay
+	for i := 1; i < over && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, t.MaxDelay)
+}
+
+// LoginFailureKeyPhone is the key failures for a phone number are counted
+// under, whether or not an account uses it.
+func LoginFailureKeyPhone(phoneNumber string) string {
+	return "phone:" + phoneNumber
+}
+
+// LoginFailureKeyIP is the key failures from a client address are counted
+// under.
+func LoginFailureKeyIP(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginFailureDB handles database operations for the login_failures table
+type LoginFailureDB struct {
+	db *sqlx.DB
+}
+
+// LockedUntil returns the latest lock still running on any of the keys, or
+// the zero time when none is locked.
+func (l *LoginFailureDB) LockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	query, args, err := QB.Select("MAX(locked_until)").
+		From("login_failures").
+		Where(squirrel.Eq{"key": keys}).
+		Where("locked_until > CURRENT_TIMESTAMP").
+		ToSql()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	var lockedUntil *time.Time
+	if err := l.db.GetContext(ctx, &lockedUntil, query, args...); err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في جلب محاولات تسجيل الدخول: %v", err)
+	}
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *lockedUntil, nil
+}
+
+// RecordFailure counts a failed sign-in under key and locks it as throttle
+// says. It returns the failures counted and, when the key is now locked,
+// until when.
+func (l *LoginFailureDB) RecordFailure(ctx context.Context, key string, throttle LoginThrottle) (int, time.Time, error) {
+	tx, err := l.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("خطأ في بدء المعاملة: %v", err)
+	}
+	defer tx.Rollback()
+
+	var failures int
+	err = tx.GetContext(ctx, &failures, `
+		INSERT INTO login_failures (key, failures, last_failed_at)
+		VALUES ($1, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_failures.last_failed_at < CURRENT_TIMESTAMP - make_interval(secs => $2::FLOAT8) THEN 1
+				ELSE login_failures.failures + 1
+			END,
+			last_failed_at = CURRENT_TIMESTAMP
+		RETURNING failures`,
+		key, throttle.Window.Seconds())
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("خطأ في حفظ محاولة تسجيل الدخول: %v", err)
+	}
+
+	var lockedUntil time.Time
+	if delay := throttle.Delay(failures); delay > 0 {
+		lockedUntil = time.Now().Add(delay)
+		query, args, err := QB.Update("login_failures").
+			Set("locked_until", lockedUntil).
+			Where(squirrel.Eq{"key": key}).
+			ToSql()
+		if err != nil {
+			return 0, time.Time{}, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return 0, time.Time{}, fmt.Errorf("خطأ في قفل تسجيل الدخول: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, time.Time{}, fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
+	}
+
+	return failures, lockedUntil, nil
+}
+
+// ClearFailures forgets the failures counted under key.
+func (l *LoginFailureDB) ClearFailures(ctx context.Context, key string) error {
+	query, args, err := QB.Delete("login_failures").
+		Where(squirrel.Eq{"key": key}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	if _, err := l.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("خطأ في حذف محاولات تسجيل الدخول: %v", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the counts of keys that are not locked and have had
+// no failure for longer than window.
+func (l *LoginFailureDB) DeleteExpired(ctx context.Context, window time.Duration) (int64, error) {
+	query, args, err := QB.Delete("login_failures").
+		Where(squirrel.Lt{"last_failed_at": time.Now().Add(-window)}).
+		Where("(locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	result, err := l.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في حذف محاولات تسجيل الدخول القديمة: %v", err)
+	}
+	return result.RowsAffected()
+}
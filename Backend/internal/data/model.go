@@ -44,6 +44,7 @@ var (
 	ErrPrayerTimesAlreadyInserted  = errors.New("وقت الصلاة مدخل مسبقا")
 	ErrSectionNotFound             = errors.New("القسم غير موجود")
 	ErrSectionAlreadyExists        = errors.New("القسم موجود بالفعل")
+	ErrSectionHasDerived           = errors.New("لا يمكن حذف القسم لأن أقسامًا أخرى تتبع مواقيته")
 )
 
 type Model struct {
@@ -56,6 +57,15 @@ type Model struct {
 	AdhkarDB         AdhkarDB
 	AdhkarCategoryDB AdhkarCategoryDB
 	SpecialTopicDB   SpecialTopicDB
+
+	NotificationSubscriptionDB NotificationSubscriptionDB
+	NotificationOutboxDB       NotificationOutboxDB
+	RefreshTokenDB             RefreshTokenDB
+	OTPDB                      OTPDB
+	PermissionDB               PermissionDB
+	AuditLogDB                 AuditLogDB
+	LoginFailureDB             LoginFailureDB
+	SchemaDB                   SchemaDB
 }
 
 func NewModels(db *sqlx.DB) Model {
@@ -69,5 +79,14 @@ func NewModels(db *sqlx.DB) Model {
 		AdhkarDB:         AdhkarDB{db},
 		AdhkarCategoryDB: AdhkarCategoryDB{db},
 		SpecialTopicDB:   SpecialTopicDB{db},
+
+		NotificationSubscriptionDB: NotificationSubscriptionDB{db},
+		NotificationOutboxDB:       NotificationOutboxDB{db},
+		RefreshTokenDB:             RefreshTokenDB{db},
+		OTPDB:                      OTPDB{db},
+		PermissionDB:               PermissionDB{db},
+		AuditLogDB:                 AuditLogDB{db},
+		LoginFailureDB:             LoginFailureDB{db},
+		SchemaDB:                   SchemaDB{db},
 	}
 }
@@ -0,0 +1,251 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"project/utils"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// Delivery states of an outbox entry. Pending and sending entries are still
+// owned by the delivery worker; the others are final.
+const (
+	OutboxPending   = "pending"
+	OutboxSending   = "sending"
+	OutboxSent      = "sent"
+	OutboxFailed    = "failed"
+	OutboxExpired   = "expired"
+	OutboxCancelled = "cancelled"
+)
+
+// OutboxStatuses lists every delivery state.
+var OutboxStatuses = []string{OutboxPending, OutboxSending, OutboxSent, OutboxFailed, OutboxExpired, OutboxCancelled}
+
+// NotificationOutbox represents a record in the notification_outbox table:
+// one alert for one device on one day, and what became of it.
+type NotificationOutbox struct {
+	ID             int64           `db:"id" json:"id"`
+	SubscriptionID *int            `db:"subscription_id" json:"subscription_id"`
+	SectionID      int             `db:"section_id" json:"section_id"`
+	SectionName    string          `db:"section_name" json:"section_name,omitempty"`
+	Prayer         string          `db:"prayer" json:"prayer"`
+	PrayerDate     time.Time       `db:"prayer_date" json:"-"`
+	Date           string          `db:"-" json:"prayer_date"`
+	Title          string          `db:"title" json:"title"`
+	Body           string          `db:"body" json:"body"`
+	Data           json.RawMessage `db:"data" json:"data"`
+	DeliverAt      time.Time       `db:"deliver_at" json:"deliver_at"`
+	Status         string          `db:"status" json:"status"`
+	Attempts       int             `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at" json:"-"`
+	LastError      *string         `db:"last_error" json:"last_error"`
+	SentAt         *time.Time      `db:"sent_at" json:"sent_at"`
+	CreatedAt      time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time       `db:"updated_at" json:"updated_at"`
+
+	// DeviceToken is filled in when an entry is claimed for delivery; it is
+	// empty when the subscription has since been removed.
+	DeviceToken string `db:"device_token" json:"-"`
+}
+
+// notificationOutboxColumns lists the columns selected for an outbox entry.
+var notificationOutboxColumns = []string{
+	"notification_outbox.id", "subscription_id", "notification_outbox.section_id", "prayer", "prayer_date",
+	"title", "body", "data", "deliver_at", "status", "attempts", "next_attempt_at",
+	"last_error", "sent_at", "notification_outbox.created_at", "notification_outbox.updated_at",
+}
+
+// NotificationOutboxDB handles database operations for the
+// notification_outbox table
+type NotificationOutboxDB struct {
+	db *sqlx.DB
+}
+
+// outboxInsertBatch bounds the rows per INSERT, well under PostgreSQL's
+// limit on bind parameters.
+const outboxInsertBatch = 1000
+
+// Enqueue adds entries to the outbox. An entry that was already enqueued for
+// the same device, prayer and day is skipped, so the scheduler may enqueue
+// the same alert on every tick. It returns how many entries were new.
+func (n *NotificationOutboxDB) Enqueue(ctx context.Context, entries []NotificationOutbox) (int, error) {
+	total := 0
+	for start := 0; start < len(entries); start += outboxInsertBatch {
+		end := min(start+outboxInsertBatch, len(entries))
+
+		insert := QB.Insert("notification_outbox").
+			Columns("subscription_id", "section_id", "prayer", "prayer_date", "title", "body", "data",
+				"deliver_at", "next_attempt_at")
+		for _, e := range entries[start:end] {
+			payload := string(e.Data)
+			if payload == "" {
+				payload = "{}"
+			}
+			insert = insert.Values(e.SubscriptionID, e.SectionID, e.Prayer, e.PrayerDate.Format("2006-01-02"),
+				e.Title, e.Body, payload, e.DeliverAt, e.DeliverAt)
+		}
+		query, args, err := insert.
+			Suffix("ON CONFLICT (subscription_id, section_id, prayer, prayer_date) DO NOTHING").
+			ToSql()
+		if err != nil {
+			return total, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+		}
+
+		result, err := n.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, fmt.Errorf("خطأ في إضافة الإشعارات إلى قائمة الإرسال: %v", err)
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
+		}
+		total += int(inserted)
+	}
+
+	return total, nil
+}
+
+// ClaimDue marks up to limit due entries as sending and returns them with the
+// device token of their subscription. Entries locked by another worker are
+// skipped, and an entry left in sending for longer than staleAfter (its
+// worker died) is claimed again.
+func (n *NotificationOutboxDB) ClaimDue(ctx context.Context, limit int, staleAfter time.Duration) ([]NotificationOutbox, error) {
+	var entries []NotificationOutbox
+	query := `
+		UPDATE notification_outbox o
+		SET status = 'sending', attempts = o.attempts + 1, updated_at = CURRENT_TIMESTAMP
+		FROM (
+			SELECT id FROM notification_outbox
+			WHERE (status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP)
+			   OR (status = 'sending' AND updated_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second')
+			ORDER BY deliver_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		) due
+		WHERE o.id = due.id
+		RETURNING o.id, o.subscription_id, o.section_id, o.prayer, o.prayer_date, o.title, o.body, o.data,
+			o.deliver_at, o.status, o.attempts, o.next_attempt_at, o.last_error, o.sent_at,
+			o.created_at, o.updated_at,
+			COALESCE((SELECT device_token FROM notification_subscriptions s WHERE s.id = o.subscription_id), '') AS device_token`
+
+	if err := n.db.SelectContext(ctx, &entries, query, int(staleAfter.Seconds()), limit); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب الإشعارات المستحقة: %v", err)
+	}
+
+	return entries, nil
+}
+
+// MarkSent records a successful delivery.
+func (n *NotificationOutboxDB) MarkSent(ctx context.Context, id int64) error {
+	return n.update(ctx, id, squirrel.Eq{
+		"status":     OutboxSent,
+		"sent_at":    squirrel.Expr("CURRENT_TIMESTAMP"),
+		"last_error": nil,
+	})
+}
+
+// MarkRetry returns an entry to the queue after a failed attempt.
+func (n *NotificationOutboxDB) MarkRetry(ctx context.Context, id int64, lastError string, at time.Time) error {
+	return n.update(ctx, id, squirrel.Eq{
+		"status":          OutboxPending,
+		"last_error":      lastError,
+		"next_attempt_at": at,
+	})
+}
+
+// MarkFinished records a final state other than sent (failed, expired or
+// cancelled) with the reason.
+func (n *NotificationOutboxDB) MarkFinished(ctx context.Context, id int64, status, lastError string) error {
+	return n.update(ctx, id, squirrel.Eq{
+		"status":     status,
+		"last_error": lastError,
+	})
+}
+
+func (n *NotificationOutboxDB) update(ctx context.Context, id int64, set squirrel.Eq) error {
+	set["updated_at"] = squirrel.Expr("CURRENT_TIMESTAMP")
+	query, args, err := QB.Update("notification_outbox").
+		SetMap(set).
+		Where(squirrel.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	if _, err := n.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("خطأ في تحديث حالة الإشعار: %v", err)
+	}
+
+	return nil
+}
+
+// ListOutbox lists outbox entries with pagination, newest delivery first
+// unless ?sort= says otherwise. additionalFilters are trusted SQL conditions.
+func (n *NotificationOutboxDB) ListOutbox(ctx context.Context, queryParams url.Values, additionalFilters []string) ([]NotificationOutbox, *utils.Meta, error) {
+	entries := []NotificationOutbox{}
+
+	if queryParams.Get("sort") == "" {
+		queryParams.Set("sort", "-deliver_at")
+	}
+
+	columns := append(append([]string{}, notificationOutboxColumns...), "sections.name AS section_name")
+	meta, err := utils.BuildQuery(
+		ctx,
+		&entries,
+		"notification_outbox",
+		[]string{"sections ON sections.id = notification_outbox.section_id"},
+		columns,
+		[]string{"title", "body", "last_error"},
+		queryParams,
+		additionalFilters,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("خطأ في جلب سجل الإشعارات: %v", err)
+	}
+
+	for i := range entries {
+		entries[i].Date = entries[i].PrayerDate.Format("2006-01-02")
+	}
+
+	return entries, meta, nil
+}
+
+// CountOutboxByStatus counts the entries matching additionalFilters in each
+// delivery state.
+func (n *NotificationOutboxDB) CountOutboxByStatus(ctx context.Context, additionalFilters []string) (map[string]int, error) {
+	sb := QB.Select("status", "COUNT(*)").From("notification_outbox").GroupBy("status")
+	for _, filter := range additionalFilters {
+		sb = sb.Where(filter)
+	}
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	rows, err := n.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في جلب إحصائيات الإشعارات: %v", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(OutboxStatuses))
+	for _, status := range OutboxStatuses {
+		counts[status] = 0
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("خطأ في قراءة إحصائيات الإشعارات: %v", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,258 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"project/utils/validator"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Errors specific to notification subscriptions
+var (
+	ErrNotificationSubscriptionNotFound = errors.New("الاشتراك في الإشعارات غير موجود")
+)
+
+// Alert keys a subscription can choose from. Suhoor and Imsak only fire
+// during Ramadan.
+const (
+	AlertFajrFirst  = "fajr_first"
+	AlertFajrSecond = "fajr_second"
+	AlertDhuhr      = "dhuhr"
+	AlertAsr        = "asr"
+	AlertMaghrib    = "maghrib"
+	AlertIsha       = "isha"
+	AlertSuhoor     = "suhoor"
+	AlertImsak      = "imsak"
+)
+
+// NotificationAlerts lists every valid alert key; a subscription that does
+// not choose receives all of them.
+var NotificationAlerts = []string{
+	AlertFajrFirst, AlertFajrSecond, AlertDhuhr, AlertAsr, AlertMaghrib, AlertIsha, AlertSuhoor, AlertImsak,
+}
+
+// Languages notifications can be sent in.
+var NotificationLanguages = []string{"ar", "en"}
+
+// MaxReminderOffset bounds how early (in minutes) a reminder may be sent.
+const MaxReminderOffset = 120
+
+// NotificationSubscription represents a record in the
+// notification_subscriptions table: one device, optionally owned by a user.
+type NotificationSubscription struct {
+	ID                    int            `db:"id" json:"id"`
+	UserID                *string        `db:"user_id" json:"user_id,omitempty"`
+	DeviceToken           string         `db:"device_token" json:"-"`
+	SectionID             int            `db:"section_id" json:"section_id"`
+	Prayers               pq.StringArray `db:"prayers" json:"prayers"`
+	ReminderOffsetMinutes int            `db:"reminder_offset_minutes" json:"reminder_offset_minutes"`
+	QuietHoursStart       *string        `db:"quiet_hours_start" json:"quiet_hours_start"`
+	QuietHoursEnd         *string        `db:"quiet_hours_end" json:"quiet_hours_end"`
+	Language              string         `db:"language" json:"language"`
+	CreatedAt             time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt             time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// notificationSubscriptionColumns lists the columns selected for a full
+// subscription; quiet hours are read back as HH:MM.
+var notificationSubscriptionColumns = []string{
+	"id", "user_id", "device_token", "section_id", "prayers", "reminder_offset_minutes",
+	"to_char(quiet_hours_start, 'HH24:MI') AS quiet_hours_start",
+	"to_char(quiet_hours_end, 'HH24:MI') AS quiet_hours_end",
+	"language", "created_at", "updated_at",
+}
+
+// Wants reports whether the subscription asked for the given alert.
+func (s *NotificationSubscription) Wants(alert string) bool {
+	for _, p := range s.Prayers {
+		if p == alert {
+			return true
+		}
+	}
+	return false
+}
+
+// InQuietHours reports whether the clock time of t falls within the
+// subscription's quiet hours. A window whose end is before its start spans
+// midnight.
+func (s *NotificationSubscription) InQuietHours(t time.Time) bool {
+	if s.QuietHoursStart == nil || s.QuietHoursEnd == nil {
+		return false
+	}
+	start, err1 := time.Parse("15:04", *s.QuietHoursStart)
+	end, err2 := time.Parse("15:04", *s.QuietHoursEnd)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	return minute >= from || minute < to
+}
+
+// ValidateNotificationSubscription validates the subscription data.
+func ValidateNotificationSubscription(v *validator.Validator, s *NotificationSubscription) {
+	v.Check(s.DeviceToken != "", "token", "رمز الجهاز مطلوب")
+	v.Check(len(s.DeviceToken) <= 4096, "token", "رمز الجهاز طويل جدًا")
+	v.Check(s.SectionID > 0, "section_id", "القسم مطلوب")
+
+	v.Check(len(s.Prayers) > 0, "prayers", "يجب اختيار صلاة واحدة على الأقل")
+	for _, p := range s.Prayers {
+		if !validator.In(p, NotificationAlerts...) {
+			v.AddError("prayers", fmt.Sprintf("الصلاة %q غير معروفة", p))
+			break
+		}
+	}
+	v.Check(validator.Unique(s.Prayers), "prayers", "لا يجب تكرار الصلوات")
+
+	v.Check(s.ReminderOffsetMinutes >= 0 && s.ReminderOffsetMinutes <= MaxReminderOffset, "reminder_offset_minutes",
+		fmt.Sprintf("مدة التذكير يجب أن تكون بين 0 و%d دقيقة", MaxReminderOffset))
+
+	v.Check((s.QuietHoursStart == nil) == (s.QuietHoursEnd == nil), "quiet_hours", "يجب إدخال بداية ونهاية أوقات الهدوء معًا")
+	for _, value := range []*string{s.QuietHoursStart, s.QuietHoursEnd} {
+		if value != nil {
+			_, err := time.Parse("15:04", *value)
+			v.Check(err == nil, "quiet_hours", "صيغة أوقات الهدوء يجب أن تكون HH:MM")
+		}
+	}
+
+	v.Check(validator.In(s.Language, NotificationLanguages...), "language", "اللغة يجب أن تكون ar أو en")
+}
+
+// NotificationSubscriptionDB handles database operations for the
+// notification_subscriptions table
+type NotificationSubscriptionDB struct {
+	db *sqlx.DB
+}
+
+// UpsertSubscription creates the subscription for a device or replaces the
+// preferences of the existing one. A subscription that already belongs to a
+// user keeps its owner when the device re-subscribes anonymously.
+func (n *NotificationSubscriptionDB) UpsertSubscription(ctx context.Context, s *NotificationSubscription) error {
+	query, args, err := QB.Insert("notification_subscriptions").
+		Columns("user_id", "device_token", "section_id", "prayers", "reminder_offset_minutes",
+			"quiet_hours_start", "quiet_hours_end", "language").
+		Values(s.UserID, s.DeviceToken, s.SectionID, s.Prayers, s.ReminderOffsetMinutes,
+			s.QuietHoursStart, s.QuietHoursEnd, s.Language).
+		Suffix(`ON CONFLICT (device_token) DO UPDATE SET
+			user_id = COALESCE(EXCLUDED.user_id, notification_subscriptions.user_id),
+			section_id = EXCLUDED.section_id,
+			prayers = EXCLUDED.prayers,
+			reminder_offset_minutes = EXCLUDED.reminder_offset_minutes,
+			quiet_hours_start = EXCLUDED.quiet_hours_start,
+			quiet_hours_end = EXCLUDED.quiet_hours_end,
+			language = EXCLUDED.language,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, user_id, created_at, updated_at`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	err = n.db.QueryRowxContext(ctx, query, args...).Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" { // foreign_key_violation
+			return ErrSectionNotFound
+		}
+		return fmt.Errorf("خطأ في حفظ الاشتراك: %v", err)
+	}
+
+	return nil
+}
+
+// GetSubscriptionByToken retrieves the subscription of a device
+func (n *NotificationSubscriptionDB) GetSubscriptionByToken(ctx context.Context, token string) (*NotificationSubscription, error) {
+	var s NotificationSubscription
+	query, args, err := QB.Select(notificationSubscriptionColumns...).
+		From("notification_subscriptions").
+		Where(squirrel.Eq{"device_token": token}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	err = n.db.GetContext(ctx, &s, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotificationSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("خطأ في جلب الاشتراك: %v", err)
+	}
+
+	return &s, nil
+}
+
+// ListSubscriptionsBySection retrieves every subscription of a section
+func (n *NotificationSubscriptionDB) ListSubscriptionsBySection(ctx context.Context, sectionID int) ([]NotificationSubscription, error) {
+	var subscriptions []NotificationSubscription
+	query, args, err := QB.Select(notificationSubscriptionColumns...).
+		From("notification_subscriptions").
+		Where(squirrel.Eq{"section_id": sectionID}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	if err := n.db.SelectContext(ctx, &subscriptions, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب الاشتراكات: %v", err)
+	}
+
+	return subscriptions, nil
+}
+
+// ListSubscriptionsByUser retrieves the subscriptions of all of a user's
+// devices
+func (n *NotificationSubscriptionDB) ListSubscriptionsByUser(ctx context.Context, userID string) ([]NotificationSubscription, error) {
+	subscriptions := []NotificationSubscription{}
+	query, args, err := QB.Select(notificationSubscriptionColumns...).
+		From("notification_subscriptions").
+		Where(squirrel.Eq{"user_id": userID}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	if err := n.db.SelectContext(ctx, &subscriptions, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب الاشتراكات: %v", err)
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscriptionByToken removes the subscription of a device
+func (n *NotificationSubscriptionDB) DeleteSubscriptionByToken(ctx context.Context, token string) error {
+	query, args, err := QB.Delete("notification_subscriptions").
+		Where(squirrel.Eq{"device_token": token}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	result, err := n.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("خطأ في حذف الاشتراك: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("خطأ في التحقق من الحذف: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotificationSubscriptionNotFound
+	}
+
+	return nil
+}
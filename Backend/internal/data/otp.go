@@ -0,0 +1,205 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"project/utils"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// What a one-time code was sent for; a code only works for its purpose.
+const (
+	OTPPurposeVerifyPhone   = "verify_phone"
+	OTPPurposeResetPassword = "reset_password"
+)
+
+// Errors specific to one-time codes
+var (
+	ErrOTPInvalid         = errors.New("رمز التحقق غير صحيح")
+	ErrOTPExpired         = errors.New("رمز التحقق منتهي الصلاحية، يرجى طلب رمز جديد")
+	ErrOTPTooManyAttempts = errors.New("تم تجاوز عدد المحاولات المسموح بها، يرجى طلب رمز جديد")
+	ErrOTPCooldown        = errors.New("يرجى الانتظار قبل طلب رمز جديد")
+)
+
+// OTPCode represents a record in the otp_codes table.
+type OTPCode struct {
+	ID          int64      `db:"id" json:"id"`
+	PhoneNumber string     `db:"phone_number" json:"phone_number"`
+	Purpose     string     `db:"purpose" json:"purpose"`
+	CodeHash    string     `db:"code_hash" json:"-"`
+	Attempts    int        `db:"attempts" json:"attempts"`
+	ExpiresAt   time.Time  `db:"expires_at" json:"expires_at"`
+	ConsumedAt  *time.Time `db:"consumed_at" json:"consumed_at"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
+
+// OTPDB handles database operations for the otp_codes table
+type OTPDB struct {
+	db *sqlx.DB
+}
+
+// lockOTP serializes code requests and checks for one phone number and
+// purpose until the transaction ends.
+func lockOTP(ctx context.Context, tx *sqlx.Tx, phoneNumber, purpose string) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "otp:"+purpose+":"+phoneNumber); err != nil {
+		return fmt.Errorf("خطأ في قفل رمز التحقق: %v", err)
+	}
+	return nil
+}
+
+// Create stores the hash of a new code for the phone number and retires any
+// earlier one for the same purpose. It returns when the next code may be
+// requested; within cooldown of the previous code it stores nothing and
+// returns ErrOTPCooldown with the time the wait ends. The code is only hashed
+// once the cooldown has passed, so requests turned away cost no bcrypt.
+func (o *OTPDB) Create(ctx context.Context, phoneNumber, purpose, code string, ttl, cooldown time.Duration) (time.Time, error) {
+	tx, err := o.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في بدء المعاملة: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockOTP(ctx, tx, phoneNumber, purpose); err != nil {
+		return time.Time{}, err
+	}
+
+	var lastSent time.Time
+	query, args, err := QB.Select("created_at").
+		From("otp_codes").
+		Where(squirrel.Eq{"phone_number": phoneNumber, "purpose": purpose}).
+		OrderBy("created_at DESC").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	err = tx.GetContext(ctx, &lastSent, query, args...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("خطأ في جلب رمز التحقق: %v", err)
+	}
+	if err == nil && time.Since(lastSent) < cooldown {
+		return lastSent.Add(cooldown), ErrOTPCooldown
+	}
+
+	codeHash, err := utils.HashPassword(code)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في تشفير رمز التحقق: %v", err)
+	}
+
+	query, args, err = QB.Update("otp_codes").
+		Set("consumed_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(squirrel.Eq{"phone_number": phoneNumber, "purpose": purpose}).
+		Where("consumed_at IS NULL").
+		ToSql()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في إلغاء رموز التحقق السابقة: %v", err)
+	}
+
+	now := time.Now()
+	query, args, err = QB.Insert("otp_codes").
+		Columns("phone_number", "purpose", "code_hash", "expires_at").
+		Values(phoneNumber, purpose, codeHash, now.Add(ttl)).
+		ToSql()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في حفظ رمز التحقق: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
+	}
+
+	return now.Add(cooldown), nil
+}
+
+// Verify checks code against the latest code sent to the phone number for
+// purpose and uses it up on a match. A wrong code counts as an attempt;
+// after maxAttempts the code stops working even if the right one is given.
+func (o *OTPDB) Verify(ctx context.Context, phoneNumber, purpose, code string, maxAttempts int) error {
+	tx, err := o.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("خطأ في بدء المعاملة: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockOTP(ctx, tx, phoneNumber, purpose); err != nil {
+		return err
+	}
+
+	var otp OTPCode
+	query, args, err := QB.Select("id", "phone_number", "purpose", "code_hash", "attempts", "expires_at", "consumed_at", "created_at").
+		From("otp_codes").
+		Where(squirrel.Eq{"phone_number": phoneNumber, "purpose": purpose}).
+		Where("consumed_at IS NULL").
+		OrderBy("created_at DESC").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	if err := tx.GetContext(ctx, &otp, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOTPExpired
+		}
+		return fmt.Errorf("خطأ في جلب رمز التحقق: %v", err)
+	}
+
+	if time.Now().After(otp.ExpiresAt) {
+		return ErrOTPExpired
+	}
+	if otp.Attempts >= maxAttempts {
+		return ErrOTPTooManyAttempts
+	}
+
+	update := QB.Update("otp_codes").Where(squirrel.Eq{"id": otp.ID})
+	matched := utils.CheckPassword(otp.CodeHash, code)
+	if matched {
+		update = update.Set("consumed_at", squirrel.Expr("CURRENT_TIMESTAMP"))
+	} else {
+		update = update.Set("attempts", squirrel.Expr("attempts + 1"))
+	}
+	query, args, err = update.ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("خطأ في تحديث رمز التحقق: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
+	}
+
+	if !matched {
+		return ErrOTPInvalid
+	}
+	return nil
+}
+
+// DeleteExpired removes codes that can no longer be used.
+func (o *OTPDB) DeleteExpired(ctx context.Context) (int64, error) {
+	query, args, err := QB.Delete("otp_codes").
+		Where("expires_at < CURRENT_TIMESTAMP").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	result, err := o.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في حذف رموز التحقق المنتهية: %v", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,248 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Permissions seeded by the permissions migration
+const (
+	PermUsersRead          = "users:read"
+	PermUsersWrite         = "users:write"
+	PermRolesManage        = "roles:manage"
+	PermSectionsWrite      = "sections:write"
+	PermPrayerTimesWrite   = "prayer_times:write"
+	PermHadithsWrite       = "hadiths:write"
+	PermAdhkarWrite        = "adhkar:write"
+	PermSpecialTopicsWrite = "special_topics:write"
+	PermNotificationsRead  = "notifications:read"
+	PermAuditRead          = "audit:read"
+)
+
+// Errors specific to permissions
+var (
+	ErrPermissionNotFound    = errors.New("الصلاحية غير موجودة")
+	ErrDuplicatedPermission  = errors.New("المستخدم لديه هذه الصلاحية بالفعل")
+	ErrUserPermissionMissing = errors.New("المستخدم ليس لديه هذه الصلاحية")
+)
+
+// Permission represents a record in the permissions table, with the roles
+// that grant it.
+type Permission struct {
+	ID          int            `db:"id" json:"id"`
+	Name        string         `db:"name" json:"name"`
+	Description string         `db:"description" json:"description"`
+	Roles       pq.StringArray `db:"roles" json:"roles"`
+}
+
+// UserPermission represents a record in the user_permissions table: a
+// permission granted to one user directly, everywhere or for one section.
+type UserPermission struct {
+	ID          int       `db:"id" json:"id"`
+	UserID      uuid.UUID `db:"user_id" json:"user_id"`
+	Permission  string    `db:"permission" json:"permission"`
+	SectionID   *int      `db:"section_id" json:"section_id"`
+	SectionName *string   `db:"section_name" json:"section_name"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// PermissionSet is everything a user may do: permissions held everywhere,
+// through a role or a direct grant, and permissions held for some sections.
+type PermissionSet struct {
+	global   map[string]bool
+	sections map[string]map[int]bool
+}
+
+// Allows reports whether the set grants permission. A sectionID of zero
+// asks for the permission everywhere; otherwise a grant for that section is
+// enough.
+func (p *PermissionSet) Allows(permission string, sectionID int) bool {
+	if p.global[permission] {
+		return true
+	}
+	return sectionID != 0 && p.sections[permission][sectionID]
+}
+
+// AllowsSomeSection reports whether the set grants permission everywhere or
+// for at least one section.
+func (p *PermissionSet) AllowsSomeSection(permission string) bool {
+	return p.global[permission] || len(p.sections[permission]) > 0
+}
+
+// MarshalJSON lists the permissions held everywhere and, per permission, the
+// sections it is held for.
+func (p *PermissionSet) MarshalJSON() ([]byte, error) {
+	global := make([]string, 0, len(p.global))
+	for name := range p.global {
+		global = append(global, name)
+	}
+	sort.Strings(global)
+
+	sections := make(map[string][]int, len(p.sections))
+	for name, ids := range p.sections {
+		for id := range ids {
+			sections[name] = append(sections[name], id)
+		}
+		sort.Ints(sections[name])
+	}
+
+	return json.Marshal(struct {
+		Global   []string         `json:"global"`
+		Sections map[string][]int `json:"sections"`
+	}{global, sections})
+}
+
+// PermissionDB handles database operations for permissions and their grants
+type PermissionDB struct {
+	db *sqlx.DB
+}
+
+// ForUser returns the permissions the user holds through roles and direct
+// grants.
+func (p *PermissionDB) ForUser(ctx context.Context, userID uuid.UUID) (*PermissionSet, error) {
+	const query = `
+		SELECT p.name, NULL::INT AS section_id
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = $1
+		UNION
+		SELECT p.name, up.section_id
+		FROM user_permissions up
+		JOIN permissions p ON p.id = up.permission_id
+		WHERE up.user_id = $1`
+
+	var rows []struct {
+		Name      string `db:"name"`
+		SectionID *int   `db:"section_id"`
+	}
+	if err := p.db.SelectContext(ctx, &rows, query, userID); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب صلاحيات المستخدم: %v", err)
+	}
+
+	set := &PermissionSet{global: map[string]bool{}, sections: map[string]map[int]bool{}}
+	for _, row := range rows {
+		if row.SectionID == nil {
+			set.global[row.Name] = true
+			continue
+		}
+		if set.sections[row.Name] == nil {
+			set.sections[row.Name] = map[int]bool{}
+		}
+		set.sections[row.Name][*row.SectionID] = true
+	}
+
+	return set, nil
+}
+
+// ListPermissions retrieves every permission with the roles that grant it
+func (p *PermissionDB) ListPermissions(ctx context.Context) ([]Permission, error) {
+	query, args, err := QB.Select("permissions.id", "permissions.name", "permissions.description",
+		"COALESCE(array_agg(roles.name ORDER BY roles.id) FILTER (WHERE roles.id IS NOT NULL), '{}') AS roles").
+		From("permissions").
+		LeftJoin("role_permissions ON role_permissions.permission_id = permissions.id").
+		LeftJoin("roles ON roles.id = role_permissions.role_id").
+		GroupBy("permissions.id").
+		OrderBy("permissions.name").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	permissions := []Permission{}
+	if err := p.db.SelectContext(ctx, &permissions, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب الصلاحيات: %v", err)
+	}
+	return permissions, nil
+}
+
+// ListUserPermissions retrieves the permissions granted to the user directly
+func (p *PermissionDB) ListUserPermissions(ctx context.Context, userID uuid.UUID) ([]UserPermission, error) {
+	query, args, err := QB.Select("user_permissions.id", "user_permissions.user_id", "permissions.name AS permission",
+		"user_permissions.section_id", "sections.name AS section_name", "user_permissions.created_at").
+		From("user_permissions").
+		Join("permissions ON permissions.id = user_permissions.permission_id").
+		LeftJoin("sections ON sections.id = user_permissions.section_id").
+		Where(squirrel.Eq{"user_permissions.user_id": userID}).
+		OrderBy("permissions.name", "sections.name").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	grants := []UserPermission{}
+	if err := p.db.SelectContext(ctx, &grants, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب صلاحيات المستخدم: %v", err)
+	}
+	return grants, nil
+}
+
+// GrantToUser grants a permission to the user, for one section when
+// sectionID is set and everywhere otherwise.
+func (p *PermissionDB) GrantToUser(ctx context.Context, userID uuid.UUID, permission string, sectionID *int) error {
+	const query = `
+		INSERT INTO user_permissions (user_id, permission_id, section_id)
+		SELECT $1::UUID, id, $3::INT FROM permissions WHERE name = $2`
+
+	result, err := p.db.ExecContext(ctx, query, userID, permission, sectionID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch {
+			case pqErr.Code == "23505":
+				return ErrDuplicatedPermission
+			case pqErr.Constraint == "user_permissions_user_id_fkey":
+				return ErrUserNotFound
+			case pqErr.Constraint == "user_permissions_section_id_fkey":
+				return ErrSectionNotFound
+			}
+		}
+		return fmt.Errorf("خطأ في منح الصلاحية: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrPermissionNotFound
+	}
+
+	return nil
+}
+
+// RevokeFromUser removes a permission granted to the user directly, for the
+// same section (or everywhere) it was granted for.
+func (p *PermissionDB) RevokeFromUser(ctx context.Context, userID uuid.UUID, permission string, sectionID *int) error {
+	query, args, err := QB.Delete("user_permissions").
+		Where(squirrel.Eq{"user_id": userID}).
+		Where("permission_id = (SELECT id FROM permissions WHERE name = ?)", permission).
+		Where("section_id IS NOT DISTINCT FROM ?::INT", sectionID).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	result, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("خطأ في سحب الصلاحية: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserPermissionMissing
+	}
+
+	return nil
+}
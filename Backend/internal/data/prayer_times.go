@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"project/utils/validator"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 )
@@ -32,8 +34,36 @@ type PrayerTimes struct {
 	Name      string    `db:"name" json:"name"`             // Add this field to map s.name
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	// Derived is set on rows taken from the section's parent
+	Derived bool `db:"derived" json:"derived,omitempty"`
+}
+
+// PrayerColumns maps the prayer names shifts and offsets use to their
+// columns.
+var PrayerColumns = map[string]string{
+	"fajr_first":  "fajr_first_time",
+	"fajr_second": "fajr_second_time",
+	"sunrise":     "sunrise_time",
+	"dhuhr":       "dhuhr_time",
+	"asr":         "asr_time",
+	"maghrib":     "maghrib_time",
+	"isha":        "isha_time",
 }
 
+// Sources reported alongside prayer times so clients can tell curated
+// timetable rows from calculated ones and from rows derived from a parent
+// section.
+const (
+	PrayerTimesSourceTable      = "table"
+	PrayerTimesSourceCalculated = "calculated"
+	PrayerTimesSourceDerived    = "derived"
+)
+
+// effectivePrayerTimes is the view of the prayer times every section uses,
+// its own and those derived from its parent.
+const effectivePrayerTimes = "effective_prayer_times"
+
 type PrayerTimesResponse struct {
 	ID             int    `db:"id" json:"id"`
 	Day            int    `db:"day" json:"day"`
@@ -49,6 +79,7 @@ type PrayerTimesResponse struct {
 	Name           string `db:"name" json:"name"`
 	CreatedAt      string `db:"created_at" json:"created_at"`
 	UpdatedAt      string `db:"updated_at" json:"updated_at"`
+	Derived        bool   `db:"derived" json:"derived,omitempty"`
 }
 
 func (pt *PrayerTimes) ToResponse() PrayerTimesResponse {
@@ -67,6 +98,7 @@ func (pt *PrayerTimes) ToResponse() PrayerTimesResponse {
 		Name:           pt.Name,
 		CreatedAt:      pt.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:      pt.UpdatedAt.Format(time.RFC3339),
+		Derived:        pt.Derived,
 	}
 }
 
@@ -81,6 +113,12 @@ func ValidatePrayerTimes(v *validator.Validator, pt *PrayerTimes, fields ...stri
 		switch field {
 		case "day":
 			v.Check(pt.Day >= 1 && pt.Day <= 31, "day", "اليوم يجب أن يكون بين 1 و31")
+			if pt.Month >= 1 && pt.Month <= 12 {
+				// Year 2000 is a leap year, so 29 February is accepted; a day
+				// the month lacks rolls over into the next one
+				date := time.Date(2000, time.Month(pt.Month), pt.Day, 0, 0, 0, 0, time.UTC)
+				v.Check(date.Day() == pt.Day, "day", "اليوم غير موجود في هذا الشهر")
+			}
 		case "month":
 			v.Check(pt.Month >= 1 && pt.Month <= 12, "month", "الشهر يجب أن يكون بين 1 و12")
 		case "fajr_first_time":
@@ -104,10 +142,10 @@ func ValidatePrayerTimes(v *validator.Validator, pt *PrayerTimes, fields ...stri
 }
 
 // GetSectionIDByName retrieves the section ID by its name.
-func (pt *PrayerTimesDB) GetSectionIDByName(name string) (int, error) {
+func (pt *PrayerTimesDB) GetSectionIDByName(ctx context.Context, name string) (int, error) {
 	var id int
 	query := "SELECT id FROM sections WHERE name = $1"
-	err := pt.db.QueryRow(query, name).Scan(&id)
+	err := pt.db.QueryRowContext(ctx, query, name).Scan(&id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, errors.New("القسم غير موجود")
@@ -119,7 +157,7 @@ func (pt *PrayerTimesDB) GetSectionIDByName(name string) (int, error) {
 
 // InsertPrayerTimes inserts a new prayer times record.
 // InsertPrayerTimes inserts a new prayer times record.
-func (pt *PrayerTimesDB) InsertPrayerTimes(prayer *PrayerTimes) error {
+func (pt *PrayerTimesDB) InsertPrayerTimes(ctx context.Context, prayer *PrayerTimes) error {
 	query, args, err := QB.Insert("prayer_times").
 		Columns(
 			"day", "month", "fajr_first_time", "fajr_second_time",
@@ -137,7 +175,7 @@ func (pt *PrayerTimesDB) InsertPrayerTimes(prayer *PrayerTimes) error {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = pt.db.QueryRowx(query, args...).StructScan(prayer)
+	err = pt.db.QueryRowxContext(ctx, query, args...).StructScan(prayer)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Constraint == "prayer_times_day_month_section_id_key" {
@@ -150,22 +188,23 @@ func (pt *PrayerTimesDB) InsertPrayerTimes(prayer *PrayerTimes) error {
 	return nil
 }
 
-// GetPrayerTimes retrieves a prayer times record by day, month, and section_id.
-func (pt *PrayerTimesDB) GetPrayerTimes(day, month, sectionID int) (*PrayerTimes, error) {
+// GetPrayerTimes retrieves a prayer times record by day, month, and
+// section_id, derived from the section's parent when it has none of its own.
+func (pt *PrayerTimesDB) GetPrayerTimes(ctx context.Context, day, month, sectionID int) (*PrayerTimes, error) {
 	var prayer PrayerTimes
 	query, args, err := QB.Select(
 		"id", "day", "month", "fajr_first_time", "fajr_second_time", // "day_name" corrected to "day"
 		"sunrise_time", "dhuhr_time", "asr_time", "maghrib_time",
-		"isha_time", "section_id", "created_at", "updated_at", // Changed from "section"
+		"isha_time", "section_id", "created_at", "updated_at", "derived", // Changed from "section"
 	).
-		From("prayer_times").
+		From(effectivePrayerTimes).
 		Where(squirrel.Eq{"day": day, "month": month, "section_id": sectionID}). // Changed from "section"
 		ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = pt.db.Get(&prayer, query, args...)
+	err = pt.db.GetContext(ctx, &prayer, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrPrayerTimesNotFound
@@ -176,8 +215,19 @@ func (pt *PrayerTimesDB) GetPrayerTimes(day, month, sectionID int) (*PrayerTimes
 	return &prayer, nil
 }
 
-// DeletePrayerTimes deletes a prayer times record by day, month, and section_id.
-func (pt *PrayerTimesDB) DeletePrayerTimes(day, month, sectionID int) error {
+// DeletePrayerTimes deletes a prayer times record by day, month, and
+// section_id, keeping the deleted values as a revision.
+func (pt *PrayerTimesDB) DeletePrayerTimes(ctx context.Context, day, month, sectionID int, changedBy *uuid.UUID) error {
+	tx, err := pt.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("خطأ في بدء المعاملة: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := saveRevision(ctx, tx, day, month, sectionID, RevisionDelete, changedBy); err != nil {
+		return err
+	}
+
 	query, args, err := QB.Delete("prayer_times").
 		Where(squirrel.Eq{"day": day, "month": month, "section_id": sectionID}). // Changed from "section"
 		ToSql()
@@ -185,51 +235,32 @@ func (pt *PrayerTimesDB) DeletePrayerTimes(day, month, sectionID int) error {
 		return fmt.Errorf("خطأ في إنشاء استعلام الحذف: %v", err)
 	}
 
-	result, err := pt.db.Exec(query, args...)
-	if err != nil {
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 		return fmt.Errorf("خطأ في حذف مواقيت الصلاة: %v", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
-	}
-	if rowsAffected == 0 {
-		return ErrPrayerTimesNotFound
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
 	}
 
 	return nil
 }
 
-// UpdatePrayerTimes updates an existing prayer times record.
-func (pt *PrayerTimesDB) UpdatePrayerTimes(prayer *PrayerTimes) error {
-	// First check if the record exists
-	originalPrayer, err := pt.GetPrayerTimes(prayer.Day, prayer.Month, prayer.SectionID)
+// UpdatePrayerTimes overwrites the times of an existing prayer times record,
+// keeping the values it replaces as a revision.
+func (pt *PrayerTimesDB) UpdatePrayerTimes(ctx context.Context, prayer *PrayerTimes, changedBy *uuid.UUID) error {
+	tx, err := pt.db.BeginTxx(ctx, nil)
 	if err != nil {
-		if errors.Is(err, ErrPrayerTimesNotFound) {
-			return ErrPrayerTimesNotFound
-		}
-		return fmt.Errorf("خطأ في التحقق من وجود مواقيت الصلاة: %v", err)
-	}
-
-	// First check if we're trying to update to a day/month/section combination that already exists
-	// We'll do this via direct query to avoid affecting the original prayer times
-	var count int
-	checkQuery := "SELECT COUNT(*) FROM prayer_times WHERE id != $1 AND day = $2 AND month = $3 AND section_id = $4"
-	err = pt.db.QueryRow(checkQuery, originalPrayer.ID, prayer.Day, prayer.Month, prayer.SectionID).Scan(&count)
-	if err != nil {
-		return fmt.Errorf("خطأ في التحقق من تكرار البيانات: %v", err)
+		return fmt.Errorf("خطأ في بدء المعاملة: %v", err)
 	}
+	defer tx.Rollback()
 
-	if count > 0 {
-		return ErrPrayerTimesAlreadyInserted
+	// Keep the current values; this also locks the row until commit
+	if err := saveRevision(ctx, tx, prayer.Day, prayer.Month, prayer.SectionID, RevisionUpdate, changedBy); err != nil {
+		return err
 	}
 
-	// If we reach here, it's safe to update all fields
-	updateQuery := QB.Update("prayer_times").
-		Set("day", prayer.Day).
-		Set("month", prayer.Month).
-		Set("section_id", prayer.SectionID).
+	query, args, err := QB.Update("prayer_times").
 		Set("fajr_first_time", prayer.FajrFirstTime).
 		Set("fajr_second_time", prayer.FajrSecondTime).
 		Set("sunrise_time", prayer.SunriseTime).
@@ -237,36 +268,23 @@ func (pt *PrayerTimesDB) UpdatePrayerTimes(prayer *PrayerTimes) error {
 		Set("asr_time", prayer.AsrTime).
 		Set("maghrib_time", prayer.MaghribTime).
 		Set("isha_time", prayer.IshaTime).
-		Set("updated_at", time.Now())
-
-	// Use the original ID to ensure we update the correct record
-	whereClause := squirrel.Eq{"id": originalPrayer.ID}
-
-	query, args, err := updateQuery.Where(whereClause).ToSql()
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"day": prayer.Day, "month": prayer.Month, "section_id": prayer.SectionID}).
+		ToSql()
 	if err != nil {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	result, err := pt.db.Exec(query, args...)
-	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Constraint == "prayer_times_day_month_section_id_key" {
-				return ErrPrayerTimesAlreadyInserted
-			}
-		}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 		return fmt.Errorf("خطأ في تحديث مواقيت الصلاة: %v", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
-	}
-	if rowsAffected == 0 {
-		return ErrPrayerTimesNotFound
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
 	}
 
 	// Fetch the updated record to return the complete object with updated timestamps
-	updatedPrayer, err := pt.GetPrayerTimes(prayer.Day, prayer.Month, prayer.SectionID)
+	updatedPrayer, err := pt.GetPrayerTimes(ctx, prayer.Day, prayer.Month, prayer.SectionID)
 	if err != nil {
 		return fmt.Errorf("خطأ في جلب البيانات المحدثة: %v", err)
 	}
@@ -277,7 +295,7 @@ func (pt *PrayerTimesDB) UpdatePrayerTimes(prayer *PrayerTimes) error {
 }
 
 // SearchPrayerTimes searches for prayer times by day, month, and section name.
-func (pt *PrayerTimesDB) SearchPrayerTimes(day, month int, sectionName string) ([]PrayerTimesResponse, error) {
+func (pt *PrayerTimesDB) SearchPrayerTimes(ctx context.Context, day, month int, sectionName string) ([]PrayerTimesResponse, error) {
 	var prayers []PrayerTimes
 
 	// Build the query with joins to get section name
@@ -287,8 +305,8 @@ func (pt *PrayerTimesDB) SearchPrayerTimes(day, month int, sectionName string) (
 		       pt.sunrise_time, pt.dhuhr_time, pt.asr_time, 
 		       pt.maghrib_time, pt.isha_time, 
 		       pt.section_id, s.name, 
-		       pt.created_at, pt.updated_at
-		FROM prayer_times pt
+		       pt.created_at, pt.updated_at, pt.derived
+		FROM effective_prayer_times pt
 		JOIN sections s ON pt.section_id = s.id
 		WHERE 1=1
 	`
@@ -326,7 +344,7 @@ func (pt *PrayerTimesDB) SearchPrayerTimes(day, month int, sectionName string) (
 	query += " ORDER BY pt.month, pt.day"
 
 	// Execute query
-	err := pt.db.Select(&prayers, query, args...)
+	err := pt.db.SelectContext(ctx, &prayers, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("خطأ في البحث عن مواقيت الصلاة: %v", err)
 	}
@@ -345,7 +363,7 @@ func (pt *PrayerTimesDB) SearchPrayerTimes(day, month int, sectionName string) (
 	return response, nil
 }
 
-func (pt *PrayerTimesDB) ListPrayerTimes(queryParams url.Values) ([]PrayerTimesResponse, *utils.Meta, error) {
+func (pt *PrayerTimesDB) ListPrayerTimes(ctx context.Context, queryParams url.Values) ([]PrayerTimesResponse, *utils.Meta, error) {
 	var prayers []PrayerTimes
 
 	// Define the columns to select
@@ -355,34 +373,35 @@ func (pt *PrayerTimesDB) ListPrayerTimes(queryParams url.Values) ([]PrayerTimesR
 		"pt.sunrise_time", "pt.dhuhr_time",
 		"pt.asr_time", "pt.maghrib_time", "pt.isha_time",
 		"s.name",
-		"pt.section_id", "pt.created_at", "pt.updated_at",
+		"pt.section_id", "pt.created_at", "pt.updated_at", "pt.derived",
 	}
 
 	// Define search columns and joins
 	searchCols := []string{"s.name"}
 	joinClause := []string{"sections s ON pt.section_id = s.id"}
 
-	// Get current date for ordering
-	now := time.Now()
-	currentDay := now.Day()
-	currentMonth := int(now.Month())
+	// "Today" is evaluated in each section's own zone so that rows for
+	// sections east and west of UTC roll over at their local midnight.
+	currentMonth := "EXTRACT(MONTH FROM now() AT TIME ZONE s.timezone)"
+	currentDay := "EXTRACT(DAY FROM now() AT TIME ZONE s.timezone)"
 
 	// Define custom ordering: prioritize dates from today onward
 	orderBy := []string{
-		fmt.Sprintf("CASE WHEN pt.month > %d OR (pt.month = %d AND pt.day >= %d) THEN 0 ELSE 1 END ASC", currentMonth, currentMonth, currentDay),
+		fmt.Sprintf("CASE WHEN pt.month > %[1]s OR (pt.month = %[1]s AND pt.day >= %[2]s) THEN 0 ELSE 1 END ASC", currentMonth, currentDay),
 		"pt.month ASC",
 		"pt.day ASC",
 	}
 
 	// Define filters to include all relevant data
-	query1 := fmt.Sprintf("(pt.month > %d OR (pt.month = %d AND pt.day >= %d))", currentMonth, currentMonth, currentDay)
-	query2 := fmt.Sprintf("(pt.month < %d OR (pt.month = %d AND pt.day < %d))", currentMonth, currentMonth, currentDay)
+	query1 := fmt.Sprintf("(pt.month > %[1]s OR (pt.month = %[1]s AND pt.day >= %[2]s))", currentMonth, currentDay)
+	query2 := fmt.Sprintf("(pt.month < %[1]s OR (pt.month = %[1]s AND pt.day < %[2]s))", currentMonth, currentDay)
 	additionalFilters := []string{fmt.Sprintf("(%s OR %s)", query1, query2)}
 
 	// Execute the custom query
 	meta, err := utils.BuildPrayerTimesQuery(
+		ctx,
 		&prayers,
-		"prayer_times pt",
+		effectivePrayerTimes+" pt",
 		joinClause,
 		columns,
 		searchCols,
@@ -402,3 +421,116 @@ func (pt *PrayerTimesDB) ListPrayerTimes(queryParams url.Values) ([]PrayerTimesR
 
 	return response, meta, nil
 }
+
+// ImportResult summarises a bulk import of prayer times.
+type ImportResult struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Skipped  int `json:"skipped"`
+}
+
+const importPrayerTimesQuery = `
+	INSERT INTO prayer_times (
+		day, month, fajr_first_time, fajr_second_time, sunrise_time,
+		dhuhr_time, asr_time, maghrib_time, isha_time, section_id
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT ON CONSTRAINT prayer_times_day_month_section_id_key `
+
+const importPrayerTimesUpsert = `DO UPDATE SET
+		fajr_first_time = EXCLUDED.fajr_first_time,
+		fajr_second_time = EXCLUDED.fajr_second_time,
+		sunrise_time = EXCLUDED.sunrise_time,
+		dhuhr_time = EXCLUDED.dhuhr_time,
+		asr_time = EXCLUDED.asr_time,
+		maghrib_time = EXCLUDED.maghrib_time,
+		isha_time = EXCLUDED.isha_time,
+		updated_at = NOW()
+	RETURNING (xmax = 0) AS inserted`
+
+const importPrayerTimesSkip = `DO NOTHING RETURNING true AS inserted`
+
+// ImportPrayerTimes inserts all prayers in a single transaction. Rows that
+// already exist for the same day, month and section are overwritten when
+// upsert is set, keeping the values they replace as revisions, and skipped
+// otherwise. With dryRun the transaction is rolled back after counting, so
+// nothing is persisted.
+func (pt *PrayerTimesDB) ImportPrayerTimes(ctx context.Context, prayers []*PrayerTimes, upsert, dryRun bool, changedBy *uuid.UUID) (*ImportResult, error) {
+	query := importPrayerTimesQuery + importPrayerTimesSkip
+	if upsert {
+		query = importPrayerTimesQuery + importPrayerTimesUpsert
+	}
+
+	tx, err := pt.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في بدء المعاملة: %v", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	defer stmt.Close()
+
+	var result ImportResult
+	for _, prayer := range prayers {
+		if upsert {
+			err := saveRevision(ctx, tx, prayer.Day, prayer.Month, prayer.SectionID, RevisionImport, changedBy)
+			if err != nil && !errors.Is(err, ErrPrayerTimesNotFound) {
+				return nil, err
+			}
+		}
+
+		var inserted bool
+		err := stmt.QueryRowContext(ctx,
+			prayer.Day, prayer.Month, prayer.FajrFirstTime, prayer.FajrSecondTime,
+			prayer.SunriseTime, prayer.DhuhrTime, prayer.AsrTime, prayer.MaghribTime,
+			prayer.IshaTime, prayer.SectionID,
+		).Scan(&inserted)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			result.Skipped++
+		case err != nil:
+			return nil, fmt.Errorf("خطأ في استيراد مواقيت يوم %d/%d: %v", prayer.Day, prayer.Month, err)
+		case inserted:
+			result.Inserted++
+		default:
+			result.Updated++
+		}
+	}
+
+	if dryRun {
+		return &result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
+	}
+	return &result, nil
+}
+
+// MaterializePrayerTimes stores the prayer times a section derives from its
+// parent as rows of its own, so later changes to the parent no longer reach
+// them. It returns how many rows were stored.
+func (pt *PrayerTimesDB) MaterializePrayerTimes(ctx context.Context, sectionID int) (int64, error) {
+	const query = `
+		INSERT INTO prayer_times (
+			day, month, fajr_first_time, fajr_second_time, sunrise_time,
+			dhuhr_time, asr_time, maghrib_time, isha_time, section_id
+		)
+		SELECT day, month, fajr_first_time, fajr_second_time, sunrise_time,
+			dhuhr_time, asr_time, maghrib_time, isha_time, section_id
+		FROM effective_prayer_times
+		WHERE section_id = $1 AND derived
+		ON CONFLICT ON CONSTRAINT prayer_times_day_month_section_id_key DO NOTHING`
+
+	result, err := pt.db.ExecContext(ctx, query, sectionID)
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في تثبيت مواقيت الصلاة المشتقة: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
+	}
+	return rowsAffected, nil
+}
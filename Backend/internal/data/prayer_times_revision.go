@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// What replaced the values a revision keeps
+const (
+	RevisionUpdate = "update"
+	RevisionDelete = "delete"
+	RevisionImport = "import"
+	RevisionRevert = "revert"
+	RevisionShift  = "shift"
+)
+
+var ErrRevisionNotFound = errors.New("نسخة مواقيت الصلاة غير موجودة")
+
+// PrayerTimesRevision represents a record in the prayer_times_revisions
+// table: a day's prayer times as they were before a change, with the change
+// that replaced them.
+type PrayerTimesRevision struct {
+	ID             int64      `db:"id"`
+	Day            int        `db:"day"`
+	Month          int        `db:"month"`
+	SectionID      int        `db:"section_id"`
+	FajrFirstTime  time.Time  `db:"fajr_first_time"`
+	FajrSecondTime time.Time  `db:"fajr_second_time"`
+	SunriseTime    time.Time  `db:"sunrise_time"`
+	DhuhrTime      time.Time  `db:"dhuhr_time"`
+	AsrTime        time.Time  `db:"asr_time"`
+	MaghribTime    time.Time  `db:"maghrib_time"`
+	IshaTime       time.Time  `db:"isha_time"`
+	Action         string     `db:"action"`
+	ChangedBy      *uuid.UUID `db:"changed_by"`
+	ChangedByName  *string    `db:"changed_by_name"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// PrayerTimes returns the prayer times the revision keeps.
+func (rev *PrayerTimesRevision) PrayerTimes() *PrayerTimes {
+	return &PrayerTimes{
+		Day:            rev.Day,
+		Month:          rev.Month,
+		SectionID:      rev.SectionID,
+		FajrFirstTime:  rev.FajrFirstTime,
+		FajrSecondTime: rev.FajrSecondTime,
+		SunriseTime:    rev.SunriseTime,
+		DhuhrTime:      rev.DhuhrTime,
+		AsrTime:        rev.AsrTime,
+		MaghribTime:    rev.MaghribTime,
+		IshaTime:       rev.IshaTime,
+	}
+}
+
+// MarshalJSON shows the kept prayer times in the same form as the prayer
+// times endpoints.
+func (rev *PrayerTimesRevision) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID            int64               `json:"id"`
+		Action        string              `json:"action"`
+		ChangedBy     *uuid.UUID          `json:"changed_by"`
+		ChangedByName *string             `json:"changed_by_name"`
+		CreatedAt     time.Time           `json:"created_at"`
+		PrayerTimes   PrayerTimesResponse `json:"prayer_times"`
+	}{rev.ID, rev.Action, rev.ChangedBy, rev.ChangedByName, rev.CreatedAt, rev.PrayerTimes().ToResponse()})
+}
+
+const revisionColumns = `day, month, section_id, fajr_first_time, fajr_second_time,
+		sunrise_time, dhuhr_time, asr_time, maghrib_time, isha_time`
+
+// saveRevision copies the stored prayer times for the day into
+// prayer_times_revisions and locks the row until tx ends. It returns
+// ErrPrayerTimesNotFound when the day has none.
+func saveRevision(ctx context.Context, tx *sqlx.Tx, day, month, sectionID int, action string, changedBy *uuid.UUID) error {
+	query := `
+		INSERT INTO prayer_times_revisions (` + revisionColumns + `, action, changed_by)
+		SELECT ` + revisionColumns + `, $4::TEXT, $5::UUID
+		FROM prayer_times
+		WHERE day = $1 AND month = $2 AND section_id = $3
+		FOR UPDATE`
+
+	result, err := tx.ExecContext(ctx, query, day, month, sectionID, action, changedBy)
+	if err != nil {
+		return fmt.Errorf("خطأ في حفظ نسخة مواقيت الصلاة: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrPrayerTimesNotFound
+	}
+
+	return nil
+}
+
+// ListRevisions retrieves the earlier versions of a day's prayer times,
+// newest first.
+func (pt *PrayerTimesDB) ListRevisions(ctx context.Context, day, month, sectionID int) ([]PrayerTimesRevision, error) {
+	query, args, err := QB.Select("prayer_times_revisions.*", "users.name AS changed_by_name").
+		From("prayer_times_revisions").
+		LeftJoin("users ON users.id = prayer_times_revisions.changed_by").
+		Where(squirrel.Eq{
+			"prayer_times_revisions.day":        day,
+			"prayer_times_revisions.month":      month,
+			"prayer_times_revisions.section_id": sectionID,
+		}).
+		OrderBy("prayer_times_revisions.id DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	revisions := []PrayerTimesRevision{}
+	if err := pt.db.SelectContext(ctx, &revisions, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب سجل مواقيت الصلاة: %v", err)
+	}
+	return revisions, nil
+}
+
+// GetRevision retrieves a revision by id.
+func (pt *PrayerTimesDB) GetRevision(ctx context.Context, id int64) (*PrayerTimesRevision, error) {
+	query, args, err := QB.Select("prayer_times_revisions.*", "users.name AS changed_by_name").
+		From("prayer_times_revisions").
+		LeftJoin("users ON users.id = prayer_times_revisions.changed_by").
+		Where(squirrel.Eq{"prayer_times_revisions.id": id}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	var revision PrayerTimesRevision
+	if err := pt.db.GetContext(ctx, &revision, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, fmt.Errorf("خطأ في جلب نسخة مواقيت الصلاة: %v", err)
+	}
+	return &revision, nil
+}
+
+// RevertPrayerTimes restores the prayer times a revision keeps, bringing the
+// day back if it was deleted. The values it replaces are kept as a revision
+// of their own, so a revert can be reverted too. It returns the restored
+// prayer times.
+func (pt *PrayerTimesDB) RevertPrayerTimes(ctx context.Context, revisionID int64, changedBy *uuid.UUID) (*PrayerTimes, error) {
+	revision, err := pt.GetRevision(ctx, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	prayer := revision.PrayerTimes()
+
+	tx, err := pt.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في بدء المعاملة: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = saveRevision(ctx, tx, prayer.Day, prayer.Month, prayer.SectionID, RevisionRevert, changedBy)
+	if err != nil && !errors.Is(err, ErrPrayerTimesNotFound) {
+		return nil, err
+	}
+
+	var inserted bool
+	err = tx.QueryRowContext(ctx, importPrayerTimesQuery+importPrayerTimesUpsert,
+		prayer.Day, prayer.Month, prayer.FajrFirstTime, prayer.FajrSecondTime,
+		prayer.SunriseTime, prayer.DhuhrTime, prayer.AsrTime, prayer.MaghribTime,
+		prayer.IshaTime, prayer.SectionID,
+	).Scan(&inserted)
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في استعادة مواقيت الصلاة: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
+	}
+
+	return pt.GetPrayerTimes(ctx, prayer.Day, prayer.Month, prayer.SectionID)
+}
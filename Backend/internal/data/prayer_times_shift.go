@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"project/utils/validator"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// MaxShiftMinutes bounds a single shift; larger corrections are better
+// made as a new import.
+const MaxShiftMinutes = 120
+
+// ErrShiftOutOfOrder is returned when a shift would move a prayer past
+// midnight or past a neighbouring prayer.
+var ErrShiftOutOfOrder = errors.New("التعديل يخرج بمواقيت الصلاة عن ترتيبها أو يتجاوز منتصف الليل")
+
+// prayerOrder lists the prayers in the order they fall in a day.
+var prayerOrder = []string{"fajr_first", "fajr_second", "sunrise", "dhuhr", "asr", "maghrib", "isha"}
+
+// PrayerTimesShift moves chosen prayers of a section by a number of minutes
+// on every day from FromMonth/FromDay to ToMonth/ToDay inclusive. A range
+// whose end comes before its start wraps over the new year.
+type PrayerTimesShift struct {
+	SectionID int
+	Prayers   []string
+	Minutes   int
+	FromMonth int
+	FromDay   int
+	ToMonth   int
+	ToDay     int
+}
+
+// ShiftedPrayerTimes is one day changed by a shift.
+type ShiftedPrayerTimes struct {
+	Day    int                 `json:"day"`
+	Month  int                 `json:"month"`
+	Before PrayerTimesResponse `json:"before"`
+	After  PrayerTimesResponse `json:"after"`
+}
+
+// ValidatePrayerTimesShift validates a shift.
+func ValidatePrayerTimesShift(v *validator.Validator, shift *PrayerTimesShift) {
+	v.Check(shift.SectionID > 0, "section", "القسم مطلوب")
+	v.Check(len(shift.Prayers) > 0, "prayers", "يجب اختيار صلاة واحدة على الأقل")
+	for _, prayer := range shift.Prayers {
+		_, ok := PrayerColumns[prayer]
+		v.Check(ok, "prayers", "صلاة غير معروفة: "+prayer)
+	}
+	v.Check(validator.Unique(shift.Prayers), "prayers", "لا يجب تكرار الصلوات")
+	v.Check(shift.Minutes != 0, "minutes", "عدد الدقائق مطلوب")
+	v.Check(shift.Minutes >= -MaxShiftMinutes && shift.Minutes <= MaxShiftMinutes, "minutes",
+		fmt.Sprintf("عدد الدقائق يجب أن يكون بين -%d و%d", MaxShiftMinutes, MaxShiftMinutes))
+}
+
+// checkOrder fails with ErrShiftOutOfOrder when the shift would move one of
+// the day's prayers out of the day or past a neighbouring prayer. Pairs the
+// shift does not touch are not compared.
+func (s *PrayerTimesShift) checkOrder(pt *PrayerTimes) error {
+	shifted := make(map[string]bool, len(s.Prayers))
+	for _, prayer := range s.Prayers {
+		shifted[prayer] = true
+	}
+
+	times := []time.Time{pt.FajrFirstTime, pt.FajrSecondTime, pt.SunriseTime, pt.DhuhrTime, pt.AsrTime, pt.MaghribTime, pt.IshaTime}
+	previous := 0
+	for i, prayer := range prayerOrder {
+		minute := times[i].Hour()*60 + times[i].Minute()
+		if shifted[prayer] {
+			minute += s.Minutes
+			if minute < 0 || minute >= 24*60 {
+				return fmt.Errorf("%w (%02d-%02d)", ErrShiftOutOfOrder, pt.Month, pt.Day)
+			}
+		}
+		if i > 0 && (shifted[prayer] || shifted[prayerOrder[i-1]]) && minute <= previous {
+			return fmt.Errorf("%w (%02d-%02d)", ErrShiftOutOfOrder, pt.Month, pt.Day)
+		}
+		previous = minute
+	}
+	return nil
+}
+
+// dayRange selects the rows of the shift's days.
+func (s *PrayerTimesShift) dayRange() squirrel.Sqlizer {
+	from := squirrel.Expr("(month, day) >= (?::INT, ?::INT)", s.FromMonth, s.FromDay)
+	to := squirrel.Expr("(month, day) <= (?::INT, ?::INT)", s.ToMonth, s.ToDay)
+	if s.ToMonth < s.FromMonth || (s.ToMonth == s.FromMonth && s.ToDay < s.FromDay) {
+		return squirrel.Or{from, to}
+	}
+	return squirrel.And{from, to}
+}
+
+// ShiftPrayerTimes applies a shift in one transaction, keeping each changed
+// day's previous values as a revision, and returns every changed day before
+// and after. A shift that would move a prayer past midnight or past its
+// neighbour fails with ErrShiftOutOfOrder and changes nothing. With dryRun
+// the transaction is rolled back, so the result is a preview.
+func (pt *PrayerTimesDB) ShiftPrayerTimes(ctx context.Context, shift *PrayerTimesShift, dryRun bool, changedBy *uuid.UUID) ([]ShiftedPrayerTimes, error) {
+	where := squirrel.And{squirrel.Eq{"section_id": shift.SectionID}, shift.dayRange()}
+
+	tx, err := pt.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في بدء المعاملة: %v", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := QB.Select("id", revisionColumns, "created_at", "updated_at").
+		From("prayer_times").
+		Where(where).
+		OrderBy("month", "day").
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	var before []PrayerTimes
+	if err := tx.SelectContext(ctx, &before, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب مواقيت الصلاة: %v", err)
+	}
+	if len(before) == 0 {
+		return []ShiftedPrayerTimes{}, nil
+	}
+	for i := range before {
+		if err := shift.checkOrder(&before[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keep every day's current values as a revision
+	query, args, err = QB.Select(revisionColumns).
+		Column("?::TEXT", RevisionShift).
+		Column("?::UUID", changedBy).
+		From("prayer_times").
+		Where(where).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	query = "INSERT INTO prayer_times_revisions (" + revisionColumns + ", action, changed_by) " + query
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في حفظ نسخ مواقيت الصلاة: %v", err)
+	}
+
+	update := QB.Update("prayer_times").Set("updated_at", squirrel.Expr("CURRENT_TIMESTAMP"))
+	for _, prayer := range shift.Prayers {
+		column := PrayerColumns[prayer]
+		update = update.Set(column, squirrel.Expr(column+" + make_interval(mins => ?::INT)", shift.Minutes))
+	}
+	query, args, err = update.Where(where).
+		Suffix("RETURNING id, " + revisionColumns + ", created_at, updated_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	var after []PrayerTimes
+	if err := tx.SelectContext(ctx, &after, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في تعديل مواقيت الصلاة: %v", err)
+	}
+
+	afterByID := make(map[int]PrayerTimes, len(after))
+	for _, prayer := range after {
+		afterByID[prayer.ID] = prayer
+	}
+	shifted := make([]ShiftedPrayerTimes, 0, len(before))
+	for _, prayer := range before {
+		changed := afterByID[prayer.ID]
+		shifted = append(shifted, ShiftedPrayerTimes{
+			Day:    prayer.Day,
+			Month:  prayer.Month,
+			Before: prayer.ToResponse(),
+			After:  changed.ToResponse(),
+		})
+	}
+
+	if dryRun {
+		return shifted, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
+	}
+	return shifted, nil
+}
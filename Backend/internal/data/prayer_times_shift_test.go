@@ -0,0 +1,84 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"project/utils/validator"
+)
+
+func TestValidatePrayerTimesShift(t *testing.T) {
+	tests := []struct {
+		name    string
+		prayers []string
+		minutes int
+		field   string
+	}{
+		{"valid", []string{"maghrib", "isha"}, 2, ""},
+		{"repeated prayer", []string{"maghrib", "maghrib"}, 2, "prayers"},
+		{"unknown prayer", []string{"duha"}, 2, "prayers"},
+		{"no prayers", nil, 2, "prayers"},
+		{"no minutes", []string{"asr"}, 0, "minutes"},
+		{"too many minutes", []string{"asr"}, MaxShiftMinutes + 1, "minutes"},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		ValidatePrayerTimesShift(v, &PrayerTimesShift{SectionID: 1, Prayers: tt.prayers, Minutes: tt.minutes})
+		if tt.field == "" {
+			if !v.Valid() {
+				t.Errorf("%s: unexpected errors %v", tt.name, v.Errors)
+			}
+			continue
+		}
+		if _, ok := v.Errors[tt.field]; !ok {
+			t.Errorf("%s: no error on %s (%v)", tt.name, tt.field, v.Errors)
+		}
+	}
+}
+
+func TestShiftCheckOrder(t *testing.T) {
+	clock := func(value string) time.Time {
+		parsed, err := time.Parse("15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	day := PrayerTimes{
+		Month:          6,
+		Day:            21,
+		FajrFirstTime:  clock("03:40"),
+		FajrSecondTime: clock("04:17"),
+		SunriseTime:    clock("05:59"),
+		DhuhrTime:      clock("13:09"),
+		AsrTime:        clock("16:52"),
+		MaghribTime:    clock("20:19"),
+		IshaTime:       clock("23:50"),
+	}
+
+	tests := []struct {
+		name    string
+		prayers []string
+		minutes int
+		ok      bool
+	}{
+		{"small correction", []string{"dhuhr"}, 2, true},
+		{"every prayer", []string{"fajr_first", "fajr_second", "sunrise", "dhuhr", "asr", "maghrib", "isha"}, -30, true},
+		{"isha past midnight", []string{"isha"}, 15, false},
+		{"fajr before midnight", []string{"fajr_first"}, -MaxShiftMinutes * 2, false},
+		{"fajr past sunrise", []string{"fajr_second"}, 105, false},
+		{"onto a neighbour", []string{"sunrise"}, -102, false},
+		{"neighbours moved together", []string{"fajr_second", "sunrise"}, 105, true},
+	}
+	for _, tt := range tests {
+		shift := &PrayerTimesShift{Prayers: tt.prayers, Minutes: tt.minutes}
+		err := shift.checkOrder(&day)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrShiftOutOfOrder) {
+			t.Errorf("%s: err = %v, want ErrShiftOutOfOrder", tt.name, err)
+		}
+	}
+}
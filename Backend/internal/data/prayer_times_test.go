@@ -0,0 +1,30 @@
+package data
+
+import (
+	"testing"
+
+	"project/utils/validator"
+)
+
+func TestValidatePrayerTimesDay(t *testing.T) {
+	tests := []struct {
+		month, day int
+		valid      bool
+	}{
+		{1, 31, true},
+		{2, 29, true},
+		{2, 30, false},
+		{4, 30, true},
+		{4, 31, false},
+		{12, 31, true},
+		{6, 0, false},
+		{6, 32, false},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		ValidatePrayerTimes(v, &PrayerTimes{Month: tt.month, Day: tt.day}, "day", "month")
+		if _, invalid := v.Errors["day"]; invalid == tt.valid {
+			t.Errorf("day %d/%d: valid %v, want %v (%v)", tt.day, tt.month, !invalid, tt.valid, v.Errors)
+		}
+	}
+}
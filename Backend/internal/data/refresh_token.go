@@ -0,0 +1,204 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Errors specific to refresh tokens
+var (
+	ErrRefreshTokenInvalid = errors.New("رمز التحديث غير صالح أو منتهي الصلاحية")
+	ErrRefreshTokenReused  = errors.New("تم استخدام رمز التحديث مسبقًا، تم إنهاء الجلسة")
+)
+
+// RefreshToken represents a record in the refresh_tokens table. The token
+// itself is only ever held by the client; the table keeps its hash.
+type RefreshToken struct {
+	ID        int64      `db:"id" json:"id"`
+	UserID    uuid.UUID  `db:"user_id" json:"user_id"`
+	FamilyID  uuid.UUID  `db:"family_id" json:"family_id"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `db:"used_at" json:"used_at"`
+	RevokedAt *time.Time `db:"revoked_at" json:"revoked_at"`
+	UserAgent *string    `db:"user_agent" json:"user_agent"`
+	IPAddress *string    `db:"ip_address" json:"ip_address"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// RefreshTokenDB handles database operations for the refresh_tokens table
+type RefreshTokenDB struct {
+	db *sqlx.DB
+}
+
+// hashRefreshToken returns the stored form of a token. Tokens are long and
+// random, so a plain SHA-256 is enough.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// insertRefreshToken generates a token for the family and stores its hash.
+func insertRefreshToken(ctx context.Context, q sqlx.QueryerContext, userID, familyID uuid.UUID, ttl time.Duration, userAgent, ip string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("خطأ في توليد رمز التحديث: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	query, args, err := QB.Insert("refresh_tokens").
+		Columns("user_id", "family_id", "token_hash", "expires_at", "user_agent", "ip_address").
+		Values(userID, familyID, hashRefreshToken(token), time.Now().Add(ttl), userAgent, ip).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	var id int64
+	if err := q.QueryRowxContext(ctx, query, args...).Scan(&id); err != nil {
+		return "", fmt.Errorf("خطأ في حفظ رمز التحديث: %v", err)
+	}
+
+	return token, nil
+}
+
+// Create starts a new session family for the user and returns its first
+// refresh token.
+func (t *RefreshTokenDB) Create(ctx context.Context, userID uuid.UUID, ttl time.Duration, userAgent, ip string) (string, error) {
+	return insertRefreshToken(ctx, t.db, userID, uuid.New(), ttl, userAgent, ip)
+}
+
+// Rotate uses up a refresh token and returns the next one of its family along
+// with the user it belongs to. Presenting a token that was already used means
+// it was copied, so the whole family is revoked and ErrRefreshTokenReused is
+// returned.
+func (t *RefreshTokenDB) Rotate(ctx context.Context, token string, ttl time.Duration, userAgent, ip string) (string, uuid.UUID, error) {
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", uuid.Nil, fmt.Errorf("خطأ في بدء المعاملة: %v", err)
+	}
+	defer tx.Rollback()
+
+	var current RefreshToken
+	query, args, err := QB.Select("id", "user_id", "family_id", "token_hash", "expires_at", "used_at", "revoked_at").
+		From("refresh_tokens").
+		Where(squirrel.Eq{"token_hash": hashRefreshToken(token)}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return "", uuid.Nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	if err := tx.GetContext(ctx, &current, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", uuid.Nil, ErrRefreshTokenInvalid
+		}
+		return "", uuid.Nil, fmt.Errorf("خطأ في جلب رمز التحديث: %v", err)
+	}
+
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return "", uuid.Nil, ErrRefreshTokenInvalid
+	}
+	if current.UsedAt != nil {
+		if err := revokeRefreshTokens(ctx, tx, squirrel.Eq{"family_id": current.FamilyID}); err != nil {
+			return "", uuid.Nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", uuid.Nil, fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
+		}
+		return "", uuid.Nil, ErrRefreshTokenReused
+	}
+
+	query, args, err = QB.Update("refresh_tokens").
+		Set("used_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(squirrel.Eq{"id": current.ID}).
+		ToSql()
+	if err != nil {
+		return "", uuid.Nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return "", uuid.Nil, fmt.Errorf("خطأ في تحديث رمز التحديث: %v", err)
+	}
+
+	next, err := insertRefreshToken(ctx, tx, current.UserID, current.FamilyID, ttl, userAgent, ip)
+	if err != nil {
+		return "", uuid.Nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", uuid.Nil, fmt.Errorf("خطأ في حفظ المعاملة: %v", err)
+	}
+
+	return next, current.UserID, nil
+}
+
+// RevokeFamily ends the session the token belongs to.
+func (t *RefreshTokenDB) RevokeFamily(ctx context.Context, token string) error {
+	var familyID uuid.UUID
+	query, args, err := QB.Select("family_id").
+		From("refresh_tokens").
+		Where(squirrel.Eq{"token_hash": hashRefreshToken(token)}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+	if err := t.db.GetContext(ctx, &familyID, query, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRefreshTokenInvalid
+		}
+		return fmt.Errorf("خطأ في جلب رمز التحديث: %v", err)
+	}
+
+	return revokeRefreshTokens(ctx, t.db, squirrel.Eq{"family_id": familyID})
+}
+
+// RevokeAllForUser ends every session of the user.
+func (t *RefreshTokenDB) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	return revokeRefreshTokens(ctx, t.db, squirrel.Eq{"user_id": userID})
+}
+
+func revokeRefreshTokens(ctx context.Context, e sqlx.ExecerContext, where squirrel.Eq) error {
+	query, args, err := QB.Update("refresh_tokens").
+		Set("revoked_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(where).
+		Where("revoked_at IS NULL").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	if _, err := e.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("خطأ في إلغاء رموز التحديث: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteExpired removes tokens that can no longer be used, keeping revoked
+// and used ones until they expire so reuse is still detected.
+func (t *RefreshTokenDB) DeleteExpired(ctx context.Context) (int64, error) {
+	query, args, err := QB.Delete("refresh_tokens").
+		Where("expires_at < CURRENT_TIMESTAMP").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	result, err := t.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في حذف رموز التحديث المنتهية: %v", err)
+	}
+
+	return result.RowsAffected()
+}
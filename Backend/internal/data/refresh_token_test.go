@@ -0,0 +1,175 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"project/internal/data/datatest"
+
+	"github.com/google/uuid"
+)
+
+// refreshTokenTable keeps the refresh_tokens rows of a scripted database.
+type refreshTokenTable struct {
+	rows []*refreshTokenRow
+}
+
+type refreshTokenRow struct {
+	id               int64
+	userID, familyID string
+	hash             string
+	expiresAt        time.Time
+	usedAt           driver.Value
+	revokedAt        driver.Value
+}
+
+func newRefreshTokenDB(t *testing.T) (*datatest.DB, *RefreshTokenDB, *refreshTokenTable) {
+	t.Helper()
+	db, conn := datatest.New()
+	t.Cleanup(func() { conn.Close() })
+	table := &refreshTokenTable{}
+
+	db.Handle("INSERT INTO refresh_tokens", func(_ string, args []driver.Value) (*datatest.Result, error) {
+		row := &refreshTokenRow{
+			id:        int64(len(table.rows) + 1),
+			userID:    args[0].(string),
+			familyID:  args[1].(string),
+			hash:      args[2].(string),
+			expiresAt: args[3].(time.Time),
+		}
+		table.rows = append(table.rows, row)
+		return &datatest.Result{Columns: []string{"id"}, Rows: [][]driver.Value{{row.id}}}, nil
+	})
+	db.Handle("FOR UPDATE", func(_ string, args []driver.Value) (*datatest.Result, error) {
+		result := &datatest.Result{Columns: []string{"id", "user_id", "family_id", "token_hash", "expires_at", "used_at", "revoked_at"}}
+		for _, row := range table.rows {
+			if row.hash == args[0] {
+				result.Rows = append(result.Rows, []driver.Value{row.id, row.userID, row.familyID, row.hash, row.expiresAt, row.usedAt, row.revokedAt})
+			}
+		}
+		return result, nil
+	})
+	db.Handle("SET used_at", func(_ string, args []driver.Value) (*datatest.Result, error) {
+		for _, row := range table.rows {
+			if row.id == args[0] {
+				row.usedAt = time.Now()
+				return &datatest.Result{RowsAffected: 1}, nil
+			}
+		}
+		return nil, nil
+	})
+	db.Handle("SET revoked_at", func(_ string, args []driver.Value) (*datatest.Result, error) {
+		result := &datatest.Result{}
+		for _, row := range table.rows {
+			if (row.familyID == args[0] || row.userID == args[0]) && row.revokedAt == nil {
+				row.revokedAt = time.Now()
+				result.RowsAffected++
+			}
+		}
+		return result, nil
+	})
+
+	model := NewModels(conn)
+	return db, &model.RefreshTokenDB, table
+}
+
+func TestRefreshTokenRotate(t *testing.T) {
+	_, tokens, table := newRefreshTokenDB(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	first, err := tokens.Create(ctx, userID, time.Hour, "test", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, owner, err := tokens.Rotate(ctx, first, time.Hour, "test", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != userID {
+		t.Errorf("Rotate returned user %s, want %s", owner, userID)
+	}
+	if second == first {
+		t.Error("Rotate returned the token it was given")
+	}
+	if len(table.rows) != 2 || table.rows[0].usedAt == nil || table.rows[1].familyID != table.rows[0].familyID {
+		t.Fatalf("the rotated token was not used up or its successor left the family")
+	}
+	if _, _, err := tokens.Rotate(ctx, second, time.Hour, "test", "192.0.2.1"); err != nil {
+		t.Errorf("rotating the new token: %v", err)
+	}
+
+	if _, _, err := tokens.Rotate(ctx, "never-issued", time.Hour, "test", "192.0.2.1"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("unknown token: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	db, tokens, table := newRefreshTokenDB(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	first, err := tokens.Create(ctx, userID, time.Hour, "phone", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := tokens.Rotate(ctx, first, time.Hour, "phone", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, _, err := tokens.Rotate(ctx, second, time.Hour, "phone", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another session of the same user
+	other, err := tokens.Create(ctx, userID, time.Hour, "laptop", "198.51.100.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy of the first token is replayed
+	before := len(db.Statements())
+	if _, _, err := tokens.Rotate(ctx, first, time.Hour, "thief", "203.0.113.9"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replayed token: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// The revocation is committed, not rolled back with the error
+	replay := db.Statements()[before:]
+	revoked, committed := false, false
+	for _, statement := range replay {
+		switch {
+		case strings.Contains(statement.Query, "SET revoked_at"):
+			revoked = strings.Contains(statement.Query, "family_id")
+		case statement.Query == "COMMIT":
+			committed = revoked
+		}
+	}
+	if !revoked || !committed {
+		t.Fatalf("replay did not commit a family revocation: %v", replay)
+	}
+	if len(table.rows) != 4 {
+		t.Errorf("replay issued a token: %d rows", len(table.rows))
+	}
+
+	// Every token of the family is dead, including the one not yet used
+	for i, row := range table.rows[:3] {
+		if row.revokedAt == nil {
+			t.Errorf("token %d of the family was not revoked", i+1)
+		}
+	}
+	if _, _, err := tokens.Rotate(ctx, third, time.Hour, "phone", "192.0.2.1"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Errorf("latest token of the family: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	// The user's other session carries on
+	if table.rows[3].revokedAt != nil {
+		t.Error("the other session was revoked")
+	}
+	if _, _, err := tokens.Rotate(ctx, other, time.Hour, "laptop", "198.51.100.7"); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+}
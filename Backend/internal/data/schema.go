@@ -0,0 +1,34 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SchemaDB reports on the database itself rather than on any one table.
+type SchemaDB struct {
+	db *sqlx.DB
+}
+
+// Ping checks that the database answers.
+func (s SchemaDB) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Version returns the migration the database is at, as recorded by
+// golang-migrate, and whether that migration failed halfway. A database
+// that was never migrated is at version 0.
+func (s SchemaDB) Version(ctx context.Context) (version int64, dirty bool, err error) {
+	err = s.db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("خطأ في قراءة إصدار قاعدة البيانات: %v", err)
+	}
+	return version, dirty, nil
+}
@@ -1,12 +1,19 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
+	"sync"
+	"time"
 
+	"project/internal/prayertime"
 	"project/utils"
+	"project/utils/validator"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
@@ -15,8 +22,149 @@ import (
 
 // Section represents a record in the sections table
 type Section struct {
-	ID   int    `db:"id" json:"id"`
-	Name string `db:"name" json:"name"`
+	ID                int      `db:"id" json:"id"`
+	Name              string   `db:"name" json:"name"`
+	Latitude          *float64 `db:"latitude" json:"latitude"`
+	Longitude         *float64 `db:"longitude" json:"longitude"`
+	Elevation         float64  `db:"elevation" json:"elevation"`
+	CalculationMethod string   `db:"calculation_method" json:"calculation_method"`
+	AsrMethod         string   `db:"asr_method" json:"asr_method"`
+	Timezone          string   `db:"timezone" json:"timezone"`
+	HijriAdjustment   int      `db:"hijri_adjustment" json:"hijri_adjustment"`
+
+	// A section with a parent follows the parent's timetable, shifted by
+	// PrayerOffsets, on days it has no prayer times of its own.
+	ParentSectionID *int          `db:"parent_section_id" json:"parent_section_id"`
+	PrayerOffsets   PrayerOffsets `db:"prayer_offsets" json:"prayer_offsets"`
+}
+
+// PrayerOffsets maps prayer names (the keys of PrayerColumns) to the minutes
+// a derived section's times differ from its parent's.
+type PrayerOffsets map[string]int
+
+// MaxPrayerOffsetMinutes bounds how far a derived section may differ from
+// its parent.
+const MaxPrayerOffsetMinutes = 60
+
+// Value stores the offsets as a JSON object.
+func (o PrayerOffsets) Value() (driver.Value, error) {
+	if o == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(map[string]int(o))
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Scan reads the offsets from a JSON object.
+func (o *PrayerOffsets) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*o = PrayerOffsets{}
+		return nil
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return fmt.Errorf("نوع غير متوقع لفروقات المواقيت: %T", src)
+	}
+	offsets := PrayerOffsets{}
+	if err := json.Unmarshal(raw, &offsets); err != nil {
+		return err
+	}
+	*o = offsets
+	return nil
+}
+
+// Defaults applied to sections created without explicit settings.
+const (
+	DefaultCalculationMethod = "egyptian"
+	DefaultAsrMethod         = "shafii"
+	DefaultSectionTimezone   = "Africa/Tripoli"
+)
+
+// NearestSection is a section together with its distance from a point
+type NearestSection struct {
+	Section
+	DistanceKm float64 `db:"distance_km" json:"distance_km"`
+}
+
+// haversineDistance computes the great-circle distance in kilometres between
+// a section and the given latitude/longitude. The square root is capped at 1,
+// as rounding can push it just past for nearly antipodal points, where ASIN
+// would fail.
+const haversineDistance = `6371 * 2 * ASIN(LEAST(1.0, SQRT(
+	POWER(SIN(RADIANS(latitude - ?) / 2), 2) +
+	COS(RADIANS(?)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - ?) / 2), 2)
+))) AS distance_km`
+
+// sectionColumns lists the columns selected whenever a full Section is loaded.
+var sectionColumns = []string{
+	"id", "name", "latitude", "longitude", "elevation", "calculation_method", "asr_method", "timezone",
+	"hijri_adjustment", "parent_section_id", "prayer_offsets",
+}
+
+// HasCoordinates reports whether prayer times can be calculated for the section.
+func (s *Section) HasCoordinates() bool {
+	return s.Latitude != nil && s.Longitude != nil
+}
+
+// locations caches loaded time zones by IANA name.
+var locations sync.Map
+
+// Location returns the section's time zone.
+func (s *Section) Location() (*time.Location, error) {
+	if loc, ok := locations.Load(s.Timezone); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("المنطقة الزمنية للقسم غير صالحة: %v", err)
+	}
+	locations.Store(s.Timezone, loc)
+	return loc, nil
+}
+
+// ValidateSection validates the section data.
+func ValidateSection(v *validator.Validator, section *Section) {
+	v.Check(section.Name != "", "name", "اسم القسم مطلوب")
+	v.Check(len(section.Name) <= 50, "name", "اسم القسم يجب ألا يتجاوز 50 حرفًا")
+
+	v.Check((section.Latitude == nil) == (section.Longitude == nil), "latitude", "يجب إدخال خط العرض وخط الطول معًا")
+	if section.Latitude != nil {
+		v.Check(*section.Latitude >= -90 && *section.Latitude <= 90, "latitude", "خط العرض يجب أن يكون بين -90 و90")
+	}
+	if section.Longitude != nil {
+		v.Check(*section.Longitude >= -180 && *section.Longitude <= 180, "longitude", "خط الطول يجب أن يكون بين -180 و180")
+	}
+	v.Check(section.Elevation >= -500 && section.Elevation <= 9000, "elevation", "الارتفاع يجب أن يكون بين -500 و9000 متر")
+
+	_, ok := prayertime.MethodByName(section.CalculationMethod)
+	v.Check(ok, "calculation_method", "طريقة الحساب غير مدعومة")
+	_, ok = prayertime.AsrMethodByName(section.AsrMethod)
+	v.Check(ok, "asr_method", "طريقة حساب العصر يجب أن تكون shafii أو hanafi")
+
+	v.Check(section.Timezone != "", "timezone", "المنطقة الزمنية مطلوبة")
+	if section.Timezone != "" {
+		_, err := time.LoadLocation(section.Timezone)
+		v.Check(err == nil, "timezone", "المنطقة الزمنية غير صالحة")
+	}
+
+	v.Check(section.HijriAdjustment >= -2 && section.HijriAdjustment <= 2, "hijri_adjustment", "تعديل التاريخ الهجري يجب أن يكون بين -2 و2")
+
+	if section.ParentSectionID != nil {
+		v.Check(*section.ParentSectionID != section.ID, "parent_section", "لا يمكن أن يكون القسم مرجعًا لنفسه")
+	}
+	for prayer, minutes := range section.PrayerOffsets {
+		_, ok := PrayerColumns[prayer]
+		v.Check(ok, "prayer_offsets", "صلاة غير معروفة: "+prayer)
+		v.Check(minutes >= -MaxPrayerOffsetMinutes && minutes <= MaxPrayerOffsetMinutes, "prayer_offsets",
+			fmt.Sprintf("فرق التوقيت يجب أن يكون بين -%d و%d دقيقة", MaxPrayerOffsetMinutes, MaxPrayerOffsetMinutes))
+	}
 }
 
 // SectionsDB handles database operations for the sections table
@@ -25,17 +173,20 @@ type SectionsDB struct {
 }
 
 // InsertSection inserts a new section into the sections table
-func (s *SectionsDB) InsertSection(section *Section) error {
+func (s *SectionsDB) InsertSection(ctx context.Context, section *Section) error {
 	query, args, err := QB.Insert("sections").
-		Columns("name").
-		Values(section.Name).
+		Columns("name", "latitude", "longitude", "elevation", "calculation_method", "asr_method", "timezone", "hijri_adjustment",
+			"parent_section_id", "prayer_offsets").
+		Values(section.Name, section.Latitude, section.Longitude, section.Elevation,
+			section.CalculationMethod, section.AsrMethod, section.Timezone, section.HijriAdjustment,
+			section.ParentSectionID, section.PrayerOffsets).
 		Suffix("RETURNING id").
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = s.db.QueryRowx(query, args...).Scan(&section.ID)
+	err = s.db.QueryRowxContext(ctx, query, args...).Scan(&section.ID)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // PostgreSQL unique_violation error code
@@ -49,9 +200,9 @@ func (s *SectionsDB) InsertSection(section *Section) error {
 }
 
 // GetSectionByID retrieves a section by its ID
-func (s *SectionsDB) GetSectionByID(id int) (*Section, error) {
+func (s *SectionsDB) GetSectionByID(ctx context.Context, id int) (*Section, error) {
 	var section Section
-	query, args, err := QB.Select("id", "name").
+	query, args, err := QB.Select(sectionColumns...).
 		From("sections").
 		Where(squirrel.Eq{"id": id}).
 		ToSql()
@@ -59,7 +210,7 @@ func (s *SectionsDB) GetSectionByID(id int) (*Section, error) {
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = s.db.Get(&section, query, args...)
+	err = s.db.GetContext(ctx, &section, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrSectionNotFound
@@ -71,9 +222,9 @@ func (s *SectionsDB) GetSectionByID(id int) (*Section, error) {
 }
 
 // GetSectionByName retrieves a section by its name
-func (s *SectionsDB) GetSectionByName(name string) (*Section, error) {
+func (s *SectionsDB) GetSectionByName(ctx context.Context, name string) (*Section, error) {
 	var section Section
-	query, args, err := QB.Select("id", "name").
+	query, args, err := QB.Select(sectionColumns...).
 		From("sections").
 		Where(squirrel.Eq{"name": name}).
 		ToSql()
@@ -81,7 +232,7 @@ func (s *SectionsDB) GetSectionByName(name string) (*Section, error) {
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = s.db.Get(&section, query, args...)
+	err = s.db.GetContext(ctx, &section, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrSectionNotFound
@@ -92,17 +243,80 @@ func (s *SectionsDB) GetSectionByName(name string) (*Section, error) {
 	return &section, nil
 }
 
-// UpdateSection updates the name of an existing section
-func (s *SectionsDB) UpdateSection(section *Section) error {
+// GetAllSections retrieves every section ordered by ID
+func (s *SectionsDB) GetAllSections(ctx context.Context) ([]Section, error) {
+	var sections []Section
+	query, args, err := QB.Select(sectionColumns...).
+		From("sections").
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	if err := s.db.SelectContext(ctx, &sections, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في جلب الأقسام: %v", err)
+	}
+
+	return sections, nil
+}
+
+// GetNearestSections retrieves up to limit sections closest to the given
+// point, nearest first. Sections without coordinates are ignored.
+func (s *SectionsDB) GetNearestSections(ctx context.Context, lat, lng float64, limit int) ([]NearestSection, error) {
+	var sections []NearestSection
+	query, args, err := QB.Select(sectionColumns...).
+		Column(squirrel.Expr(haversineDistance, lat, lat, lng)).
+		From("sections").
+		Where("latitude IS NOT NULL AND longitude IS NOT NULL").
+		OrderBy("distance_km").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	if err := s.db.SelectContext(ctx, &sections, query, args...); err != nil {
+		return nil, fmt.Errorf("خطأ في البحث عن أقرب قسم: %v", err)
+	}
+	if len(sections) == 0 {
+		return nil, ErrSectionNotFound
+	}
+
+	return sections, nil
+}
+
+// HasDerivedSections reports whether any section follows the section's
+// timetable.
+func (s *SectionsDB) HasDerivedSections(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM sections WHERE parent_section_id = $1)", id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("خطأ في التحقق من الأقسام التابعة: %v", err)
+	}
+	return exists, nil
+}
+
+// UpdateSection updates an existing section
+func (s *SectionsDB) UpdateSection(ctx context.Context, section *Section) error {
 	query, args, err := QB.Update("sections").
 		Set("name", section.Name).
+		Set("latitude", section.Latitude).
+		Set("longitude", section.Longitude).
+		Set("elevation", section.Elevation).
+		Set("calculation_method", section.CalculationMethod).
+		Set("asr_method", section.AsrMethod).
+		Set("timezone", section.Timezone).
+		Set("hijri_adjustment", section.HijriAdjustment).
+		Set("parent_section_id", section.ParentSectionID).
+		Set("prayer_offsets", section.PrayerOffsets).
 		Where(squirrel.Eq{"id": section.ID}).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	result, err := s.db.Exec(query, args...)
+	result, err := s.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // unique_violation
@@ -124,7 +338,7 @@ func (s *SectionsDB) UpdateSection(section *Section) error {
 }
 
 // DeleteSection deletes a section by its ID, handling foreign key constraints
-func (s *SectionsDB) DeleteSection(id int) error {
+func (s *SectionsDB) DeleteSection(ctx context.Context, id int) error {
 	query, args, err := QB.Delete("sections").
 		Where(squirrel.Eq{"id": id}).
 		ToSql()
@@ -132,9 +346,12 @@ func (s *SectionsDB) DeleteSection(id int) error {
 		return fmt.Errorf("خطأ في إنشاء استعلام الحذف: %v", err)
 	}
 
-	result, err := s.db.Exec(query, args...)
+	result, err := s.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Constraint == "sections_parent_section_id_fkey" {
+				return ErrSectionHasDerived
+			}
 			if pqErr.Code == "23503" { // PostgreSQL foreign_key_violation error code
 				return errors.New("لا يمكن حذف القسم لأنه يحتوي على مواقيت صلاة مرتبطة")
 			}
@@ -154,17 +371,18 @@ func (s *SectionsDB) DeleteSection(id int) error {
 }
 
 // ListSections lists all sections with pagination and filtering by name
-func (s *SectionsDB) ListSections(queryParams url.Values) ([]Section, *utils.Meta, error) {
+func (s *SectionsDB) ListSections(ctx context.Context, queryParams url.Values) ([]Section, *utils.Meta, error) {
 	var sections []Section
 
 	// Columns to select from the sections table
-	columns := []string{"id", "name"}
+	columns := sectionColumns
 
 	// Columns available for searching (only name in this case)
 	searchCols := []string{"name"}
 
 	// Build the query using a utility function (assumed to exist in utils package)
 	meta, err := utils.BuildQuery(
+		ctx,
 		&sections,
 		"sections",
 		nil, // No joins needed since sections is a standalone table
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -35,7 +36,7 @@ type SpecialTopicDB struct {
 }
 
 // InsertSpecialTopic inserts a new special topic into the special_topics table
-func (s *SpecialTopicDB) InsertSpecialTopic(topic *SpecialTopic) error {
+func (s *SpecialTopicDB) InsertSpecialTopic(ctx context.Context, topic *SpecialTopic) error {
 	query, args, err := QB.Insert("special_topics").
 		Columns("topic", "content").
 		Values(topic.Topic, topic.Content).
@@ -45,7 +46,7 @@ func (s *SpecialTopicDB) InsertSpecialTopic(topic *SpecialTopic) error {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = s.db.QueryRowx(query, args...).Scan(&topic.ID, &topic.CreatedAt, &topic.UpdatedAt)
+	err = s.db.QueryRowxContext(ctx, query, args...).Scan(&topic.ID, &topic.CreatedAt, &topic.UpdatedAt)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Code == "23505" { // PostgreSQL unique_violation error code
@@ -59,7 +60,7 @@ func (s *SpecialTopicDB) InsertSpecialTopic(topic *SpecialTopic) error {
 }
 
 // GetSpecialTopicByID retrieves a special topic by its ID
-func (s *SpecialTopicDB) GetSpecialTopicByID(id int) (*SpecialTopic, error) {
+func (s *SpecialTopicDB) GetSpecialTopicByID(ctx context.Context, id int) (*SpecialTopic, error) {
 	var topic SpecialTopic
 	query, args, err := QB.Select("id", "topic", "content", "created_at", "updated_at").
 		From("special_topics").
@@ -69,7 +70,7 @@ func (s *SpecialTopicDB) GetSpecialTopicByID(id int) (*SpecialTopic, error) {
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = s.db.Get(&topic, query, args...)
+	err = s.db.GetContext(ctx, &topic, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrSpecialTopicNotFound
@@ -81,7 +82,7 @@ func (s *SpecialTopicDB) GetSpecialTopicByID(id int) (*SpecialTopic, error) {
 }
 
 // UpdateSpecialTopic updates an existing special topic
-func (s *SpecialTopicDB) UpdateSpecialTopic(topic *SpecialTopic) error {
+func (s *SpecialTopicDB) UpdateSpecialTopic(ctx context.Context, topic *SpecialTopic) error {
 	query, args, err := QB.Update("special_topics").
 		Set("topic", topic.Topic).
 		Set("content", topic.Content).
@@ -92,7 +93,7 @@ func (s *SpecialTopicDB) UpdateSpecialTopic(topic *SpecialTopic) error {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	result, err := s.db.Exec(query, args...)
+	result, err := s.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("خطأ في تحديث الموضوع الخاص: %v", err)
 	}
@@ -109,7 +110,7 @@ func (s *SpecialTopicDB) UpdateSpecialTopic(topic *SpecialTopic) error {
 }
 
 // DeleteSpecialTopic deletes a special topic by its ID
-func (s *SpecialTopicDB) DeleteSpecialTopic(id int) error {
+func (s *SpecialTopicDB) DeleteSpecialTopic(ctx context.Context, id int) error {
 	query, args, err := QB.Delete("special_topics").
 		Where(squirrel.Eq{"id": id}).
 		ToSql()
@@ -117,7 +118,7 @@ func (s *SpecialTopicDB) DeleteSpecialTopic(id int) error {
 		return fmt.Errorf("خطأ في إنشاء استعلام الحذف: %v", err)
 	}
 
-	result, err := s.db.Exec(query, args...)
+	result, err := s.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("خطأ في حذف الموضوع الخاص: %v", err)
 	}
@@ -134,7 +135,7 @@ func (s *SpecialTopicDB) DeleteSpecialTopic(id int) error {
 }
 
 // ListSpecialTopics lists all special topics with pagination and filtering
-func (s *SpecialTopicDB) ListSpecialTopics(queryParams url.Values) ([]SpecialTopic, *utils.Meta, error) {
+func (s *SpecialTopicDB) ListSpecialTopics(ctx context.Context, queryParams url.Values) ([]SpecialTopic, *utils.Meta, error) {
 	var topics []SpecialTopic
 
 	// Columns to select from the special_topics table
@@ -145,6 +146,7 @@ func (s *SpecialTopicDB) ListSpecialTopics(queryParams url.Values) ([]SpecialTop
 
 	// Build the query using a utility function
 	meta, err := utils.BuildQuery(
+		ctx,
 		&topics,
 		"special_topics",
 		nil, // No joins needed
@@ -161,7 +163,7 @@ func (s *SpecialTopicDB) ListSpecialTopics(queryParams url.Values) ([]SpecialTop
 }
 
 // GetSpecialTopicsByTopic retrieves special topics filtered by topic keyword
-func (s *SpecialTopicDB) GetSpecialTopicsByTopic(topicKeyword string, queryParams url.Values) ([]SpecialTopic, *utils.Meta, error) {
+func (s *SpecialTopicDB) GetSpecialTopicsByTopic(ctx context.Context, topicKeyword string, queryParams url.Values) ([]SpecialTopic, *utils.Meta, error) {
 	var topics []SpecialTopic
 
 	// Columns to select from the special_topics table
@@ -188,6 +190,7 @@ func (s *SpecialTopicDB) GetSpecialTopicsByTopic(topicKeyword string, queryParam
 
 	// Build the query using a utility function
 	meta, err := utils.BuildQuery(
+		ctx,
 		&topics,
 		"special_topics",
 		nil, // No joins needed
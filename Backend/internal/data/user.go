@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -23,13 +24,14 @@ type Role struct {
 }
 
 type User struct {
-	ID          uuid.UUID `db:"id" json:"id"`
-	Name        string    `db:"name" json:"name"`
-	Password    string    `db:"password" json:"-"`
-	PhoneNumber string    `db:"phone_number" json:"phone_number"`
-	CreatedAt   time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
-	Roles       []Role    `db:"-" json:"roles"` // Use db:"-" to exclude from direct DB mapping
+	ID              uuid.UUID  `db:"id" json:"id"`
+	Name            string     `db:"name" json:"name"`
+	Password        string     `db:"password" json:"-"`
+	PhoneNumber     string     `db:"phone_number" json:"phone_number"`
+	PhoneVerifiedAt *time.Time `db:"phone_verified_at" json:"phone_verified_at"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`
+	Roles           []Role     `db:"-" json:"roles"` // Use db:"-" to exclude from direct DB mapping
 }
 
 // UserDB handles database operations related to users.
@@ -57,7 +59,7 @@ func ValidateUser(v *validator.Validator, user *User, fields ...string) {
 	}
 }
 
-func (u *UserDB) InsertUser(user *User) error {
+func (u *UserDB) InsertUser(ctx context.Context, user *User) error {
 	query, args, err := QB.Insert("users").
 		Columns("name", "password", "phone_number").
 		Values(user.Name, user.Password, user.PhoneNumber).
@@ -67,7 +69,7 @@ func (u *UserDB) InsertUser(user *User) error {
 		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = u.db.QueryRowx(query, args...).StructScan(user)
+	err = u.db.QueryRowxContext(ctx, query, args...).StructScan(user)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Constraint == "users_phone_number_key" {
@@ -81,9 +83,9 @@ func (u *UserDB) InsertUser(user *User) error {
 }
 
 // GetUser retrieves a user by ID and includes their roles
-func (u *UserDB) GetUser(userID uuid.UUID) (*User, error) {
+func (u *UserDB) GetUser(ctx context.Context, userID uuid.UUID) (*User, error) {
 	var user User
-	query, args, err := QB.Select("id", "name", "password", "phone_number", "created_at", "updated_at").
+	query, args, err := QB.Select("id", "name", "password", "phone_number", "phone_verified_at", "created_at", "updated_at").
 		From("users").
 		Where(squirrel.Eq{"id": userID}).
 		ToSql()
@@ -91,7 +93,7 @@ func (u *UserDB) GetUser(userID uuid.UUID) (*User, error) {
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = u.db.Get(&user, query, args...)
+	err = u.db.GetContext(ctx, &user, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -114,7 +116,7 @@ func (u *UserDB) GetUser(userID uuid.UUID) (*User, error) {
 		Name string `db:"name"`
 	}
 
-	err = u.db.Select(&roles, rolesQuery, rolesArgs...)
+	err = u.db.SelectContext(ctx, &roles, rolesQuery, rolesArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("خطأ في جلب أدوار المستخدم: %v", err)
 	}
@@ -131,7 +133,7 @@ func (u *UserDB) GetUser(userID uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
-func (u *UserDB) DeleteUser(userID uuid.UUID) error {
+func (u *UserDB) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 	query, args, err := QB.Delete("users").
 		Where(squirrel.Eq{"id": userID}).
 		ToSql()
@@ -139,7 +141,7 @@ func (u *UserDB) DeleteUser(userID uuid.UUID) error {
 		return fmt.Errorf("خطأ في إنشاء استعلام الحذف: %v", err)
 	}
 
-	result, err := u.db.Exec(query, args...)
+	result, err := u.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("خطأ في حذف المستخدم: %v", err)
 	}
@@ -155,16 +157,17 @@ func (u *UserDB) DeleteUser(userID uuid.UUID) error {
 	return nil
 }
 
-func (u *UserDB) ListUsers(queryParams url.Values) ([]User, *utils.Meta, error) {
+func (u *UserDB) ListUsers(ctx context.Context, queryParams url.Values) ([]User, *utils.Meta, error) {
 	var users []User
 
 	columns := []string{
-		"id", "name", "phone_number", "created_at", "updated_at",
+		"id", "name", "phone_number", "phone_verified_at", "created_at", "updated_at",
 	}
 
 	searchCols := []string{"name", "phone_number"}
 
 	meta, err := utils.BuildQuery(
+		ctx,
 		&users,
 		"users",
 		nil,
@@ -180,9 +183,9 @@ func (u *UserDB) ListUsers(queryParams url.Values) ([]User, *utils.Meta, error)
 	return users, meta, nil
 }
 
-func (u *UserDB) GetUserByPhoneNumber(phoneNumber string) (*User, error) {
+func (u *UserDB) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*User, error) {
 	var user User
-	query, args, err := QB.Select("id", "name", "password", "phone_number", "created_at", "updated_at").
+	query, args, err := QB.Select("id", "name", "password", "phone_number", "phone_verified_at", "created_at", "updated_at").
 		From("users").
 		Where(squirrel.Eq{"phone_number": phoneNumber}).
 		ToSql()
@@ -190,7 +193,7 @@ func (u *UserDB) GetUserByPhoneNumber(phoneNumber string) (*User, error) {
 		return nil, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
 	}
 
-	err = u.db.Get(&user, query, args...)
+	err = u.db.GetContext(ctx, &user, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -202,9 +205,9 @@ func (u *UserDB) GetUserByPhoneNumber(phoneNumber string) (*User, error) {
 }
 
 // UpdateUser updates a user's information.
-func (u *UserDB) UpdateUser(user *User) error {
+func (u *UserDB) UpdateUser(ctx context.Context, user *User) error {
 	// First check if the user exists
-	_, err := u.GetUser(user.ID)
+	_, err := u.GetUser(ctx, user.ID)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
 			return ErrUserNotFound
@@ -226,6 +229,9 @@ func (u *UserDB) UpdateUser(user *User) error {
 
 	if user.PhoneNumber != "" {
 		updateBuilder = updateBuilder.Set("phone_number", user.PhoneNumber)
+		// A new number has to be verified again
+		updateBuilder = updateBuilder.Set("phone_verified_at",
+			squirrel.Expr("CASE WHEN phone_number = ? THEN phone_verified_at END", user.PhoneNumber))
 	}
 
 	// Always update the timestamp
@@ -241,7 +247,7 @@ func (u *UserDB) UpdateUser(user *User) error {
 	}
 
 	// Execute the query
-	result, err := u.db.Exec(query, args...)
+	result, err := u.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok {
 			if pqErr.Constraint == "users_phone_number_key" {
@@ -261,7 +267,7 @@ func (u *UserDB) UpdateUser(user *User) error {
 	}
 
 	// Get the updated user
-	updatedUser, err := u.GetUser(user.ID)
+	updatedUser, err := u.GetUser(ctx, user.ID)
 	if err != nil {
 		return fmt.Errorf("خطأ في جلب البيانات المحدثة: %v", err)
 	}
@@ -270,3 +276,108 @@ func (u *UserDB) UpdateUser(user *User) error {
 	*user = *updatedUser
 	return nil
 }
+
+// GetSessionVersion returns the session version access tokens of the user
+// must carry to be accepted.
+func (u *UserDB) GetSessionVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	var version int
+	query, args, err := QB.Select("session_version").
+		From("users").
+		Where(squirrel.Eq{"id": userID}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	err = u.db.GetContext(ctx, &version, query, args...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, fmt.Errorf("خطأ في جلب إصدار الجلسة: %v", err)
+	}
+
+	return version, nil
+}
+
+// BumpSessionVersion increments the session version of the user, which
+// revokes every access token issued before.
+func (u *UserDB) BumpSessionVersion(ctx context.Context, userID uuid.UUID) error {
+	query, args, err := QB.Update("users").
+		Set("session_version", squirrel.Expr("session_version + 1")).
+		Where(squirrel.Eq{"id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	result, err := u.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("خطأ في تحديث إصدار الجلسة: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// MarkPhoneVerified records that the user proved they own their phone number.
+func (u *UserDB) MarkPhoneVerified(ctx context.Context, userID uuid.UUID) error {
+	query, args, err := QB.Update("users").
+		Set("phone_verified_at", squirrel.Expr("COALESCE(phone_verified_at, CURRENT_TIMESTAMP)")).
+		Where(squirrel.Eq{"id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	result, err := u.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("خطأ في تأكيد رقم الهاتف: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ResetPassword replaces the password of a user who proved they own their
+// phone number with a code, which also verifies the number.
+func (u *UserDB) ResetPassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	query, args, err := QB.Update("users").
+		Set("password", passwordHash).
+		Set("phone_verified_at", squirrel.Expr("COALESCE(phone_verified_at, CURRENT_TIMESTAMP)")).
+		Set("updated_at", time.Now()).
+		Where(squirrel.Eq{"id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("خطأ في إنشاء الاستعلام: %v", err)
+	}
+
+	result, err := u.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("خطأ في تحديث كلمة المرور: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("خطأ في التحقق من الصفوف المتأثرة: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"project/utils"
@@ -11,6 +13,17 @@ import (
 	"github.com/lib/pq"
 )
 
+// Seeded roles. Every account has user; editor manages content and admin
+// also manages accounts.
+const (
+	RoleAdmin  = 1
+	RoleUser   = 2
+	RoleEditor = 3
+)
+
+// ErrRoleNotFound is returned when granting a role that does not exist.
+var ErrRoleNotFound = errors.New("الدور غير موجود")
+
 type UserRole struct {
 	User_id uuid.UUID `db:"user_id" json:"user_id"`
 	Role_id int64     `db:"role_id" json:"role_id"`
@@ -20,7 +33,7 @@ type UserRoleDB struct {
 	db *sqlx.DB
 }
 
-func (u *UserRoleDB) GrantRole(userID uuid.UUID, roleID int) error {
+func (u *UserRoleDB) GrantRole(ctx context.Context, userID uuid.UUID, roleID int) error {
 	query, args, err := QB.Insert("user_roles").
 		Columns("user_id", "role_id").
 		Values(userID, roleID).
@@ -29,16 +42,22 @@ func (u *UserRoleDB) GrantRole(userID uuid.UUID, roleID int) error {
 		return fmt.Errorf("error building query: %v", err)
 	}
 
-	_, err = u.db.Exec(query, args...)
+	_, err = u.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // 23505 is the code for unique violation
 			return ErrHasRole
 		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" { // 23503 is the code for foreign key violation
+			if pqErr.Constraint == "user_roles_role_id_fkey" {
+				return ErrRoleNotFound
+			}
+			return ErrUserNotFound
+		}
 		return fmt.Errorf("error executing query: %v", err)
 	}
 	return nil
 }
-func (u *UserRoleDB) GetRolesByUserID(userID uuid.UUID) ([]Role, error) {
+func (u *UserRoleDB) GetRolesByUserID(ctx context.Context, userID uuid.UUID) ([]Role, error) {
 	const query = `
         SELECT
             r.id,
@@ -50,14 +69,51 @@ func (u *UserRoleDB) GetRolesByUserID(userID uuid.UUID) ([]Role, error) {
     `
 
 	var roles []Role
-	if err := u.db.Select(&roles, query, userID); err != nil {
+	if err := u.db.SelectContext(ctx, &roles, query, userID); err != nil {
 		return nil, fmt.Errorf("error retrieving user roles: %v", err)
 	}
 	return roles, nil
 }
 
+// ListRoles retrieves every role
+func (u *UserRoleDB) ListRoles(ctx context.Context) ([]Role, error) {
+	query, args, err := QB.Select("id", "name").
+		From("roles").
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error building query: %v", err)
+	}
+
+	roles := []Role{}
+	if err := u.db.SelectContext(ctx, &roles, query, args...); err != nil {
+		return nil, fmt.Errorf("error retrieving roles: %v", err)
+	}
+	return roles, nil
+}
+
+// UsersWithRole retrieves the users that have a role
+func (u *UserRoleDB) UsersWithRole(ctx context.Context, roleID int) ([]User, error) {
+	query, args, err := QB.Select("users.id", "users.name", "users.phone_number", "users.phone_verified_at",
+		"users.created_at", "users.updated_at").
+		From("user_roles").
+		Join("users ON user_roles.user_id = users.id").
+		Where(squirrel.Eq{"user_roles.role_id": roleID}).
+		OrderBy("users.created_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("error building query: %v", err)
+	}
+
+	users := []User{}
+	if err := u.db.SelectContext(ctx, &users, query, args...); err != nil {
+		return nil, fmt.Errorf("error executing query: %v", err)
+	}
+	return users, nil
+}
+
 // RevokeRole removes a specific role from a user
-func (u *UserRoleDB) RevokeRole(userID uuid.UUID, roleID int) error {
+func (u *UserRoleDB) RevokeRole(ctx context.Context, userID uuid.UUID, roleID int) error {
 	query, args, err := QB.Delete("user_roles").
 		Where(squirrel.Eq{"user_id": userID, "role_id": roleID}).
 		ToSql()
@@ -65,7 +121,7 @@ func (u *UserRoleDB) RevokeRole(userID uuid.UUID, roleID int) error {
 		return fmt.Errorf("error building query: %v", err)
 	}
 
-	_, err = u.db.Exec(query, args...)
+	_, err = u.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("error executing query: %v", err)
 	}
@@ -74,7 +130,7 @@ func (u *UserRoleDB) RevokeRole(userID uuid.UUID, roleID int) error {
 }
 
 // GetUserRoles retrieves all roles assigned to a user
-func (u *UserRoleDB) GetUserRoles(userID uuid.UUID) ([]string, error) {
+func (u *UserRoleDB) GetUserRoles(ctx context.Context, userID uuid.UUID) ([]string, error) {
 	var roles []string
 	query, args, err := QB.Select("roles.name").
 		From("user_roles").
@@ -85,7 +141,7 @@ func (u *UserRoleDB) GetUserRoles(userID uuid.UUID) ([]string, error) {
 		return nil, fmt.Errorf("error building query: %v", err)
 	}
 
-	err = u.db.Select(&roles, query, args...)
+	err = u.db.SelectContext(ctx, &roles, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error executing query: %v", err)
 	}
@@ -94,7 +150,7 @@ func (u *UserRoleDB) GetUserRoles(userID uuid.UUID) ([]string, error) {
 }
 
 // HasRole checks if a user has a specific role
-func (u *UserRoleDB) HasRole(userID uuid.UUID, roleID int) (bool, error) {
+func (u *UserRoleDB) HasRole(ctx context.Context, userID uuid.UUID, roleID int) (bool, error) {
 	var count int
 	query, args, err := QB.Select("COUNT(*)").
 		From("user_roles").
@@ -104,7 +160,7 @@ func (u *UserRoleDB) HasRole(userID uuid.UUID, roleID int) (bool, error) {
 		return false, fmt.Errorf("error building query: %v", err)
 	}
 
-	err = u.db.Get(&count, query, args...)
+	err = u.db.GetContext(ctx, &count, query, args...)
 	if err != nil {
 		return false, fmt.Errorf("error executing query: %v", err)
 	}
@@ -112,7 +168,7 @@ func (u *UserRoleDB) HasRole(userID uuid.UUID, roleID int) (bool, error) {
 	return count > 0, nil
 }
 
-func (u *UserRoleDB) GetTeachers(queryParams url.Values) ([]User, *utils.Meta, error) {
+func (u *UserRoleDB) GetTeachers(ctx context.Context, queryParams url.Values) ([]User, *utils.Meta, error) {
 	// Define the base table, joins, columns, and searchable columns
 	table := "user_roles"
 	joins := []string{"users ON user_roles.user_id = users.id"} // Example join
@@ -132,14 +188,14 @@ func (u *UserRoleDB) GetTeachers(queryParams url.Values) ([]User, *utils.Meta, e
 	var users []User
 
 	// Use BuildQuery to construct and execute the query
-	meta, err := utils.BuildQuery(&users, table, joins, columns, searchCols, queryParams, additionalFilters)
+	meta, err := utils.BuildQuery(ctx, &users, table, joins, columns, searchCols, queryParams, additionalFilters)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error building query: %v", err)
 	}
 
 	return users, meta, nil
 }
-func (u *UserRoleDB) GetStudents(queryParams url.Values) ([]User, *utils.Meta, error) {
+func (u *UserRoleDB) GetStudents(ctx context.Context, queryParams url.Values) ([]User, *utils.Meta, error) {
 	// Define the base table, joins, columns, and searchable columns
 	table := "user_roles"
 	joins := []string{"users ON user_roles.user_id = users.id"} // Example join
@@ -159,14 +215,14 @@ func (u *UserRoleDB) GetStudents(queryParams url.Values) ([]User, *utils.Meta, e
 	var users []User
 
 	// Use BuildQuery to construct and execute the query
-	meta, err := utils.BuildQuery(&users, table, joins, columns, searchCols, queryParams, additionalFilters)
+	meta, err := utils.BuildQuery(ctx, &users, table, joins, columns, searchCols, queryParams, additionalFilters)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error building query: %v", err)
 	}
 
 	return users, meta, nil
 }
-func (u *UserRoleDB) GetGraduationStudents(queryParams url.Values) ([]User, *utils.Meta, error) {
+func (u *UserRoleDB) GetGraduationStudents(ctx context.Context, queryParams url.Values) ([]User, *utils.Meta, error) {
 	// Define the base table, joins, columns, and searchable columns
 	table := "user_roles"
 	joins := []string{"users ON user_roles.user_id = users.id"} // Example join
@@ -189,14 +245,14 @@ func (u *UserRoleDB) GetGraduationStudents(queryParams url.Values) ([]User, *uti
 	var users []User
 
 	// Use BuildQuery to construct and execute the query
-	meta, err := utils.BuildQuery(&users, table, joins, columns, searchCols, queryParams, additionalFilters)
+	meta, err := utils.BuildQuery(ctx, &users, table, joins, columns, searchCols, queryParams, additionalFilters)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error building query: %v", err)
 	}
 
 	return users, meta, nil
 }
-func (u *UserRoleDB) CountUsersWithRole(roleID int) (int, error) {
+func (u *UserRoleDB) CountUsersWithRole(ctx context.Context, roleID int) (int, error) {
 	var count int
 
 	// Build the query using squirrel
@@ -210,14 +266,14 @@ func (u *UserRoleDB) CountUsersWithRole(roleID int) (int, error) {
 	}
 
 	// Execute the query
-	err = u.db.Get(&count, query, args...)
+	err = u.db.GetContext(ctx, &count, query, args...)
 	if err != nil {
 		return 0, fmt.Errorf("error executing query: %v", err)
 	}
 
 	return count, nil
 }
-func (u *UserRoleDB) CountGraduationStudents(role int) (int, error) {
+func (u *UserRoleDB) CountGraduationStudents(ctx context.Context, role int) (int, error) {
 	query, args, err := QB.Select("COUNT(*)").
 		From("user_roles").
 		Where(squirrel.Eq{"role_id": role}).
@@ -228,7 +284,7 @@ func (u *UserRoleDB) CountGraduationStudents(role int) (int, error) {
 	}
 
 	var count int
-	err = u.db.Get(&count, query, args...)
+	err = u.db.GetContext(ctx, &count, query, args...)
 	if err != nil {
 		return 0, fmt.Errorf("error executing count query: %v", err)
 	}
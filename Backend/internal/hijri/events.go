@@ -0,0 +1,97 @@
+package hijri
+
+import "time"
+
+// Event is an Islamic occasion fixed to a Hijri month and day.
+type Event struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Month int    `json:"month"`
+	Day   int    `json:"day"`
+}
+
+// Event keys that other parts of the system key off.
+const (
+	EventIslamicNewYear = "islamic_new_year"
+	EventAshura         = "ashura"
+	EventMawlid         = "mawlid"
+	EventIsraMiraj      = "isra_miraj"
+	EventRamadanStart   = "ramadan_start"
+	EventEidAlFitr      = "eid_al_fitr"
+	EventArafah         = "arafah"
+	EventEidAlAdha      = "eid_al_adha"
+)
+
+// Events lists the occasions in calendar order.
+var Events = []Event{
+	{EventIslamicNewYear, "رأس السنة الهجرية", 1, 1},
+	{EventAshura, "يوم عاشوراء", 1, 10},
+	{EventMawlid, "المولد النبوي", 3, 12},
+	{EventIsraMiraj, "الإسراء والمعراج", 7, 27},
+	{EventRamadanStart, "بداية شهر رمضان", 9, 1},
+	{EventEidAlFitr, "عيد الفطر", 10, 1},
+	{EventArafah, "يوم عرفة", 12, 9},
+	{EventEidAlAdha, "عيد الأضحى", 12, 10},
+}
+
+// EventByKey looks up an event by its key.
+func EventByKey(key string) (Event, bool) {
+	for _, e := range Events {
+		if e.Key == key {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
+
+// Occurrence is an event placed on a concrete day.
+type Occurrence struct {
+	Event
+	Hijri     DateInfo  `json:"hijri"`
+	Gregorian string    `json:"gregorian"`
+	Date      time.Time `json:"-"`
+}
+
+// EventsInYear returns the occurrences of every event in a Hijri year.
+func EventsInYear(year int, cal Calendar, adjustment int, loc *time.Location) ([]Occurrence, error) {
+	occurrences := make([]Occurrence, 0, len(Events))
+	for _, e := range Events {
+		d := Date{Year: year, Month: e.Month, Day: e.Day}
+		date, err := ToGregorian(d, cal, adjustment, loc)
+		if err != nil {
+			return nil, err
+		}
+		occurrences = append(occurrences, Occurrence{Event: e, Hijri: d.Info(), Gregorian: date.Format("2006-01-02"), Date: date})
+	}
+	return occurrences, nil
+}
+
+// EventsInGregorianYear returns the occurrences falling in a Gregorian year,
+// which spans parts of two Hijri years.
+func EventsInGregorianYear(year int, cal Calendar, adjustment int, loc *time.Location) ([]Occurrence, error) {
+	first := FromGregorian(time.Date(year, 1, 1, 0, 0, 0, 0, loc), cal, adjustment).Year
+	var occurrences []Occurrence
+	for y := first; y <= first+1; y++ {
+		yearEvents, err := EventsInYear(y, cal, adjustment, loc)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range yearEvents {
+			if o.Date.Year() == year {
+				occurrences = append(occurrences, o)
+			}
+		}
+	}
+	return occurrences, nil
+}
+
+// EventOn returns the event that falls on t, if any.
+func EventOn(t time.Time, cal Calendar, adjustment int) (Event, bool) {
+	d := FromGregorian(t, cal, adjustment)
+	for _, e := range Events {
+		if e.Month == d.Month && e.Day == d.Day {
+			return e, true
+		}
+	}
+	return Event{}, false
+}
@@ -0,0 +1,202 @@
+// Package hijri converts between Gregorian and Hijri dates using either the
+// tabular (civil) calendar or Umm al-Qura, and lists the Islamic events that
+// fall in a Hijri year.
+package hijri
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidDate = errors.New("hijri: invalid date")
+
+// MinYear and MaxYear bound the Hijri years accepted from clients: 1318
+// began in 1900 and 1600 ends in 2174.
+const (
+	MinYear = 1318
+	MaxYear = 1600
+)
+
+// Calendar selects the conversion rule.
+type Calendar string
+
+const (
+	// Tabular is the arithmetical civil calendar with the 30-year leap cycle
+	// (2, 5, 7, 10, 13, 16, 18, 21, 24, 26, 29).
+	Tabular Calendar = "tabular"
+	// UmmAlQura is the Saudi calendar: a month begins on the day after the
+	// 29th when, at Mecca's sunset, the conjunction has already happened and
+	// the moon sets after the sun.
+	UmmAlQura Calendar = "ummalqura"
+)
+
+// CalendarByName looks up a calendar by its (case-insensitive) name.
+func CalendarByName(name string) (Calendar, bool) {
+	switch c := Calendar(strings.ToLower(name)); c {
+	case Tabular, UmmAlQura:
+		return c, true
+	}
+	return "", false
+}
+
+// CalendarNames returns the names accepted by CalendarByName.
+func CalendarNames() []string {
+	return []string{string(UmmAlQura), string(Tabular)}
+}
+
+var monthNames = [...]string{"", "محرم", "صفر", "ربيع الأول", "ربيع الآخر", "جمادى الأولى", "جمادى الآخرة",
+	"رجب", "شعبان", "رمضان", "شوال", "ذو القعدة", "ذو الحجة"}
+
+// MonthName returns the Arabic name of a Hijri month (1-12).
+func MonthName(month int) string {
+	if month < 1 || month > 12 {
+		return ""
+	}
+	return monthNames[month]
+}
+
+// Date is a day in the Hijri calendar.
+type Date struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+	Day   int `json:"day"`
+}
+
+// String formats the date as YYYY-MM-DD.
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// ParseDate parses a date written as YYYY-MM-DD in a year from MinYear to
+// MaxYear. Only the shape and the year are checked; ToGregorian rejects days
+// the month does not have.
+func ParseDate(value string) (Date, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 3 {
+		return Date{}, ErrInvalidDate
+	}
+	var fields [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Date{}, ErrInvalidDate
+		}
+		fields[i] = n
+	}
+	if fields[0] < MinYear || fields[0] > MaxYear {
+		return Date{}, ErrInvalidDate
+	}
+	return Date{Year: fields[0], Month: fields[1], Day: fields[2]}, nil
+}
+
+// Display formats the date in Arabic, e.g. "1 رمضان 1446".
+func (d Date) Display() string {
+	return fmt.Sprintf("%d %s %d", d.Day, MonthName(d.Month), d.Year)
+}
+
+// Info expands the date with the labels the API returns.
+func (d Date) Info() DateInfo {
+	return DateInfo{Date: d, MonthName: MonthName(d.Month), Formatted: d.String(), Display: d.Display()}
+}
+
+// DateInfo is the representation of a Date returned by the API.
+type DateInfo struct {
+	Date
+	MonthName string `json:"month_name"`
+	Formatted string `json:"formatted"`
+	Display   string `json:"display"`
+}
+
+// FromGregorian returns the Hijri date of the civil day t falls on (in t's
+// own location). adjustment shifts the result by whole days to follow a local
+// sighting that differs from the calculated calendar.
+func FromGregorian(t time.Time, cal Calendar, adjustment int) Date {
+	jdn := gregorianToJDN(t.Date()) + adjustment
+	if cal == UmmAlQura {
+		return ummAlQuraFromJDN(jdn)
+	}
+	return tabularFromJDN(jdn)
+}
+
+// ToGregorian returns midnight, in loc, of the Gregorian day on which d falls.
+func ToGregorian(d Date, cal Calendar, adjustment int, loc *time.Location) (time.Time, error) {
+	if d.Year < 1 || d.Month < 1 || d.Month > 12 || d.Day < 1 || d.Day > MonthLength(d.Year, d.Month, cal) {
+		return time.Time{}, ErrInvalidDate
+	}
+	var jdn int
+	if cal == UmmAlQura {
+		jdn = ummAlQuraMonthStart(monthIndex(d.Year, d.Month)) + d.Day - 1
+	} else {
+		jdn = tabularToJDN(d.Year, d.Month, d.Day)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	y, m, day := jdnToGregorian(jdn - adjustment)
+	return time.Date(y, time.Month(m), day, 0, 0, 0, 0, loc), nil
+}
+
+// MonthLength returns the number of days (29 or 30) in a Hijri month.
+func MonthLength(year, month int, cal Calendar) int {
+	if cal == UmmAlQura {
+		n := monthIndex(year, month)
+		return ummAlQuraMonthStart(n+1) - ummAlQuraMonthStart(n)
+	}
+	if month == 12 {
+		return tabularToJDN(year+1, 1, 1) - tabularToJDN(year, 12, 1)
+	}
+	return tabularToJDN(year, month+1, 1) - tabularToJDN(year, month, 1)
+}
+
+// monthIndex numbers Hijri months consecutively from Muharram 1 AH.
+func monthIndex(year, month int) int {
+	return (year-1)*12 + month - 1
+}
+
+// Tabular calendar.
+
+const tabularEpoch = 1948439 // JDN of the day before 1 Muharram 1 AH
+
+func tabularToJDN(year, month, day int) int {
+	return day + (59*(month-1)+1)/2 + (year-1)*354 + (3+11*year)/30 + tabularEpoch
+}
+
+func tabularFromJDN(jdn int) Date {
+	year := (30*(jdn-tabularEpoch) + 10646) / 10631
+	for jdn < tabularToJDN(year, 1, 1) {
+		year--
+	}
+	for jdn >= tabularToJDN(year+1, 1, 1) {
+		year++
+	}
+	month := 1
+	for month < 12 && jdn >= tabularToJDN(year, month+1, 1) {
+		month++
+	}
+	return Date{Year: year, Month: month, Day: jdn - tabularToJDN(year, month, 1) + 1}
+}
+
+// Gregorian day numbers (Julian Day Number of the civil day).
+
+func gregorianToJDN(year int, month time.Month, day int) int {
+	a := (14 - int(month)) / 12
+	y := year + 4800 - a
+	m := int(month) + 12*a - 3
+	return day + (153*m+2)/5 + 365*y + y/4 - y/100 + y/400 - 32045
+}
+
+func jdnToGregorian(jdn int) (year, month, day int) {
+	a := jdn + 32044
+	b := (4*a + 3) / 146097
+	c := a - 146097*b/4
+	d := (4*c + 3) / 1461
+	e := c - 1461*d/4
+	m := (5*e + 2) / 153
+	day = e - (153*m+2)/5 + 1
+	month = m + 3 - 12*(m/10)
+	year = 100*b + d - 4800 + m/10
+	return year, month, day
+}
@@ -0,0 +1,168 @@
+package hijri
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestToGregorian(t *testing.T) {
+	tests := []struct {
+		cal   Calendar
+		hijri Date
+		want  string
+	}{
+		// Published Umm al-Qura dates
+		{UmmAlQura, Date{1443, 9, 1}, "2022-04-02"},
+		{UmmAlQura, Date{1444, 9, 1}, "2023-03-23"},
+		{UmmAlQura, Date{1444, 10, 1}, "2023-04-21"},
+		{UmmAlQura, Date{1445, 1, 1}, "2023-07-19"},
+		{UmmAlQura, Date{1445, 9, 1}, "2024-03-11"},
+		{UmmAlQura, Date{1445, 10, 1}, "2024-04-10"},
+		{UmmAlQura, Date{1445, 12, 1}, "2024-06-07"},
+		{UmmAlQura, Date{1446, 1, 1}, "2024-07-07"},
+		{UmmAlQura, Date{1446, 9, 1}, "2025-03-01"},
+		{UmmAlQura, Date{1446, 10, 1}, "2025-03-30"},
+		{UmmAlQura, Date{1446, 12, 10}, "2025-06-06"},
+		{UmmAlQura, Date{1447, 1, 1}, "2025-06-26"},
+
+		// The civil calendar, from its epoch of 16 July 622 (Julian)
+		{Tabular, Date{1, 1, 1}, "0622-07-19"},
+		{Tabular, Date{1445, 1, 1}, "2023-07-19"},
+		{Tabular, Date{1445, 12, 30}, "2024-07-07"},
+		{Tabular, Date{1446, 9, 1}, "2025-03-01"},
+		{Tabular, Date{1446, 12, 10}, "2025-06-07"},
+		{Tabular, Date{1447, 1, 1}, "2025-06-27"},
+	}
+
+	for _, tt := range tests {
+		got, err := ToGregorian(tt.hijri, tt.cal, 0, nil)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.cal, tt.hijri, err)
+			continue
+		}
+		if got.Format(time.DateOnly) != tt.want {
+			t.Errorf("%s %s = %s, want %s", tt.cal, tt.hijri, got.Format(time.DateOnly), tt.want)
+		}
+
+		gregorian, _ := time.Parse(time.DateOnly, tt.want)
+		if back := FromGregorian(gregorian, tt.cal, 0); back != tt.hijri {
+			t.Errorf("FromGregorian(%s, %s) = %s, want %s", tt.want, tt.cal, back, tt.hijri)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, cal := range []Calendar{UmmAlQura, Tabular} {
+		previous := FromGregorian(start.AddDate(0, 0, -1), cal, 0)
+		for day := start; day.Year() < 2031; day = day.AddDate(0, 0, 1) {
+			d := FromGregorian(day, cal, 0)
+			back, err := ToGregorian(d, cal, 0, time.UTC)
+			if err != nil || !back.Equal(day) {
+				t.Fatalf("%s: %s -> %s -> %s (%v)", cal, day.Format(time.DateOnly), d, back.Format(time.DateOnly), err)
+			}
+
+			// Consecutive days are consecutive Hijri days
+			next := previous.Day == MonthLength(previous.Year, previous.Month, cal)
+			switch {
+			case !next && (d.Year != previous.Year || d.Month != previous.Month || d.Day != previous.Day+1):
+				t.Fatalf("%s: %s follows %s", cal, d, previous)
+			case next && (d.Day != 1 || (d.Month != previous.Month+1 && !(previous.Month == 12 && d.Month == 1 && d.Year == previous.Year+1))):
+				t.Fatalf("%s: %s follows the last day %s", cal, d, previous)
+			}
+			previous = d
+		}
+	}
+}
+
+func TestMonthLength(t *testing.T) {
+	tests := []struct {
+		cal         Calendar
+		year, month int
+		want        int
+	}{
+		{Tabular, 1445, 1, 30},
+		{Tabular, 1445, 2, 29},
+		{Tabular, 1444, 12, 29}, // common year
+		{Tabular, 1445, 12, 30}, // leap year: 1445 is the 5th of its cycle
+		{UmmAlQura, 1445, 9, 30},
+		{UmmAlQura, 1446, 9, 29},
+	}
+	for _, tt := range tests {
+		if got := MonthLength(tt.year, tt.month, tt.cal); got != tt.want {
+			t.Errorf("MonthLength(%d, %d, %s) = %d, want %d", tt.year, tt.month, tt.cal, got, tt.want)
+		}
+	}
+}
+
+func TestAdjustment(t *testing.T) {
+	day := time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)
+	if got, want := FromGregorian(day, UmmAlQura, 1), (Date{1445, 9, 2}); got != want {
+		t.Errorf("FromGregorian with +1 = %s, want %s", got, want)
+	}
+	got, err := ToGregorian(Date{1445, 9, 1}, UmmAlQura, -1, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := day.AddDate(0, 0, 1); !got.Equal(want) {
+		t.Errorf("ToGregorian with -1 = %s, want %s", got.Format(time.DateOnly), want.Format(time.DateOnly))
+	}
+}
+
+func TestInvalidDates(t *testing.T) {
+	for _, d := range []Date{{0, 1, 1}, {1445, 0, 1}, {1445, 13, 1}, {1445, 1, 0}, {1444, 12, 30}, {1446, 9, 30}} {
+		cal := Tabular
+		if d.Month == 9 {
+			cal = UmmAlQura
+		}
+		if _, err := ToGregorian(d, cal, 0, nil); !errors.Is(err, ErrInvalidDate) {
+			t.Errorf("ToGregorian(%s, %s) err = %v, want ErrInvalidDate", d, cal, err)
+		}
+	}
+
+	for _, value := range []string{"", "1445-09", "1445-09-x", "1445/09/01", "1317-12-29", "1601-01-01", "9223372036854775807-01-01"} {
+		if _, err := ParseDate(value); !errors.Is(err, ErrInvalidDate) {
+			t.Errorf("ParseDate(%q) err = %v, want ErrInvalidDate", value, err)
+		}
+	}
+	if d, err := ParseDate("1445-09-01"); err != nil || d != (Date{1445, 9, 1}) {
+		t.Errorf("ParseDate(1445-09-01) = %s, %v", d, err)
+	}
+}
+
+func TestEventsInGregorianYear(t *testing.T) {
+	occurrences, err := EventsInGregorianYear(2025, UmmAlQura, 0, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, o := range occurrences {
+		if o.Date.Year() != 2025 {
+			t.Errorf("%s falls on %s, outside 2025", o.Key, o.Gregorian)
+		}
+		got[o.Key] = o.Gregorian
+	}
+
+	for key, want := range map[string]string{
+		EventRamadanStart:   "2025-03-01",
+		EventEidAlFitr:      "2025-03-30",
+		EventArafah:         "2025-06-05",
+		EventEidAlAdha:      "2025-06-06",
+		EventIslamicNewYear: "2025-06-26",
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %q, want %s", key, got[key], want)
+		}
+	}
+}
+
+func TestMonthStartCacheBounded(t *testing.T) {
+	FromGregorian(time.Date(9000, 1, 1, 0, 0, 0, 0, time.UTC), UmmAlQura, 0)
+	monthStarts.Range(func(key, _ any) bool {
+		if n := key.(int); n < firstCachedMonth || n > lastCachedMonth {
+			t.Errorf("month %d was cached, outside %d..%d", n, firstCachedMonth, lastCachedMonth)
+		}
+		return true
+	})
+}
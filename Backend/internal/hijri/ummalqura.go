@@ -0,0 +1,177 @@
+package hijri
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"project/internal/prayertime"
+)
+
+// mecca is where the Umm al-Qura criteria are evaluated.
+var mecca = prayertime.Location{
+	Latitude:  21.4225,
+	Longitude: 39.8262,
+	Elevation: 277,
+	TimeZone:  time.FixedZone("AST", 3*60*60),
+}
+
+// lunationOffset maps Meeus' lunation number k (k = 0 is the new moon of
+// 6 January 2000) to monthIndex: that conjunction began Shawwal 1420.
+var lunationOffset = monthIndex(1420, 10)
+
+// deltaT approximates TT - UT for the current era.
+const deltaT = 69.0 / 86400
+
+var monthStarts sync.Map // monthIndex -> JDN of the first day
+
+// Only months from MinYear to MaxYear, and their neighbours, are cached, so
+// requests for far-off dates cannot grow monthStarts without bound.
+var (
+	firstCachedMonth = monthIndex(MinYear, 1) - 1
+	lastCachedMonth  = monthIndex(MaxYear, 12) + 1
+)
+
+// ummAlQuraMonthStart returns the JDN of the first day of month n.
+func ummAlQuraMonthStart(n int) int {
+	if jdn, ok := monthStarts.Load(n); ok {
+		return jdn.(int)
+	}
+
+	conjunction := newMoon(n-lunationOffset) - deltaT
+	y, m, d := jdnToGregorian(int(math.Floor(conjunction + 0.5 + 3.0/24)))
+	day := time.Date(y, time.Month(m), d, 0, 0, 0, 0, mecca.TimeZone)
+
+	start := gregorianToJDN(y, time.Month(m), d) + 2
+	if times, err := prayertime.Calculate(day, mecca, prayertime.Params{Method: prayertime.UmmAlQura}); err == nil {
+		sunset := julianFromTime(times.Maghrib)
+		if conjunction < sunset && moonAltitude(sunset, mecca.Latitude, mecca.Longitude) > moonsetAltitude(sunset) {
+			start--
+		}
+	}
+
+	if n >= firstCachedMonth && n <= lastCachedMonth {
+		monthStarts.Store(n, start)
+	}
+	return start
+}
+
+func ummAlQuraFromJDN(jdn int) Date {
+	// The tabular calendar is never more than a couple of days off, so start
+	// there and step to the month that contains jdn.
+	t := tabularFromJDN(jdn)
+	n := monthIndex(t.Year, t.Month)
+	for ummAlQuraMonthStart(n) > jdn {
+		n--
+	}
+	for ummAlQuraMonthStart(n+1) <= jdn {
+		n++
+	}
+	return Date{Year: n/12 + 1, Month: n%12 + 1, Day: jdn - ummAlQuraMonthStart(n) + 1}
+}
+
+// julianFromTime returns the Julian date of an instant.
+func julianFromTime(t time.Time) float64 {
+	return float64(t.UnixNano())/float64(24*time.Hour) + 2440587.5
+}
+
+// newMoon returns the Julian ephemeris day of the k-th new moon after the one
+// of January 2000 (Meeus, Astronomical Algorithms, ch. 49).
+func newMoon(k int) float64 {
+	kf := float64(k)
+	t := kf / 1236.85
+	t2, t3, t4 := t*t, t*t*t, t*t*t*t
+
+	jde := 2451550.09766 + 29.530588861*kf + 0.00015437*t2 - 0.000000150*t3 + 0.00000000073*t4
+	e := 1 - 0.002516*t - 0.0000074*t2
+	m := dtr(2.5534 + 29.10535670*kf - 0.0000014*t2 - 0.00000011*t3)
+	mp := dtr(201.5643 + 385.81693528*kf + 0.0107582*t2 + 0.00001238*t3 - 0.000000058*t4)
+	f := dtr(160.7108 + 390.67050284*kf - 0.0016118*t2 - 0.00000227*t3 + 0.000000011*t4)
+	om := dtr(124.7746 - 1.56375588*kf + 0.0020672*t2 + 0.00000215*t3)
+
+	jde += -0.40720*math.Sin(mp) +
+		0.17241*e*math.Sin(m) +
+		0.01608*math.Sin(2*mp) +
+		0.01039*math.Sin(2*f) +
+		0.00739*e*math.Sin(mp-m) -
+		0.00514*e*math.Sin(mp+m) +
+		0.00208*e*e*math.Sin(2*m) -
+		0.00111*math.Sin(mp-2*f) -
+		0.00057*math.Sin(mp+2*f) +
+		0.00056*e*math.Sin(2*mp+m) -
+		0.00042*math.Sin(3*mp) +
+		0.00042*e*math.Sin(m+2*f) +
+		0.00038*e*math.Sin(m-2*f) -
+		0.00024*e*math.Sin(2*mp-m) -
+		0.00017*math.Sin(om) -
+		0.00007*math.Sin(mp+2*m) +
+		0.00004*math.Sin(2*mp-2*f) +
+		0.00004*math.Sin(3*m) +
+		0.00003*math.Sin(mp+m-2*f) +
+		0.00003*math.Sin(2*mp+2*f) -
+		0.00003*math.Sin(mp+m+2*f) +
+		0.00003*math.Sin(mp-m+2*f) -
+		0.00002*math.Sin(mp-m-2*f) -
+		0.00002*math.Sin(3*mp+m) +
+		0.00002*math.Sin(4*mp)
+
+	planetary := [...]struct{ coef, a, b float64 }{
+		{0.000325, 299.77, 0.107408}, {0.000165, 251.88, 0.016321}, {0.000164, 251.83, 26.651886},
+		{0.000126, 349.42, 36.412478}, {0.000110, 84.66, 18.206239}, {0.000062, 141.74, 53.303771},
+		{0.000060, 207.14, 2.453732}, {0.000056, 154.84, 7.306860}, {0.000047, 34.52, 27.261239},
+		{0.000042, 207.19, 0.121824}, {0.000040, 291.34, 1.844379}, {0.000037, 161.72, 24.198154},
+		{0.000035, 239.56, 25.513099}, {0.000023, 331.55, 3.592518},
+	}
+	for i, p := range planetary {
+		a := p.a + p.b*kf
+		if i == 0 {
+			a -= 0.009173 * t2
+		}
+		jde += p.coef * math.Sin(dtr(a))
+	}
+	return jde
+}
+
+// moonPosition returns the moon's geocentric right ascension and declination
+// and its horizontal parallax, all in degrees, using the low-precision series
+// of the Astronomical Almanac (about 0.3° accuracy).
+func moonPosition(jd float64) (ra, decl, parallax float64) {
+	t := (jd - 2451545.0) / 36525
+
+	lambda := 218.32 + 481267.881*t +
+		6.29*dsin(135.0+477198.87*t) - 1.27*dsin(259.3-413335.36*t) +
+		0.66*dsin(235.7+890534.22*t) + 0.21*dsin(269.9+954397.74*t) -
+		0.19*dsin(357.5+35999.05*t) - 0.11*dsin(186.5+966404.03*t)
+	beta := 5.13*dsin(93.3+483202.02*t) + 0.28*dsin(228.2+960400.89*t) -
+		0.28*dsin(318.3+6003.15*t) - 0.17*dsin(217.6-407332.21*t)
+	parallax = 0.9508 + 0.0518*dcos(135.0+477198.87*t) + 0.0095*dcos(259.3-413335.36*t) +
+		0.0078*dcos(235.7+890534.22*t) + 0.0028*dcos(269.9+954397.74*t)
+
+	eps := 23.439 - 0.0000004*(jd-2451545.0)
+	ra = rtd(math.Atan2(dsin(lambda)*dcos(eps)-dtan(beta)*dsin(eps), dcos(lambda)))
+	decl = rtd(math.Asin(dsin(beta)*dcos(eps) + dcos(beta)*dsin(eps)*dsin(lambda)))
+	return ra, decl, parallax
+}
+
+// moonAltitude returns the moon's geocentric altitude in degrees at jd as
+// seen from the given position.
+func moonAltitude(jd, lat, lng float64) float64 {
+	ra, decl, _ := moonPosition(jd)
+	gmst := 280.46061837 + 360.98564736629*(jd-2451545.0)
+	hourAngle := gmst + lng - ra
+	return rtd(math.Asin(dsin(lat)*dsin(decl) + dcos(lat)*dcos(decl)*dcos(hourAngle)))
+}
+
+// moonsetAltitude is the geocentric altitude of the moon's centre at the
+// moment it sets, allowing for parallax, refraction and semi-diameter.
+func moonsetAltitude(jd float64) float64 {
+	_, _, parallax := moonPosition(jd)
+	return 0.7275*parallax - 0.5667
+}
+
+func dtr(d float64) float64 { return d * math.Pi / 180 }
+func rtd(r float64) float64 { return r * 180 / math.Pi }
+
+func dsin(d float64) float64 { return math.Sin(dtr(d)) }
+func dcos(d float64) float64 { return math.Cos(dtr(d)) }
+func dtan(d float64) float64 { return math.Tan(dtr(d)) }
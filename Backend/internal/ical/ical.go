@@ -0,0 +1,223 @@
+// Package ical writes RFC 5545 calendars that calendar apps can subscribe to.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event is a single VEVENT.
+type Event struct {
+	UID         string
+	Start       time.Time
+	Duration    time.Duration
+	Summary     string
+	Description string
+	Location    string
+}
+
+// Calendar is a VCALENDAR whose events are expressed in Location.
+type Calendar struct {
+	ProductID       string
+	Name            string
+	Location        *time.Location
+	RefreshInterval time.Duration
+	Events          []Event
+}
+
+const (
+	localLayout = "20060102T150405"
+	utcLayout   = "20060102T150405Z"
+)
+
+// Write renders the calendar to w.
+func (c *Calendar) Write(w io.Writer) error {
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	bw := bufio.NewWriter(w)
+	l := &lineWriter{w: bw}
+
+	l.line("BEGIN:VCALENDAR")
+	l.line("VERSION:2.0")
+	l.line("PRODID:" + c.ProductID)
+	l.line("CALSCALE:GREGORIAN")
+	l.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		l.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+	l.line("X-WR-TIMEZONE:" + loc.String())
+	if c.RefreshInterval > 0 {
+		l.line("REFRESH-INTERVAL;VALUE=DURATION:" + duration(c.RefreshInterval))
+		l.line("X-PUBLISHED-TTL:" + duration(c.RefreshInterval))
+	}
+
+	if loc != time.UTC && len(c.Events) > 0 {
+		from, to := c.Events[0].Start, c.Events[0].Start
+		for _, e := range c.Events {
+			if e.Start.Before(from) {
+				from = e.Start
+			}
+			if e.Start.After(to) {
+				to = e.Start
+			}
+		}
+		writeTimezone(l, loc, from, to)
+	}
+
+	stamp := time.Now().UTC().Format(utcLayout)
+	for _, e := range c.Events {
+		l.line("BEGIN:VEVENT")
+		l.line("UID:" + e.UID)
+		l.line("DTSTAMP:" + stamp)
+		if loc == time.UTC {
+			l.line("DTSTART:" + e.Start.UTC().Format(utcLayout))
+		} else {
+			l.line("DTSTART;TZID=" + loc.String() + ":" + e.Start.In(loc).Format(localLayout))
+		}
+		if e.Duration > 0 {
+			l.line("DURATION:" + duration(e.Duration))
+		}
+		l.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			l.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			l.line("LOCATION:" + escape(e.Location))
+		}
+		l.line("TRANSP:TRANSPARENT")
+		l.line("END:VEVENT")
+	}
+
+	l.line("END:VCALENDAR")
+	if l.err != nil {
+		return l.err
+	}
+	return bw.Flush()
+}
+
+// writeTimezone emits a VTIMEZONE describing every offset change of loc
+// between from and to, derived from Go's zone database.
+func writeTimezone(l *lineWriter, loc *time.Location, from, to time.Time) {
+	l.line("BEGIN:VTIMEZONE")
+	l.line("TZID:" + loc.String())
+
+	start := from.AddDate(0, 0, -1)
+	name, offset := start.In(loc).Zone()
+	transitions := 0
+	for t := start; t.Before(to.AddDate(0, 0, 1)); t = t.Add(24 * time.Hour) {
+		next := t.Add(24 * time.Hour)
+		_, nextOffset := next.In(loc).Zone()
+		if nextOffset == offset {
+			continue
+		}
+		// Narrow the change down to the minute.
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Minute {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		at := hi.Truncate(time.Minute)
+		newName, newOffset := at.In(loc).Zone()
+		writeObservance(l, at.In(loc).IsDST(), newName, at.Add(time.Duration(offset)*time.Second), offset, newOffset)
+		name, offset = newName, newOffset
+		transitions++
+	}
+
+	if transitions == 0 {
+		writeObservance(l, start.In(loc).IsDST(), name, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), offset, offset)
+	}
+	l.line("END:VTIMEZONE")
+}
+
+func writeObservance(l *lineWriter, dst bool, name string, localStart time.Time, from, to int) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+	l.line("BEGIN:" + kind)
+	l.line("DTSTART:" + localStart.UTC().Format(localLayout))
+	l.line("TZOFFSETFROM:" + utcOffset(from))
+	l.line("TZOFFSETTO:" + utcOffset(to))
+	l.line("TZNAME:" + escape(name))
+	l.line("END:" + kind)
+}
+
+func utcOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+func duration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+
+	var b strings.Builder
+	b.WriteString("P")
+	if days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+	}
+	if hours > 0 || minutes > 0 {
+		b.WriteString("T")
+		if hours > 0 {
+			fmt.Fprintf(&b, "%dH", hours)
+		}
+		if minutes > 0 {
+			fmt.Fprintf(&b, "%dM", minutes)
+		}
+	}
+	if b.Len() == 1 {
+		b.WriteString("T0M")
+	}
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// lineWriter writes content lines terminated by CRLF, folding them at 75
+// octets without splitting UTF-8 sequences.
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (l *lineWriter) line(s string) {
+	if l.err != nil {
+		return
+	}
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, l.err = l.w.WriteString(s[:cut] + "\r\n "); l.err != nil {
+			return
+		}
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	_, l.err = l.w.WriteString(s + "\r\n")
+}
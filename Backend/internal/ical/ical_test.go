@@ -0,0 +1,169 @@
+package ical
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+	"unicode/utf8"
+)
+
+var dtstamp = regexp.MustCompile(`(?m)^DTSTAMP:\d{8}T\d{6}Z\r$`)
+
+// render writes c with the DTSTAMP lines, which carry the current time,
+// replaced by a fixed one.
+func render(t *testing.T, c *Calendar) string {
+	t.Helper()
+	var b strings.Builder
+	if err := c.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return dtstamp.ReplaceAllString(b.String(), "DTSTAMP:20000101T000000Z\r")
+}
+
+func TestWriteUTC(t *testing.T) {
+	c := &Calendar{
+		ProductID:       "-//test//EN",
+		Name:            "Prayers; Tripoli, Libya",
+		RefreshInterval: 12 * time.Hour,
+		Events: []Event{{
+			UID:         "fajr-2024-06-21@test",
+			Start:       time.Date(2024, 6, 21, 2, 17, 0, 0, time.UTC),
+			Duration:    20 * time.Minute,
+			Summary:     "الفجر",
+			Description: "line one\nline two, with a comma\\backslash",
+			Location:    "Tripoli",
+		}},
+	}
+
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//test//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		`X-WR-CALNAME:Prayers\; Tripoli\, Libya`,
+		"X-WR-TIMEZONE:UTC",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT12H",
+		"X-PUBLISHED-TTL:PT12H",
+		"BEGIN:VEVENT",
+		"UID:fajr-2024-06-21@test",
+		"DTSTAMP:20000101T000000Z",
+		"DTSTART:20240621T021700Z",
+		"DURATION:PT20M",
+		"SUMMARY:الفجر",
+		`DESCRIPTION:line one\nline two\, with a comma\\backslash`,
+		"LOCATION:Tripoli",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	if got := render(t, c); got != want {
+		t.Errorf("output mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	summary := strings.Repeat("صلاة الفجر ", 20)
+	c := &Calendar{ProductID: "-//test//EN", Events: []Event{{UID: "x", Start: time.Unix(0, 0), Summary: summary}}}
+
+	var unfolded strings.Builder
+	for i, line := range strings.Split(strings.TrimSuffix(render(t, c), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line %d is %d octets long", i, len(line))
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d splits a UTF-8 sequence: %q", i, line)
+		}
+		if strings.HasPrefix(line, " ") {
+			unfolded.WriteString(line[1:])
+		} else {
+			unfolded.WriteString("\n" + line)
+		}
+	}
+	if !strings.Contains(unfolded.String(), "\nSUMMARY:"+summary+"\n") {
+		t.Error("the folded summary does not unfold to the original")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "PT0M"},
+		{20 * time.Minute, "PT20M"},
+		{90 * time.Minute, "PT1H30M"},
+		{24 * time.Hour, "P1D"},
+		{26*time.Hour + 5*time.Minute, "P1DT2H5M"},
+		{29*time.Second + 5*time.Minute, "PT5M"},
+	}
+	for _, tt := range tests {
+		if got := duration(tt.d); got != tt.want {
+			t.Errorf("duration(%s) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	tests := []struct {
+		zone string
+		from time.Time
+		to   time.Time
+		want []string
+	}{
+		{
+			// No daylight saving time: one observance
+			zone: "Africa/Tripoli",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+			want: []string{
+				"BEGIN:STANDARD", "DTSTART:19700101T000000", "TZOFFSETFROM:+0200", "TZOFFSETTO:+0200", "TZNAME:EET", "END:STANDARD",
+			},
+		},
+		{
+			// Both changes of 2024, at 01:00 UTC
+			zone: "Europe/London",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC),
+			want: []string{
+				"BEGIN:DAYLIGHT", "DTSTART:20240331T010000", "TZOFFSETFROM:+0000", "TZOFFSETTO:+0100", "TZNAME:BST", "END:DAYLIGHT",
+				"BEGIN:STANDARD", "DTSTART:20241027T020000", "TZOFFSETFROM:+0100", "TZOFFSETTO:+0000", "TZNAME:GMT", "END:STANDARD",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		loc, err := time.LoadLocation(tt.zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &Calendar{
+			ProductID: "-//test//EN",
+			Location:  loc,
+			Events: []Event{
+				{UID: "a", Start: tt.from, Summary: "a"},
+				{UID: "b", Start: tt.to, Summary: "b"},
+			},
+		}
+		out := render(t, c)
+
+		begin := strings.Index(out, "BEGIN:VTIMEZONE\r\n")
+		end := strings.Index(out, "END:VTIMEZONE\r\n")
+		if begin < 0 || end < begin {
+			t.Fatalf("%s: no VTIMEZONE in\n%s", tt.zone, out)
+		}
+		block := strings.Split(strings.TrimSuffix(out[begin:end], "\r\n"), "\r\n")
+		want := append([]string{"BEGIN:VTIMEZONE", "TZID:" + tt.zone}, tt.want...)
+		if strings.Join(block, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s VTIMEZONE:\n%s\nwant:\n%s", tt.zone, strings.Join(block, "\n"), strings.Join(want, "\n"))
+		}
+
+		if !strings.Contains(out, "DTSTART;TZID="+tt.zone+":"+tt.from.In(loc).Format(localLayout)+"\r\n") {
+			t.Errorf("%s: event start not in local time:\n%s", tt.zone, out)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package leader elects one instance among replicas to run singleton work,
+// such as the prayer-time scheduler, using a PostgreSQL session-level
+// advisory lock. The lock lives as long as the database session that took
+// it, so when the leader dies or loses its connection PostgreSQL releases
+// the lock and another instance takes over on its next attempt.
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Config configures an Elector.
+type Config struct {
+	// LockKey identifies the advisory lock; every replica must use the same.
+	LockKey int64
+	// InstanceID names this instance in the heartbeat and in logs.
+	InstanceID string
+	// Interval is how often a follower tries to take the lock and how often
+	// the leader checks its session and records a heartbeat.
+	Interval time.Duration
+	// OnElected and OnDemoted are called when this instance gains and loses
+	// leadership. They run on the elector's goroutine.
+	OnElected func()
+	OnDemoted func()
+
+	Logger *slog.Logger
+}
+
+// Status describes the current leader as recorded in the heartbeat table.
+type Status struct {
+	InstanceID  string    `json:"instance_id"`
+	ElectedAt   time.Time `json:"elected_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	// Alive is false when the heartbeat is older than three intervals, which
+	// means the last leader is gone and no one has taken over yet.
+	Alive bool `json:"alive"`
+}
+
+// ErrNoLeader is returned by Current when no instance has ever led.
+var ErrNoLeader = errors.New("leader: no leader has been elected")
+
+// Elector campaigns for leadership until its context is cancelled.
+type Elector struct {
+	db  *sql.DB
+	cfg Config
+
+	mu      sync.RWMutex
+	leading bool
+}
+
+// New returns an Elector; call Run to start campaigning.
+func New(db *sql.DB, cfg Config) *Elector {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.OnElected == nil {
+		cfg.OnElected = func() {}
+	}
+	if cfg.OnDemoted == nil {
+		cfg.OnDemoted = func() {}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	return &Elector{db: db, cfg: cfg}
+}
+
+// InstanceID returns the name of this instance.
+func (e *Elector) InstanceID() string { return e.cfg.InstanceID }
+
+// IsLeader reports whether this instance currently holds the lock.
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leading
+}
+
+func (e *Elector) setLeading(leading bool) {
+	e.mu.Lock()
+	e.leading = leading
+	e.mu.Unlock()
+}
+
+// Run campaigns for leadership, leads while it holds the lock, and campaigns
+// again after losing it. It returns, releasing the lock, when ctx is
+// cancelled.
+func (e *Elector) Run(ctx context.Context) {
+	for {
+		e.campaign(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.cfg.Interval):
+		}
+	}
+}
+
+// campaign tries once to take the lock on a dedicated connection and, if it
+// succeeds, leads until the connection fails or ctx is cancelled.
+func (e *Elector) campaign(ctx context.Context) {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			e.cfg.Logger.Warn("Leader election: cannot get a connection", "error", err)
+		}
+		return
+	}
+	// The connection is never returned to the pool: discarding it ends the
+	// session, which releases the lock even if unlocking was impossible.
+	defer func() {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		conn.Close()
+	}()
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.cfg.LockKey).Scan(&acquired); err != nil {
+		if ctx.Err() == nil {
+			e.cfg.Logger.Warn("Leader election: cannot try the lock", "error", err)
+		}
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	electedAt := time.Now()
+	if err := e.heartbeat(ctx, conn, electedAt); err != nil {
+		e.cfg.Logger.Warn("Leader election: cannot record heartbeat", "error", err)
+		return
+	}
+
+	e.cfg.Logger.Info("Instance is now the scheduler leader", "instance", e.cfg.InstanceID)
+	e.setLeading(true)
+	e.cfg.OnElected()
+	defer func() {
+		e.setLeading(false)
+		e.cfg.OnDemoted()
+		e.cfg.Logger.Info("Instance is no longer the scheduler leader", "instance", e.cfg.InstanceID)
+	}()
+
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			conn.ExecContext(unlockCtx, "SELECT pg_advisory_unlock($1)", e.cfg.LockKey)
+			cancel()
+			return
+		case <-ticker.C:
+			// The heartbeat runs on the locked session, so it also proves
+			// the lock is still held.
+			if err := e.heartbeat(ctx, conn, electedAt); err != nil {
+				if ctx.Err() == nil {
+					e.cfg.Logger.Warn("Leader election: lost the database session", "error", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+func (e *Elector) heartbeat(ctx context.Context, conn *sql.Conn, electedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Interval)
+	defer cancel()
+
+	_, err := conn.ExecContext(ctx, `
+		INSERT INTO scheduler_leader (id, instance_id, elected_at, heartbeat_at)
+		VALUES (1, $1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (id) DO UPDATE SET
+			instance_id = EXCLUDED.instance_id,
+			elected_at = EXCLUDED.elected_at,
+			heartbeat_at = EXCLUDED.heartbeat_at`,
+		e.cfg.InstanceID, electedAt)
+	return err
+}
+
+// Current reads the leader last recorded in the heartbeat table.
+func (e *Elector) Current(ctx context.Context) (*Status, error) {
+	var s Status
+	err := e.db.QueryRowContext(ctx,
+		"SELECT instance_id, elected_at, heartbeat_at FROM scheduler_leader WHERE id = 1").
+		Scan(&s.InstanceID, &s.ElectedAt, &s.HeartbeatAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoLeader
+		}
+		return nil, err
+	}
+	s.Alive = time.Since(s.HeartbeatAt) < 3*e.cfg.Interval
+	return &s, nil
+}
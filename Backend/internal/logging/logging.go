@@ -0,0 +1,117 @@
+// Package logging builds the structured logger the server writes to. Every
+// record is a JSON object; records logged with a context that carries a
+// request id are tagged with it, and attributes that name secrets or
+// personal data are redacted before they are written.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive attributes and parameters.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute and query parameter names whose values never
+// reach the log.
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"authorization": true,
+	"cookie":        true,
+	"code":          true,
+	"phone_number":  true,
+}
+
+// Sensitive reports whether values named key are redacted.
+func Sensitive(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// New returns a logger writing JSON records of level and above to w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+	return slog.New(contextHandler{handler})
+}
+
+// ParseLevel reads a level name: debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if Sensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// RedactQuery returns the encoded query with the values of sensitive
+// parameters redacted.
+func RedactQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	redacted := make(url.Values, len(query))
+	for key, values := range query {
+		if Sensitive(key) {
+			redacted[key] = []string{Redacted}
+			continue
+		}
+		redacted[key] = values
+	}
+	return redacted.Encode()
+}
+
+// MaskPhone keeps the last three digits of a phone number, enough to tell
+// accounts apart in the log.
+func MaskPhone(phoneNumber string) string {
+	if len(phoneNumber) <= 3 {
+		return "***"
+	}
+	return strings.Repeat("*", len(phoneNumber)-3) + phoneNumber[len(phoneNumber)-3:]
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id ctx carries, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request id of the context a record is logged
+// with.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerOutput(t *testing.T) {
+	reg := NewRegistry()
+
+	requests := reg.NewCounterVec("requests_total", "Requests, by\\path\nand status.", "path", "status")
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "500")
+	requests.Inc(`/q"x\y`+"\n", "200")
+
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "path")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.1, "/a") // on a bound, so counted in it
+	latency.Observe(0.5, "/a")
+	latency.Observe(7, "/a")
+
+	reg.NewGaugeFunc("open", "Open things.", func() float64 { return 3 })
+	reg.NewCounterFunc("waited_seconds_total", "Time waited.", func() float64 { return 1.5 })
+	reg.NewCounterVec("unused_total", "Never incremented.", "kind")
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if got, want := rec.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+
+	want := `# HELP requests_total Requests, by\\path\nand status.
+# TYPE requests_total counter
+requests_total{path="/a",status="500"} 2
+requests_total{path="/b",status="200"} 1
+requests_total{path="/q\"x\\y\n",status="200"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{path="/a",le="0.1"} 2
+latency_seconds_bucket{path="/a",le="1"} 3
+latency_seconds_bucket{path="/a",le="+Inf"} 4
+latency_seconds_sum{path="/a"} 7.65
+latency_seconds_count{path="/a"} 4
+# HELP open Open things.
+# TYPE open gauge
+open 3
+# HELP waited_seconds_total Time waited.
+# TYPE waited_seconds_total counter
+waited_seconds_total 1.5
+# HELP unused_total Never incremented.
+# TYPE unused_total counter
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("output mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(reg *Registry)
+	}{
+		{"registered twice", func(reg *Registry) {
+			reg.NewCounterVec("x_total", "X.")
+			reg.NewGaugeFunc("x_total", "X.", func() float64 { return 0 })
+		}},
+		{"wrong label count", func(reg *Registry) {
+			reg.NewCounterVec("x_total", "X.", "a", "b").Inc("only one")
+		}},
+		{"negative counter", func(reg *Registry) {
+			reg.NewCounterVec("x_total", "X.").Add(-1)
+		}},
+		{"unsorted buckets", func(reg *Registry) {
+			reg.NewHistogramVec("x_seconds", "X.", []float64{1, 0.5})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("did not panic")
+				}
+			}()
+			tt.fn(NewRegistry())
+		})
+	}
+}
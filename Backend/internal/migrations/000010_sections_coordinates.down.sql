@@ -0,0 +1,6 @@
+ALTER TABLE sections
+    DROP COLUMN IF EXISTS asr_method,
+    DROP COLUMN IF EXISTS calculation_method,
+    DROP COLUMN IF EXISTS elevation,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS latitude;
@@ -0,0 +1,6 @@
+ALTER TABLE sections
+    ADD COLUMN latitude DOUBLE PRECISION CHECK (latitude >= -90 AND latitude <= 90),
+    ADD COLUMN longitude DOUBLE PRECISION CHECK (longitude >= -180 AND longitude <= 180),
+    ADD COLUMN elevation DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN calculation_method VARCHAR(20) NOT NULL DEFAULT 'egyptian',
+    ADD COLUMN asr_method VARCHAR(10) NOT NULL DEFAULT 'shafii';
@@ -0,0 +1,22 @@
+-- Back to Tripoli wall-clock time, as read by Africa/Tripoli sessions.
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE prayer_times
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE adhkar_categories
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE adhkar
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE hadiths
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE special_topics
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at AT TIME ZONE 'Africa/Tripoli';
+
+ALTER TABLE sections
+    DROP COLUMN IF EXISTS timezone;
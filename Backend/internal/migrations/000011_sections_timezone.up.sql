@@ -0,0 +1,67 @@
+ALTER TABLE sections
+    ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'Africa/Tripoli';
+
+-- Backfill coordinates (WGS84) and elevation in metres for the seeded cities.
+UPDATE sections s
+SET latitude = v.latitude,
+    longitude = v.longitude,
+    elevation = v.elevation
+FROM (VALUES
+    ('مرزق', 25.9155, 13.9184, 450),
+    ('الواحات', 29.1081, 21.2869, 50),
+    ('إجدابيا', 30.7554, 20.2263, 10),
+    ('البريقة', 30.4086, 19.5739, 10),
+    ('البيضاء', 32.7627, 21.7551, 620),
+    ('بنغازي', 32.1194, 20.0868, 5),
+    ('طرابلس', 32.8872, 13.1913, 81),
+    ('مصراتة', 32.3754, 15.0925, 10),
+    ('الزاوية', 32.7571, 12.7276, 20),
+    ('زليتن', 32.4674, 14.5687, 30),
+    ('طبرق', 32.0836, 23.9764, 50),
+    ('سبها', 27.0377, 14.4283, 430),
+    ('سرت', 31.2089, 16.5887, 15),
+    ('درنة', 32.7648, 22.6391, 10),
+    ('الخمس', 32.6486, 14.2619, 20),
+    ('صبراتة', 32.7922, 12.4845, 10),
+    ('المرج', 32.4925, 20.8305, 300),
+    ('غات', 24.9647, 10.1728, 700),
+    ('براك', 27.5496, 14.2714, 350),
+    ('ترهونة', 32.4350, 13.6332, 330),
+    ('زوارة', 32.9312, 12.0819, 5),
+    ('نالوت', 31.8685, 10.9812, 620),
+    ('غريان', 32.1722, 13.0203, 710),
+    ('الرجبان', 32.0167, 12.2667, 700),
+    ('مزدة', 31.4451, 12.9801, 450),
+    ('الكفرة', 24.1997, 23.2906, 380),
+    ('العجيلات', 32.7571, 12.3763, 20),
+    ('تاورغاء', 31.9669, 15.2236, 20),
+    ('القبة', 32.7600, 22.2467, 600),
+    ('الشويرف', 29.9897, 14.2648, 370),
+    ('جالو', 29.0331, 21.5482, 60),
+    ('هون', 29.1268, 15.9477, 250)
+) AS v(name, latitude, longitude, elevation)
+WHERE s.name = v.name
+  AND s.latitude IS NULL
+  AND s.longitude IS NULL;
+
+-- Sessions now run in UTC instead of Africa/Tripoli. These columns have no
+-- time zone and hold Tripoli wall-clock time, so convert them while that is
+-- still known; TIMESTAMPTZ reads back the same instant in any session zone.
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE prayer_times
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE adhkar_categories
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE adhkar
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE hadiths
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'Africa/Tripoli';
+ALTER TABLE special_topics
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Africa/Tripoli',
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'Africa/Tripoli';
@@ -0,0 +1,2 @@
+ALTER TABLE sections
+    DROP COLUMN IF EXISTS hijri_adjustment;
@@ -0,0 +1,5 @@
+-- Days added to the calculated Hijri date so a section can follow the local
+-- moon sighting.
+ALTER TABLE sections
+    ADD COLUMN hijri_adjustment SMALLINT NOT NULL DEFAULT 0
+        CHECK (hijri_adjustment BETWEEN -2 AND 2);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS notification_subscriptions (
+    id                      SERIAL PRIMARY KEY,
+    user_id                 UUID REFERENCES users(id) ON DELETE CASCADE,
+    device_token            TEXT NOT NULL UNIQUE,
+    section_id              INT NOT NULL REFERENCES sections(id) ON DELETE CASCADE,
+    prayers                 TEXT[] NOT NULL
+        DEFAULT '{fajr_first,fajr_second,dhuhr,asr,maghrib,isha,suhoor,imsak}',
+    reminder_offset_minutes SMALLINT NOT NULL DEFAULT 0
+        CHECK (reminder_offset_minutes BETWEEN 0 AND 120),
+    quiet_hours_start       TIME,
+    quiet_hours_end         TIME,
+    language                VARCHAR(5) NOT NULL DEFAULT 'ar' CHECK (language IN ('ar', 'en')),
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((quiet_hours_start IS NULL) = (quiet_hours_end IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_subscriptions_section ON notification_subscriptions(section_id);
+CREATE INDEX IF NOT EXISTS idx_notification_subscriptions_user ON notification_subscriptions(user_id);
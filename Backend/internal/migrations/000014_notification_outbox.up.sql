@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS notification_outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    subscription_id INT REFERENCES notification_subscriptions(id) ON DELETE SET NULL,
+    section_id      INT NOT NULL REFERENCES sections(id) ON DELETE CASCADE,
+    prayer          VARCHAR(20) NOT NULL,
+    prayer_date     DATE NOT NULL,
+    title           TEXT NOT NULL,
+    body            TEXT NOT NULL,
+    data            JSONB NOT NULL DEFAULT '{}',
+    deliver_at      TIMESTAMPTZ NOT NULL,
+    status          VARCHAR(10) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'sending', 'sent', 'failed', 'expired', 'cancelled')),
+    attempts        SMALLINT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error      TEXT,
+    sent_at         TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- One alert per device, prayer and day, however many times it is enqueued.
+    UNIQUE (subscription_id, section_id, prayer, prayer_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_due ON notification_outbox(next_attempt_at)
+    WHERE status IN ('pending', 'sending');
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_section_date ON notification_outbox(section_id, prayer_date);
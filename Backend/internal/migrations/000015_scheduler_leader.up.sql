@@ -0,0 +1,8 @@
+-- The instance that holds the scheduler advisory lock records itself here
+-- so any instance can report who the scheduler is.
+CREATE TABLE IF NOT EXISTS scheduler_leader (
+    id           SMALLINT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    instance_id  TEXT NOT NULL,
+    elected_at   TIMESTAMPTZ NOT NULL,
+    heartbeat_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS otp_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified_at;
@@ -0,0 +1,19 @@
+-- Set once the user proves they own the phone number with a code; cleared
+-- when the number changes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMPTZ;
+
+-- One-time codes sent by SMS. Codes are stored as bcrypt hashes; a code is
+-- good for one use, until it expires or runs out of attempts. Requesting a
+-- new code retires the previous one for the same number and purpose.
+CREATE TABLE IF NOT EXISTS otp_codes (
+    id           BIGSERIAL PRIMARY KEY,
+    phone_number TEXT NOT NULL,
+    purpose      TEXT NOT NULL CHECK (purpose IN ('verify_phone', 'reset_password')),
+    code_hash    TEXT NOT NULL,
+    attempts     INT NOT NULL DEFAULT 0,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    consumed_at  TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_otp_codes_lookup ON otp_codes(phone_number, purpose, created_at DESC);
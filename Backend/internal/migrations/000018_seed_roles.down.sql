@@ -0,0 +1,2 @@
+-- The administrator grants revoked by the up migration are not restored.
+DELETE FROM roles WHERE id IN (2, 3);
@@ -0,0 +1,23 @@
+-- admin (1) was the only role, and signup granted it to everyone. Regular
+-- accounts get user; editor manages content without managing accounts.
+INSERT INTO roles (id, name)
+VALUES
+    (2, 'user'),
+    (3, 'editor')
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('roles', 'id'), (SELECT MAX(id) FROM roles));
+
+-- Every existing account is at least a user.
+INSERT INTO user_roles (user_id, role_id)
+SELECT id, 2 FROM users
+ON CONFLICT DO NOTHING;
+
+-- Admin grants made by signup cannot be told apart from deliberate ones, so
+-- every one is revoked and its holder signed out. This locks the real
+-- administrators out too: once this migration is applied, restore each of
+-- them with `go run ./cmd/admin bootstrap -phone N`.
+UPDATE users SET session_version = session_version + 1
+WHERE id IN (SELECT user_id FROM user_roles WHERE role_id = 1);
+
+DELETE FROM user_roles WHERE role_id = 1;
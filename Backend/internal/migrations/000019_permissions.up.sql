@@ -0,0 +1,48 @@
+-- Permissions are named <resource>:<action>. Roles grant permissions
+-- everywhere; user_permissions grants them to one user, either everywhere
+-- (section_id NULL) or for one section only.
+CREATE TABLE IF NOT EXISTS permissions (
+    id          SERIAL PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id       INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_permissions (
+    id            SERIAL PRIMARY KEY,
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission_id INT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    section_id    INT REFERENCES sections(id) ON DELETE CASCADE,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_permissions_unique
+    ON user_permissions(user_id, permission_id, COALESCE(section_id, 0));
+
+INSERT INTO permissions (name, description)
+VALUES
+    ('users:read', 'List and view user accounts'),
+    ('users:write', 'Edit other users'' accounts'),
+    ('roles:manage', 'Grant and revoke roles and permissions'),
+    ('sections:write', 'Create, edit and delete sections'),
+    ('prayer_times:write', 'Create, edit, import and delete prayer times'),
+    ('hadiths:write', 'Create, edit and delete hadiths'),
+    ('adhkar:write', 'Create, edit and delete adhkar and their categories'),
+    ('special_topics:write', 'Create, edit and delete special topics'),
+    ('notifications:read', 'View notification delivery history')
+ON CONFLICT (name) DO NOTHING;
+
+-- admin has every permission; editor manages religious content only.
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 3, id FROM permissions
+WHERE name IN ('hadiths:write', 'adhkar:write', 'special_topics:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,26 @@
+-- One row per administrative change: who did what to which record, the
+-- record before and after, and the fields that changed.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    UUID REFERENCES users(id) ON DELETE SET NULL,
+    action      TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id   TEXT NOT NULL DEFAULT '',
+    before      JSONB,
+    after       JSONB,
+    changes     JSONB,
+    ip_address  TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+
+INSERT INTO permissions (name, description)
+VALUES ('audit:read', 'View the audit log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT 1, id FROM permissions WHERE name = 'audit:read'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS prayer_times_revisions;
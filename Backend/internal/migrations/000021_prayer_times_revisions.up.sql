@@ -0,0 +1,21 @@
+-- Every change to a day's prayer times first copies the row it replaces
+-- here, so the day's history can be shown and any earlier version restored.
+CREATE TABLE IF NOT EXISTS prayer_times_revisions (
+    id               BIGSERIAL PRIMARY KEY,
+    day              INTEGER NOT NULL,
+    month            INTEGER NOT NULL,
+    section_id       INTEGER NOT NULL REFERENCES sections(id) ON DELETE CASCADE,
+    fajr_first_time  TIME NOT NULL,
+    fajr_second_time TIME NOT NULL,
+    sunrise_time     TIME NOT NULL,
+    dhuhr_time       TIME NOT NULL,
+    asr_time         TIME NOT NULL,
+    maghrib_time     TIME NOT NULL,
+    isha_time        TIME NOT NULL,
+    action           TEXT NOT NULL,
+    changed_by       UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_prayer_times_revisions_day
+    ON prayer_times_revisions(section_id, month, day, id);
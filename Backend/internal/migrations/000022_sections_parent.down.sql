@@ -0,0 +1,5 @@
+DROP VIEW IF EXISTS effective_prayer_times;
+DROP INDEX IF EXISTS idx_sections_parent;
+ALTER TABLE sections
+    DROP COLUMN IF EXISTS prayer_offsets,
+    DROP COLUMN IF EXISTS parent_section_id;
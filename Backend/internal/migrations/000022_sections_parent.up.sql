@@ -0,0 +1,36 @@
+-- A section may follow another section's timetable, shifted per prayer by
+-- prayer_offsets minutes (keys: fajr_first, fajr_second, sunrise, dhuhr,
+-- asr, maghrib, isha). Only one level is allowed: a parent never has a
+-- parent of its own.
+ALTER TABLE sections
+    ADD COLUMN parent_section_id INTEGER REFERENCES sections(id)
+        CHECK (parent_section_id <> id),
+    ADD COLUMN prayer_offsets JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_sections_parent ON sections(parent_section_id);
+
+-- The prayer times every section actually uses: its own rows and, for days
+-- it has no row of its own, its parent's rows with the offsets applied.
+-- Derived rows have id 0.
+CREATE VIEW effective_prayer_times AS
+SELECT pt.id, pt.day, pt.month,
+       pt.fajr_first_time, pt.fajr_second_time, pt.sunrise_time, pt.dhuhr_time,
+       pt.asr_time, pt.maghrib_time, pt.isha_time,
+       pt.section_id, pt.created_at, pt.updated_at, FALSE AS derived
+FROM prayer_times pt
+UNION ALL
+SELECT 0, pt.day, pt.month,
+       pt.fajr_first_time + make_interval(mins => COALESCE((s.prayer_offsets->>'fajr_first')::INT, 0)),
+       pt.fajr_second_time + make_interval(mins => COALESCE((s.prayer_offsets->>'fajr_second')::INT, 0)),
+       pt.sunrise_time + make_interval(mins => COALESCE((s.prayer_offsets->>'sunrise')::INT, 0)),
+       pt.dhuhr_time + make_interval(mins => COALESCE((s.prayer_offsets->>'dhuhr')::INT, 0)),
+       pt.asr_time + make_interval(mins => COALESCE((s.prayer_offsets->>'asr')::INT, 0)),
+       pt.maghrib_time + make_interval(mins => COALESCE((s.prayer_offsets->>'maghrib')::INT, 0)),
+       pt.isha_time + make_interval(mins => COALESCE((s.prayer_offsets->>'isha')::INT, 0)),
+       s.id, pt.created_at, pt.updated_at, TRUE
+FROM sections s
+JOIN prayer_times pt ON pt.section_id = s.parent_section_id
+WHERE NOT EXISTS (
+    SELECT 1 FROM prayer_times own
+    WHERE own.section_id = s.id AND own.day = pt.day AND own.month = pt.month
+);
@@ -0,0 +1,12 @@
+-- Failed sign-ins, counted per phone number ('phone:<number>') and per client
+-- address ('ip:<address>'). Past a few failures each further one locks the
+-- key for a doubling time; failures are forgotten after a quiet period and
+-- the phone number's count is cleared by a successful sign-in.
+CREATE TABLE IF NOT EXISTS login_failures (
+    key            TEXT PRIMARY KEY,
+    failures       INT NOT NULL DEFAULT 0,
+    locked_until   TIMESTAMPTZ,
+    last_failed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_last_failed_at ON login_failures(last_failed_at);
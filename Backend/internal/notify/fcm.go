@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/messaging"
+	"google.golang.org/api/option"
+)
+
+// FCM delivers through Firebase Cloud Messaging; tokens are FCM registration
+// tokens.
+type FCM struct {
+	client *messaging.Client
+}
+
+// NewFCM initialises Firebase from a service-account credentials file.
+func NewFCM(ctx context.Context, credentialsFile string) (*FCM, error) {
+	if credentialsFile == "" {
+		return nil, errors.New("notify: fcm needs a credentials file")
+	}
+	app, err := firebase.NewApp(ctx, nil, option.WithCredentialsFile(credentialsFile))
+	if err != nil {
+		return nil, fmt.Errorf("notify: initialising firebase: %w", err)
+	}
+	client, err := app.Messaging(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("notify: initialising fcm: %w", err)
+	}
+	return &FCM{client: client}, nil
+}
+
+// Name implements Notifier.
+func (f *FCM) Name() string { return BackendFCM }
+
+// Send implements Notifier.
+func (f *FCM) Send(ctx context.Context, token string, msg Message) error {
+	_, err := f.client.Send(ctx, &messaging.Message{
+		Notification: &messaging.Notification{
+			Title: msg.Title,
+			Body:  msg.Body,
+		},
+		Data:  msg.Data,
+		Token: token,
+	})
+	if err != nil && messaging.IsUnregistered(err) {
+		return ErrInvalidToken
+	}
+	return err
+}
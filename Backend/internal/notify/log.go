@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Log writes notifications to a logger instead of delivering them. It is the
+// default when no push service is configured.
+type Log struct {
+	logger *slog.Logger
+}
+
+// NewLog returns a Log notifier; a nil logger writes to the default one.
+func NewLog(logger *slog.Logger) *Log {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Log{logger: logger}
+}
+
+// Name implements Notifier.
+func (l *Log) Name() string { return BackendLog }
+
+// Send implements Notifier.
+func (l *Log) Send(ctx context.Context, token string, msg Message) error {
+	l.logger.InfoContext(ctx, "notification", "device", redactToken(token), "title", msg.Title, "body", msg.Body)
+	return nil
+}
+
+// redactToken keeps enough of a token to tell devices apart in logs.
+func redactToken(token string) string {
+	if len(token) <= 8 {
+		return "…"
+	}
+	return token[:8] + "…"
+}
@@ -0,0 +1,71 @@
+// Package notify delivers push notifications to devices. The Notifier
+// interface hides the delivery backend so the scheduler and handlers do not
+// depend on Firebase, and so the server can run offline.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ErrInvalidToken is returned when the push service reports that a device
+// token or subscription no longer exists; callers should forget it.
+var ErrInvalidToken = errors.New("notify: device token is no longer valid")
+
+// Message is a notification independent of the delivery backend.
+type Message struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Notifier sends a message to one device.
+type Notifier interface {
+	Send(ctx context.Context, token string, msg Message) error
+	// Name identifies the backend in logs and health checks.
+	Name() string
+}
+
+// Backend names accepted by Config.
+const (
+	BackendFCM     = "fcm"
+	BackendWebPush = "webpush"
+	BackendLog     = "log"
+)
+
+// Config selects and configures a backend.
+type Config struct {
+	Backend string
+
+	FCMCredentialsFile string
+
+	VAPIDPublicKey  string
+	VAPIDPrivateKey string
+	VAPIDSubject    string
+}
+
+// New builds the notifier named by cfg.Backend. An empty backend picks FCM
+// when credentials are configured and the log notifier otherwise, so a
+// development machine needs no Firebase project.
+func New(ctx context.Context, cfg Config, logger *slog.Logger) (Notifier, error) {
+	backend := strings.ToLower(cfg.Backend)
+	if backend == "" {
+		backend = BackendLog
+		if cfg.FCMCredentialsFile != "" {
+			backend = BackendFCM
+		}
+	}
+
+	switch backend {
+	case BackendFCM:
+		return NewFCM(ctx, cfg.FCMCredentialsFile)
+	case BackendWebPush:
+		return NewWebPush(cfg.VAPIDPublicKey, cfg.VAPIDPrivateKey, cfg.VAPIDSubject)
+	case BackendLog:
+		return NewLog(logger), nil
+	}
+	return nil, fmt.Errorf("notify: unknown backend %q (expected %s, %s or %s)", cfg.Backend, BackendFCM, BackendWebPush, BackendLog)
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Sent is a message captured by a Recorder.
+type Sent struct {
+	Token   string
+	Message Message
+	At      time.Time
+}
+
+// Recorder keeps every message in memory instead of delivering it, for tests.
+// Tokens added with Reject make Send fail with ErrInvalidToken.
+type Recorder struct {
+	mu       sync.Mutex
+	sent     []Sent
+	rejected map[string]bool
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{rejected: make(map[string]bool)}
+}
+
+// Name implements Notifier.
+func (r *Recorder) Name() string { return "recorder" }
+
+// Send implements Notifier.
+func (r *Recorder) Send(ctx context.Context, token string, msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rejected[token] {
+		return ErrInvalidToken
+	}
+	r.sent = append(r.sent, Sent{Token: token, Message: msg, At: time.Now()})
+	return nil
+}
+
+// Reject makes later sends to token fail as an unregistered device.
+func (r *Recorder) Reject(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rejected[token] = true
+}
+
+// Sent returns a copy of the messages recorded so far.
+func (r *Recorder) Sent() []Sent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Sent(nil), r.sent...)
+}
+
+// Reset forgets the recorded messages.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = nil
+}
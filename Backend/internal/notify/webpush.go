@@ -0,0 +1,329 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// webPushTTL is how long the push service keeps an undelivered message. A
+// prayer alert is useless once the prayer has passed.
+const webPushTTL = 30 * time.Minute
+
+// webPushRecordSize is the aes128gcm record size; a notification fits in one.
+const webPushRecordSize = 4096
+
+// errPrivateEndpoint is returned for a subscription endpoint on an address
+// the server must not reach.
+var errPrivateEndpoint = errors.New("notify: push endpoint is not a public address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip does not
+// count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddress reports whether a push endpoint may be at addr. Anyone can
+// subscribe, so an endpoint must not lead the server to itself or to its
+// private network.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// checkEndpoint rejects endpoints that are not https on the default port or
+// that name a non-public address outright. Host names are checked again
+// once resolved, when the connection is made.
+func checkEndpoint(endpoint *url.URL) error {
+	if endpoint.Scheme != "https" || endpoint.User != nil || (endpoint.Port() != "" && endpoint.Port() != "443") {
+		return errors.New("notify: push endpoint must be https on the default port")
+	}
+	host := strings.ToLower(endpoint.Hostname())
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") {
+		return errPrivateEndpoint
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddress(addr) {
+		return errPrivateEndpoint
+	}
+	return nil
+}
+
+// newWebPushClient returns a client that only connects to public addresses
+// and does not follow redirects, so a subscription cannot point the server
+// at an internal host through DNS or a redirect either.
+func newWebPushClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddress(addrPort.Addr()) {
+				return errPrivateEndpoint
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// WebPush delivers to browsers through the Web Push protocol (RFC 8030) with
+// VAPID authentication (RFC 8292) and aes128gcm payload encryption (RFC 8291).
+// Tokens are the JSON PushSubscription a browser returns from
+// pushManager.subscribe.
+type WebPush struct {
+	publicKey  string // base64url uncompressed P-256 point, shared with browsers
+	privateKey *ecdsa.PrivateKey
+	subject    string
+	client     *http.Client
+}
+
+// WebPushSubscription is the browser's PushSubscription serialised as JSON.
+type WebPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// NewWebPush builds a Web Push notifier from a VAPID key pair encoded as
+// base64url (the public key as an uncompressed point, the private key as the
+// 32-byte scalar) and a contact subject, a mailto: or https: URL.
+func NewWebPush(publicKey, privateKey, subject string) (*WebPush, error) {
+	if publicKey == "" || privateKey == "" {
+		return nil, errors.New("notify: webpush needs a VAPID key pair")
+	}
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https:") {
+		return nil, errors.New("notify: VAPID subject must be a mailto: or https: URL")
+	}
+
+	pub, err := decodeBase64URL(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("notify: VAPID public key: %w", err)
+	}
+	d, err := decodeBase64URL(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("notify: VAPID private key: %w", err)
+	}
+
+	ecdhKey, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("notify: VAPID private key: %w", err)
+	}
+	point := ecdhKey.PublicKey().Bytes()
+	if !bytes.Equal(point, pub) {
+		return nil, errors.New("notify: VAPID public key does not match the private key")
+	}
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+
+	return &WebPush{
+		publicKey:  publicKey,
+		privateKey: key,
+		subject:    subject,
+		client:     newWebPushClient(),
+	}, nil
+}
+
+// Name implements Notifier.
+func (wp *WebPush) Name() string { return BackendWebPush }
+
+// PublicKey returns the VAPID application server key browsers subscribe with.
+func (wp *WebPush) PublicKey() string { return wp.publicKey }
+
+// Send implements Notifier.
+func (wp *WebPush) Send(ctx context.Context, token string, msg Message) error {
+	var sub WebPushSubscription
+	if err := json.Unmarshal([]byte(token), &sub); err != nil || sub.Endpoint == "" {
+		return ErrInvalidToken
+	}
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := checkEndpoint(endpoint); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	body, err := encryptWebPush(sub, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := wp.vapidAuthorization(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+
+	resp, err := wp.client.Do(req)
+	if err != nil {
+		if errors.Is(err, errPrivateEndpoint) {
+			return fmt.Errorf("%w: %v", ErrInvalidToken, errPrivateEndpoint)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrInvalidToken
+	case resp.StatusCode >= 300:
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notify: push service returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// vapidAuthorization signs a short-lived ES256 JWT for the push service
+// origin.
+func (wp *WebPush) vapidAuthorization(audience string) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": audience,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": wp.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, wp.privateKey, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	jwt := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return "vapid t=" + jwt + ", k=" + wp.publicKey, nil
+}
+
+// encryptWebPush encrypts payload for the subscription as a single aes128gcm
+// record (RFC 8188 with the RFC 8291 key derivation).
+func encryptWebPush(sub WebPushSubscription, payload []byte) ([]byte, error) {
+	uaPublic, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	authSecret, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil || len(authSecret) == 0 {
+		return nil, ErrInvalidToken
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asKey.PublicKey().Bytes()
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, sharedSecret, keyInfo, 32)
+
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload)+1+gcm.Overhead() > webPushRecordSize {
+		return nil, errors.New("notify: web push payload too large")
+	}
+
+	// The header is salt | record size | key id length | key id, where the key
+	// id is the application server's ephemeral public key.
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// 0x02 marks the last (and only) record.
+	plaintext := append(append([]byte(nil), payload...), 0x02)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// hkdf is HKDF-SHA256 (RFC 5869) for outputs of at most one hash block.
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers and
+// key generators disagree.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,250 @@
+// Package prayertime computes prayer times astronomically from a location and
+// a calculation method. It is used as a fallback when no curated timetable row
+// exists for a given day.
+package prayertime
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidLocation = errors.New("prayertime: latitude must be within ±90 and longitude within ±180")
+	ErrUnreachable     = errors.New("prayertime: the sun does not reach the required altitude on this date")
+)
+
+// Method describes the twilight angles used to derive Fajr and Isha.
+// When IshaMinutes is non-zero Isha is a fixed interval after Maghrib instead
+// of an angle.
+type Method struct {
+	Name        string
+	FajrAngle   float64
+	IshaAngle   float64
+	IshaMinutes int
+}
+
+var (
+	MWL       = Method{Name: "mwl", FajrAngle: 18, IshaAngle: 17}
+	ISNA      = Method{Name: "isna", FajrAngle: 15, IshaAngle: 15}
+	Egyptian  = Method{Name: "egyptian", FajrAngle: 19.5, IshaAngle: 17.5}
+	UmmAlQura = Method{Name: "ummalqura", FajrAngle: 18.5, IshaMinutes: 90}
+	Karachi   = Method{Name: "karachi", FajrAngle: 18, IshaAngle: 18}
+)
+
+var methods = map[string]Method{
+	MWL.Name:       MWL,
+	ISNA.Name:      ISNA,
+	Egyptian.Name:  Egyptian,
+	UmmAlQura.Name: UmmAlQura,
+	Karachi.Name:   Karachi,
+}
+
+// MethodByName looks up a calculation method by its (case-insensitive) name.
+func MethodByName(name string) (Method, bool) {
+	m, ok := methods[strings.ToLower(name)]
+	return m, ok
+}
+
+// MethodNames returns the names accepted by MethodByName.
+func MethodNames() []string {
+	return []string{MWL.Name, ISNA.Name, Egyptian.Name, UmmAlQura.Name, Karachi.Name}
+}
+
+// AsrMethod is the shadow-length factor used for Asr.
+type AsrMethod int
+
+const (
+	Shafii AsrMethod = 1
+	Hanafi AsrMethod = 2
+)
+
+// AsrMethodByName parses "shafii" or "hanafi".
+func AsrMethodByName(name string) (AsrMethod, bool) {
+	switch strings.ToLower(name) {
+	case "shafii":
+		return Shafii, true
+	case "hanafi":
+		return Hanafi, true
+	}
+	return 0, false
+}
+
+// Location is a point on earth with the zone its times are reported in.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	Elevation float64 // metres above sea level
+	TimeZone  *time.Location
+}
+
+// Params selects how the times are calculated.
+type Params struct {
+	Method Method
+	Asr    AsrMethod
+}
+
+// Times holds the calculated times for one day, in the location's zone.
+type Times struct {
+	Fajr    time.Time
+	Sunrise time.Time
+	Dhuhr   time.Time
+	Asr     time.Time
+	Maghrib time.Time
+	Isha    time.Time
+}
+
+// Calculate returns the prayer times for the calendar day of date at loc.
+// Only the year, month and day of date are used.
+func Calculate(date time.Time, loc Location, p Params) (Times, error) {
+	if loc.Latitude < -90 || loc.Latitude > 90 || loc.Longitude < -180 || loc.Longitude > 180 {
+		return Times{}, ErrInvalidLocation
+	}
+	tz := loc.TimeZone
+	if tz == nil {
+		tz = time.UTC
+	}
+	if p.Asr == 0 {
+		p.Asr = Shafii
+	}
+
+	y, m, d := date.Date()
+	c := calculator{
+		lat:   loc.Latitude,
+		jDate: julianDate(y, int(m), d) - loc.Longitude/(15*24),
+	}
+
+	riseSetAngle := 0.833 + 0.0347*math.Sqrt(math.Max(loc.Elevation, 0))
+
+	// Initial guesses in hours, refined once against the sun's position at
+	// those moments.
+	fajr, sunrise, dhuhr, asr, sunset, isha := 5.0, 6.0, 12.0, 13.0, 18.0, 18.0
+	for i := 0; i < 2; i++ {
+		fajr = c.sunAngleTime(p.Method.FajrAngle, fajr/24, true)
+		sunrise = c.sunAngleTime(riseSetAngle, sunrise/24, true)
+		dhuhr = c.midDay(dhuhr / 24)
+		asr = c.asrTime(float64(p.Asr), asr/24)
+		sunset = c.sunAngleTime(riseSetAngle, sunset/24, false)
+		if p.Method.IshaMinutes == 0 {
+			isha = c.sunAngleTime(p.Method.IshaAngle, isha/24, false)
+		}
+	}
+	if math.IsNaN(sunrise) || math.IsNaN(sunset) || math.IsNaN(dhuhr) || math.IsNaN(asr) {
+		return Times{}, ErrUnreachable
+	}
+
+	// At high latitudes twilight may never end; fall back to a fraction of
+	// the night proportional to the angle (the "angle based" rule).
+	night := timeDiff(sunset, sunrise)
+	fajrPortion := p.Method.FajrAngle / 60 * night
+	if math.IsNaN(fajr) || timeDiff(fajr, sunrise) > fajrPortion {
+		fajr = sunrise - fajrPortion
+	}
+	if p.Method.IshaMinutes > 0 {
+		isha = sunset + float64(p.Method.IshaMinutes)/60
+	} else {
+		ishaPortion := p.Method.IshaAngle / 60 * night
+		if math.IsNaN(isha) || timeDiff(sunset, isha) > ishaPortion {
+			isha = sunset + ishaPortion
+		}
+	}
+
+	// Hours so far are relative to local mean time; convert to UT.
+	offset := -loc.Longitude / 15
+	base := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	at := func(h float64) time.Time {
+		return base.Add(time.Duration((h + offset) * float64(time.Hour))).In(tz)
+	}
+
+	return Times{
+		Fajr:    at(fajr),
+		Sunrise: at(sunrise),
+		Dhuhr:   at(dhuhr),
+		Asr:     at(asr),
+		Maghrib: at(sunset),
+		Isha:    at(isha),
+	}, nil
+}
+
+type calculator struct {
+	lat   float64
+	jDate float64
+}
+
+// sunPosition returns the sun's declination (degrees) and the equation of
+// time (hours) for the given Julian date.
+func sunPosition(jd float64) (decl, eqt float64) {
+	d := jd - 2451545.0
+	g := fixAngle(357.529 + 0.98560028*d)
+	q := fixAngle(280.459 + 0.98564736*d)
+	l := fixAngle(q + 1.915*dsin(g) + 0.020*dsin(2*g))
+	e := 23.439 - 0.00000036*d
+
+	ra := darctan2(dcos(e)*dsin(l), dcos(l)) / 15
+	eqt = q/15 - fixHour(ra)
+	decl = darcsin(dsin(e) * dsin(l))
+	return decl, eqt
+}
+
+func (c calculator) midDay(t float64) float64 {
+	_, eqt := sunPosition(c.jDate + t)
+	return fixHour(12 - eqt)
+}
+
+// sunAngleTime returns the time at which the sun is angle degrees below the
+// horizon, before noon when ccw is set and after it otherwise.
+func (c calculator) sunAngleTime(angle, t float64, ccw bool) float64 {
+	decl, _ := sunPosition(c.jDate + t)
+	noon := c.midDay(t)
+	x := (-dsin(angle) - dsin(decl)*dsin(c.lat)) / (dcos(decl) * dcos(c.lat))
+	if x < -1 || x > 1 {
+		return math.NaN()
+	}
+	h := darccos(x) / 15
+	if ccw {
+		return noon - h
+	}
+	return noon + h
+}
+
+func (c calculator) asrTime(factor, t float64) float64 {
+	decl, _ := sunPosition(c.jDate + t)
+	angle := -darccot(factor + dtan(math.Abs(c.lat-decl)))
+	return c.sunAngleTime(angle, t, false)
+}
+
+// julianDate returns the Julian date at 0h UT of the given Gregorian date.
+func julianDate(year, month, day int) float64 {
+	if month <= 2 {
+		year--
+		month += 12
+	}
+	a := math.Floor(float64(year) / 100)
+	b := 2 - a + math.Floor(a/4)
+	return math.Floor(365.25*float64(year+4716)) + math.Floor(30.6001*float64(month+1)) + float64(day) + b - 1524.5
+}
+
+func timeDiff(t1, t2 float64) float64 { return fixHour(t2 - t1) }
+
+func fixAngle(a float64) float64 { return fix(a, 360) }
+func fixHour(a float64) float64  { return fix(a, 24) }
+
+func fix(a, b float64) float64 {
+	a = a - b*math.Floor(a/b)
+	if a < 0 {
+		a += b
+	}
+	return a
+}
+
+func dtr(d float64) float64 { return d * math.Pi / 180 }
+func rtd(r float64) float64 { return r * 180 / math.Pi }
+
+func dsin(d float64) float64        { return math.Sin(dtr(d)) }
+func dcos(d float64) float64        { return math.Cos(dtr(d)) }
+func dtan(d float64) float64        { return math.Tan(dtr(d)) }
+func darcsin(x float64) float64     { return rtd(math.Asin(x)) }
+func darccos(x float64) float64     { return rtd(math.Acos(x)) }
+func darctan2(y, x float64) float64 { return rtd(math.Atan2(y, x)) }
+func darccot(x float64) float64     { return rtd(math.Atan(1 / x)) }
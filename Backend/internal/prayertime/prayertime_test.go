@@ -0,0 +1,123 @@
+package prayertime
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// tolerance allows for the low-precision solar formulae PrayTimes uses; the
+// reference times below come from the NOAA solar position algorithm.
+const tolerance = time.Minute
+
+var (
+	tripoli = Location{Latitude: 32.8872, Longitude: 13.1913, TimeZone: time.FixedZone("EET", 2*60*60)}
+	mecca   = Location{Latitude: 21.4225, Longitude: 39.8262, TimeZone: time.FixedZone("AST", 3*60*60)}
+)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name string
+		date string
+		loc  Location
+		p    Params
+		// Fajr, Sunrise, Dhuhr, Asr, Maghrib, Isha as local HH:MM
+		want [6]string
+	}{
+		{"Tripoli winter", "2024-01-15", tripoli, Params{Method: MWL}, [6]string{"06:43", "08:10", "13:16", "16:04", "18:23", "19:45"}},
+		{"Tripoli equinox", "2024-03-20", tripoli, Params{Method: MWL}, [6]string{"05:48", "07:11", "13:15", "16:42", "19:19", "20:37"}},
+		{"Tripoli summer solstice", "2024-06-21", tripoli, Params{Method: MWL}, [6]string{"04:17", "05:59", "13:09", "16:52", "20:19", "21:54"}},
+		{"Tripoli autumn", "2024-09-22", tripoli, Params{Method: MWL}, [6]string{"05:33", "06:56", "13:00", "16:27", "19:04", "20:21"}},
+		{"Tripoli winter solstice", "2024-12-21", tripoli, Params{Method: MWL}, [6]string{"06:38", "08:06", "13:06", "15:47", "18:05", "19:28"}},
+		{"Mecca Umm al-Qura", "2024-04-10", mecca, Params{Method: UmmAlQura}, [6]string{"04:48", "06:06", "12:22", "15:47", "18:39", "20:09"}},
+		{"Mecca Hanafi Asr", "2024-04-10", mecca, Params{Method: UmmAlQura, Asr: Hanafi}, [6]string{"04:48", "06:06", "12:22", "16:51", "18:39", "20:09"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, err := time.Parse(time.DateOnly, tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			times, err := Calculate(date, tt.loc, tt.p)
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+
+			got := [6]time.Time{times.Fajr, times.Sunrise, times.Dhuhr, times.Asr, times.Maghrib, times.Isha}
+			names := [6]string{"Fajr", "Sunrise", "Dhuhr", "Asr", "Maghrib", "Isha"}
+			for i, clock := range tt.want {
+				at, err := time.ParseInLocation(time.DateOnly+" 15:04", tt.date+" "+clock, tt.loc.TimeZone)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := got[i].Sub(at).Abs(); diff > tolerance {
+					t.Errorf("%s = %s, want %s (off by %s)", names[i], got[i].Format("15:04:05"), clock, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateFixedIshaInterval(t *testing.T) {
+	times, err := Calculate(time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC), mecca, Params{Method: UmmAlQura})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := times.Isha.Sub(times.Maghrib); got.Round(time.Second) != 90*time.Minute {
+		t.Errorf("Isha is %s after Maghrib, want 90m", got)
+	}
+}
+
+// In London around the summer solstice the sun never gets 18° below the
+// horizon, so Fajr and Isha fall back to a share of the night proportional
+// to their angles.
+func TestCalculateHighLatitudeFallback(t *testing.T) {
+	london := Location{Latitude: 51.5074, Longitude: -0.1278}
+	times, err := Calculate(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), london, Params{Method: MWL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	night := times.Sunrise.Add(24 * time.Hour).Sub(times.Maghrib)
+	wantFajr := times.Sunrise.Add(-time.Duration(MWL.FajrAngle / 60 * float64(night)))
+	wantIsha := times.Maghrib.Add(time.Duration(MWL.IshaAngle / 60 * float64(night)))
+	if diff := times.Fajr.Sub(wantFajr).Abs(); diff > time.Second {
+		t.Errorf("Fajr = %s, want %s", times.Fajr.Format("15:04:05"), wantFajr.Format("15:04:05"))
+	}
+	if diff := times.Isha.Sub(wantIsha).Abs(); diff > time.Second {
+		t.Errorf("Isha = %s, want %s", times.Isha.Format("15:04:05"), wantIsha.Format("15:04:05"))
+	}
+
+	// Sunrise and sunset are still astronomical: 04:43 and 21:21 BST
+	for _, c := range []struct {
+		name string
+		got  time.Time
+		want time.Time
+	}{
+		{"Sunrise", times.Sunrise, time.Date(2024, 6, 21, 3, 43, 0, 0, time.UTC)},
+		{"Maghrib", times.Maghrib, time.Date(2024, 6, 21, 20, 21, 0, 0, time.UTC)},
+	} {
+		if diff := c.got.Sub(c.want).Abs(); diff > tolerance {
+			t.Errorf("%s = %s, want %s", c.name, c.got.Format("15:04:05"), c.want.Format("15:04"))
+		}
+	}
+}
+
+func TestCalculateErrors(t *testing.T) {
+	date := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		loc  Location
+		want error
+	}{
+		{"latitude out of range", Location{Latitude: 91}, ErrInvalidLocation},
+		{"longitude out of range", Location{Longitude: -181}, ErrInvalidLocation},
+		{"midnight sun", Location{Latitude: 70, Longitude: 25}, ErrUnreachable},
+	}
+	for _, tt := range tests {
+		if _, err := Calculate(date, tt.loc, Params{Method: MWL}); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+// Package sms sends text messages, such as one-time verification codes, to
+// phone numbers. The Sender interface hides the SMS provider so handlers do
+// not depend on one, and so the server can run without an account.
+package sms
+
+import "context"
+
+// Sender delivers a text message to one phone number.
+type Sender interface {
+	Send(ctx context.Context, phoneNumber, body string) error
+	// Name identifies the provider in logs.
+	Name() string
+}
@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SigningKey is a key access tokens are signed or verified with, named by
+// the kid header of the tokens it signs. A key without private material can
+// only verify, which is how a retired asymmetric key is kept around until
+// the tokens it signed have expired.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign reports whether the key holds private material.
+func (k *SigningKey) CanSign() bool { return k.signKey != nil }
+
+// tokenKeys is the key set and claims tokens are issued and checked with.
+var tokenKeys struct {
+	sync.RWMutex
+	issuer   string
+	audience string
+	active   *SigningKey
+	byID     map[string]*SigningKey
+}
+
+// ConfigureTokens installs the signing keys and the iss/aud claims. Tokens
+// are signed with the key named active; every key in keys is accepted when
+// verifying, so keys can be rotated without signing everyone out.
+func ConfigureTokens(issuer, audience string, keys []*SigningKey, active string) error {
+	if issuer == "" || audience == "" {
+		return errors.New("jwt: issuer and audience are required")
+	}
+	byID := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		if _, ok := byID[key.ID]; ok {
+			return fmt.Errorf("jwt: duplicate key id %q", key.ID)
+		}
+		byID[key.ID] = key
+	}
+	activeKey, ok := byID[active]
+	if !ok {
+		return fmt.Errorf("jwt: active key %q is not configured", active)
+	}
+	if !activeKey.CanSign() {
+		return fmt.Errorf("jwt: active key %q has no private key", active)
+	}
+
+	tokenKeys.Lock()
+	defer tokenKeys.Unlock()
+	tokenKeys.issuer = issuer
+	tokenKeys.audience = audience
+	tokenKeys.active = activeKey
+	tokenKeys.byID = byID
+	return nil
+}
+
+// signingKeyFor returns the verification key named by the token's kid,
+// refusing a token whose alg differs from the key's.
+func signingKeyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	tokenKeys.RLock()
+	key, ok := tokenKeys.byID[kid]
+	tokenKeys.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// signingKeyFile is the JSON form of the key set:
+//
+//	{"active": "2025-06", "keys": [
+//	  {"kid": "2025-06", "alg": "EdDSA", "private_key_file": "/secrets/jwt-2025-06.pem"},
+//	  {"kid": "2025-01", "alg": "HS256", "secret": "<base64>"}
+//	]}
+//
+// HS256 keys take a base64 secret of at least 32 bytes. RS256 and EdDSA keys
+// take a PEM private key (PKCS#1 or PKCS#8) or, to only verify, a PEM public
+// key, either inline or from a file.
+type signingKeyFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		ID             string `json:"kid"`
+		Alg            string `json:"alg"`
+		Secret         string `json:"secret"`
+		PrivateKey     string `json:"private_key"`
+		PrivateKeyFile string `json:"private_key_file"`
+		PublicKey      string `json:"public_key"`
+		PublicKeyFile  string `json:"public_key_file"`
+	} `json:"keys"`
+}
+
+// LoadSigningKeys reads a key set from JSON, given inline or as the path of
+// a file, and returns the keys and the id of the active one.
+func LoadSigningKeys(source string) ([]*SigningKey, string, error) {
+	raw := []byte(source)
+	if !strings.HasPrefix(strings.TrimSpace(source), "{") {
+		var err error
+		raw, err = os.ReadFile(source)
+		if err != nil {
+			return nil, "", fmt.Errorf("jwt: reading key set: %w", err)
+		}
+	}
+
+	var file signingKeyFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, "", fmt.Errorf("jwt: parsing key set: %w", err)
+	}
+	if len(file.Keys) == 0 {
+		return nil, "", errors.New("jwt: the key set has no keys")
+	}
+
+	keys := make([]*SigningKey, 0, len(file.Keys))
+	for _, entry := range file.Keys {
+		if entry.ID == "" {
+			return nil, "", errors.New("jwt: every key needs a kid")
+		}
+		privatePEM, err := readInlineOrFile(entry.PrivateKey, entry.PrivateKeyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("jwt: key %q: %w", entry.ID, err)
+		}
+		publicPEM, err := readInlineOrFile(entry.PublicKey, entry.PublicKeyFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("jwt: key %q: %w", entry.ID, err)
+		}
+
+		var key *SigningKey
+		switch entry.Alg {
+		case "HS256":
+			secret, err := base64.StdEncoding.DecodeString(entry.Secret)
+			if err != nil {
+				return nil, "", fmt.Errorf("jwt: key %q: secret is not base64: %w", entry.ID, err)
+			}
+			key, err = NewHMACKey(entry.ID, secret)
+			if err != nil {
+				return nil, "", err
+			}
+		case "RS256":
+			key, err = parseRSAKey(entry.ID, privatePEM, publicPEM)
+		case "EdDSA":
+			key, err = parseEd25519Key(entry.ID, privatePEM, publicPEM)
+		default:
+			return nil, "", fmt.Errorf("jwt: key %q: unsupported alg %q (expected HS256, RS256 or EdDSA)", entry.ID, entry.Alg)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("jwt: key %q: %w", entry.ID, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, file.Active, nil
+}
+
+// NewHMACKey returns an HS256 key.
+func NewHMACKey(id string, secret []byte) (*SigningKey, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("jwt: key %q: HS256 secrets must be at least 32 bytes", id)
+	}
+	return &SigningKey{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// NewRandomHMACKey returns an HS256 key with a random secret, for
+// development; tokens signed with it do not survive a restart.
+func NewRandomHMACKey(id string) (*SigningKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return NewHMACKey(id, secret)
+}
+
+func readInlineOrFile(inline, path string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	return nil, nil
+}
+
+func parseRSAKey(id string, privatePEM, publicPEM []byte) (*SigningKey, error) {
+	key := &SigningKey{ID: id, Method: jwt.SigningMethodRS256}
+	switch {
+	case privatePEM != nil:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return nil, err
+		}
+		key.signKey, key.verifyKey = private, &private.PublicKey
+	case publicPEM != nil:
+		public, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+		if err != nil {
+			return nil, err
+		}
+		key.verifyKey = public
+	default:
+		return nil, errors.New("RS256 keys need a private or public key")
+	}
+	if key.verifyKey.(*rsa.PublicKey).N.BitLen() < 2048 {
+		return nil, errors.New("RS256 keys must be at least 2048 bits")
+	}
+	return key, nil
+}
+
+func parseEd25519Key(id string, privatePEM, publicPEM []byte) (*SigningKey, error) {
+	key := &SigningKey{ID: id, Method: SigningMethodEdDSA}
+	switch {
+	case privatePEM != nil:
+		block, _ := pem.Decode(privatePEM)
+		if block == nil {
+			return nil, errors.New("private key is not PEM")
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("private key is not an Ed25519 key")
+		}
+		key.signKey, key.verifyKey = private, private.Public()
+	case publicPEM != nil:
+		block, _ := pem.Decode(publicPEM)
+		if block == nil {
+			return nil, errors.New("public key is not PEM")
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		public, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an Ed25519 key")
+		}
+		key.verifyKey = public
+	default:
+		return nil, errors.New("EdDSA keys need a private or public key")
+	}
+	return key, nil
+}
+
+// signingMethodEdDSA implements the EdDSA (Ed25519) JWS algorithm of
+// RFC 8037, which jwt-go does not provide.
+type signingMethodEdDSA struct{}
+
+// SigningMethodEdDSA signs with an ed25519.PrivateKey and verifies with an
+// ed25519.PublicKey.
+var SigningMethodEdDSA jwt.SigningMethod = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod("EdDSA", func() jwt.SigningMethod { return SigningMethodEdDSA })
+}
+
+func (m *signingMethodEdDSA) Alg() string { return "EdDSA" }
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return errors.New("EdDSA signature is invalid")
+	}
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
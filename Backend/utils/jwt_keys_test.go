@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testIssuer   = "islam-backend"
+	testAudience = "islam-app"
+)
+
+// testKeys holds one key of each kind, generated once per run.
+var testKeys struct {
+	hmac    *SigningKey
+	rsa     *SigningKey
+	rsaPEM  []byte // PKIX public key
+	ed25519 *SigningKey
+}
+
+func init() {
+	var err error
+	testKeys.hmac, err = NewHMACKey("hmac", bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		panic(err)
+	}
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	testKeys.rsa = &SigningKey{ID: "rsa", Method: jwt.SigningMethodRS256, signKey: private, verifyKey: &private.PublicKey}
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	testKeys.rsaPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	public, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	testKeys.ed25519 = &SigningKey{ID: "ed25519", Method: SigningMethodEdDSA, signKey: edPrivate, verifyKey: public}
+}
+
+func configureTestTokens(t *testing.T, active string, keys ...*SigningKey) {
+	t.Helper()
+	if err := ConfigureTokens(testIssuer, testAudience, keys, active); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signTestToken signs claims with the given method, kid and raw key, the way
+// a forger would.
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testClaims(overrides jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"id":  "user",
+		"sv":  1,
+		"iss": testIssuer,
+		"aud": testAudience,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+	}
+	for name, value := range overrides {
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestNewHMACKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		length int
+		ok     bool
+	}{
+		{"empty", 0, false},
+		{"31 bytes", 31, false},
+		{"32 bytes", 32, true},
+		{"64 bytes", 64, true},
+	}
+	for _, tt := range tests {
+		_, err := NewHMACKey("k", bytes.Repeat([]byte("s"), tt.length))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	configureTestTokens(t, "rsa", testKeys.rsa, testKeys.hmac, testKeys.ed25519)
+	rsaPrivate := testKeys.rsa.signKey
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"RS256", signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, testClaims(nil)), true},
+		{"HS256", signTestToken(t, jwt.SigningMethodHS256, "hmac", testKeys.hmac.signKey, testClaims(nil)), true},
+		{"EdDSA", signTestToken(t, SigningMethodEdDSA, "ed25519", testKeys.ed25519.signKey, testClaims(nil)), true},
+
+		{"unknown kid", signTestToken(t, jwt.SigningMethodRS256, "retired", rsaPrivate, testClaims(nil)), false},
+		{"no kid", signTestToken(t, jwt.SigningMethodRS256, "", rsaPrivate, testClaims(nil)), false},
+		// The classic confusion: an HS256 token keyed with the RSA public key
+		{"HS256 against an RS256 key", signTestToken(t, jwt.SigningMethodHS256, "rsa", testKeys.rsaPEM, testClaims(nil)), false},
+		{"RS256 against an HS256 key", signTestToken(t, jwt.SigningMethodRS256, "hmac", rsaPrivate, testClaims(nil)), false},
+		{"signed with another key", signTestToken(t, jwt.SigningMethodHS256, "hmac", bytes.Repeat([]byte("x"), 32), testClaims(nil)), false},
+
+		{"wrong issuer", signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, testClaims(jwt.MapClaims{"iss": "someone-else"})), false},
+		{"no issuer", signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, testClaims(jwt.MapClaims{"iss": ""})), false},
+		{"wrong audience", signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, testClaims(jwt.MapClaims{"aud": "other-app"})), false},
+		{"no audience", signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, testClaims(jwt.MapClaims{"aud": ""})), false},
+		{"expired", signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, testClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), false},
+		{"garbage", "not.a.token", false},
+	}
+	for _, tt := range tests {
+		_, err := ValidateToken(tt.token)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+
+	// iss and aud failures are told apart from bad signatures
+	token := signTestToken(t, jwt.SigningMethodRS256, "rsa", rsaPrivate, testClaims(jwt.MapClaims{"aud": "other-app"}))
+	if _, err := ValidateToken(token); !errors.Is(err, ErrInvalidClaims) {
+		t.Errorf("wrong audience: err = %v, want ErrInvalidClaims", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	configureTestTokens(t, "hmac", testKeys.hmac)
+	old, err := GenerateToken("user", []string{"user"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key signs while the old one is kept to verify
+	configureTestTokens(t, "rsa", testKeys.rsa, testKeys.hmac)
+	current, err := GenerateToken("user", []string{"user"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ValidateToken(current)
+	if err != nil {
+		t.Fatalf("token of the new key: %v", err)
+	}
+	if kid := parsed.Header["kid"]; kid != "rsa" || parsed.Method.Alg() != "RS256" {
+		t.Errorf("new token signed with kid %v and %s, want rsa and RS256", kid, parsed.Method.Alg())
+	}
+	parsed, err = ValidateToken(old)
+	if err != nil {
+		t.Fatalf("token of the old key after rotation: %v", err)
+	}
+	if kid := parsed.Header["kid"]; kid != "hmac" {
+		t.Errorf("old token has kid %v, want hmac", kid)
+	}
+
+	// Once the old key is dropped its tokens stop working
+	configureTestTokens(t, "rsa", testKeys.rsa)
+	if _, err := ValidateToken(old); err == nil {
+		t.Error("token of a dropped key was accepted")
+	}
+	if _, err := ValidateToken(current); err != nil {
+		t.Errorf("token of the active key: %v", err)
+	}
+}
+
+func TestConfigureTokens(t *testing.T) {
+	verifyOnly := &SigningKey{ID: "public", Method: jwt.SigningMethodRS256, verifyKey: testKeys.rsa.verifyKey}
+
+	tests := []struct {
+		name             string
+		issuer, audience string
+		keys             []*SigningKey
+		active           string
+		ok               bool
+	}{
+		{"valid", testIssuer, testAudience, []*SigningKey{testKeys.rsa, verifyOnly}, "rsa", true},
+		{"no issuer", "", testAudience, []*SigningKey{testKeys.rsa}, "rsa", false},
+		{"no audience", testIssuer, "", []*SigningKey{testKeys.rsa}, "rsa", false},
+		{"active key missing", testIssuer, testAudience, []*SigningKey{testKeys.rsa}, "hmac", false},
+		{"active key cannot sign", testIssuer, testAudience, []*SigningKey{testKeys.rsa, verifyOnly}, "public", false},
+		{"duplicate kid", testIssuer, testAudience, []*SigningKey{testKeys.rsa, testKeys.rsa}, "rsa", false},
+	}
+	for _, tt := range tests {
+		err := ConfigureTokens(tt.issuer, tt.audience, tt.keys, tt.active)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.name, err)
+		}
+	}
+}
+
+func TestLoadSigningKeys(t *testing.T) {
+	type entry map[string]string
+	keySet := func(entries ...entry) string {
+		raw, err := json.Marshal(map[string]interface{}{"active": "a", "keys": entries})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(raw)
+	}
+	secret := func(length int) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("s"), length))
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		ok     bool
+	}{
+		{"HS256", keySet(entry{"kid": "a", "alg": "HS256", "secret": secret(32)}), true},
+		{"HS256 secret under 32 bytes", keySet(entry{"kid": "a", "alg": "HS256", "secret": secret(31)}), false},
+		{"HS256 secret not base64", keySet(entry{"kid": "a", "alg": "HS256", "secret": "%%%"}), false},
+		{"RS256 public key", keySet(entry{"kid": "a", "alg": "RS256", "public_key": string(testKeys.rsaPEM)}), true},
+		{"RS256 without a key", keySet(entry{"kid": "a", "alg": "RS256"}), false},
+		{"EdDSA key that is RSA", keySet(entry{"kid": "a", "alg": "EdDSA", "public_key": string(testKeys.rsaPEM)}), false},
+		{"unsupported alg", keySet(entry{"kid": "a", "alg": "none"}), false},
+		{"no kid", keySet(entry{"alg": "HS256", "secret": secret(32)}), false},
+		{"no keys", keySet(), false},
+		{"missing file", "/nonexistent/jwt-keys.json", false},
+	}
+	for _, tt := range tests {
+		keys, active, err := LoadSigningKeys(tt.source)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v", tt.name, err)
+			continue
+		}
+		if tt.ok && (len(keys) != 1 || keys[0].ID != "a" || active != "a") {
+			t.Errorf("%s: got %d keys, active %q", tt.name, len(keys), active)
+		}
+	}
+}
@@ -1,17 +1,21 @@
 package utils
 
 import (
+	"context"
+	crand "crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"math/big"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Masterminds/squirrel"
@@ -50,6 +54,13 @@ var (
 	ErrExpiredToken  = errors.New("token has expired")
 	ErrMissingToken  = errors.New("missing authorization token")
 	ErrInvalidClaims = errors.New("invalid token claims")
+	ErrRevokedToken  = errors.New("token has been revoked")
+)
+
+// Token lifetimes; main sets them from configuration.
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
 )
 
 func SendJSONResponse(w http.ResponseWriter, status int, data Envelope) error {
@@ -105,7 +116,7 @@ func SaveFile(file io.Reader, table string, filename string) (string, error) {
 	fullPath := filepath.Join("uploads", table)
 
 	if err := os.MkdirAll(fullPath, os.ModePerm); err != nil {
-		log.Printf("Error creating directory: %v", err)
+		slog.Error("Error creating directory", "path", fullPath, "error", err)
 		return "", err
 	}
 
@@ -118,13 +129,13 @@ func SaveFile(file io.Reader, table string, filename string) (string, error) {
 
 	destFile, err := os.Create(newFilePath)
 	if err != nil {
-		log.Printf("Error creating file: %v", err)
+		slog.Error("Error creating file", "path", newFilePath, "error", err)
 		return "", err
 	}
 	defer destFile.Close()
 
 	if _, err := io.Copy(destFile, file); err != nil {
-		log.Printf("Error copying file: %v", err)
+		slog.Error("Error copying file", "path", newFilePath, "error", err)
 		return "", err
 	}
 
@@ -138,7 +149,7 @@ func DeleteFile(filePath string) error {
 	filePath = filepath.FromSlash(filePath)
 
 	if err := os.Remove(filePath); err != nil {
-		log.Printf("Error deleting file %s: %v", filePath, err)
+		slog.Error("Error deleting file", "path", filePath, "error", err)
 		return fmt.Errorf("could not delete file: %v", err)
 	}
 	return nil
@@ -162,19 +173,32 @@ func NormalizeFloatInput(input string) string {
 	return input + ".0"
 }
 
-var jwtSecret = []byte("ahmedpa55wordforitmajormarjcomputerscience")
+// GenerateToken issues a short-lived access token. sessionVersion is the
+// user's session version at issue time; the token stops being accepted once
+// the version moves on.
+func GenerateToken(userID string, userRole []string, sessionVersion int) (string, error) {
+	tokenKeys.RLock()
+	key, issuer, audience := tokenKeys.active, tokenKeys.issuer, tokenKeys.audience
+	tokenKeys.RUnlock()
+	if key == nil {
+		return "", errors.New("jwt: no signing key configured")
+	}
 
-func GenerateToken(userID string, userRole []string) (string, error) {
-	expirationTime := time.Now().Add(time.Hour * 24).Unix() // 24 hours expiration time
+	now := time.Now()
 
 	claims := &jwt.MapClaims{
 		"id":        userID,
 		"user_role": userRole,
-		"exp":       expirationTime,
+		"sv":        sessionVersion,
+		"iss":       issuer,
+		"aud":       audience,
+		"iat":       now.Unix(),
+		"exp":       now.Add(AccessTokenTTL).Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -185,24 +209,60 @@ func SetTokenCookie(w http.ResponseWriter, token string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "accessToken",
 		Value:    token,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  time.Now().Add(AccessTokenTTL),
 		HttpOnly: true,
 		Secure:   true,
 		Path:     "/",
 	})
 }
+
+// RefreshTokenCookie is the cookie holding the refresh token. It is only
+// sent to the auth endpoints.
+const RefreshTokenCookie = "refreshToken"
+
+func SetRefreshTokenCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookie,
+		Value:    token,
+		Expires:  time.Now().Add(RefreshTokenTTL),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/auth",
+	})
+}
+
+// ClearTokenCookies removes the access and refresh token cookies.
+func ClearTokenCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "accessToken", Path: "/", MaxAge: -1, HttpOnly: true, Secure: true})
+	http.SetCookie(w, &http.Cookie{Name: RefreshTokenCookie, Path: "/auth", MaxAge: -1, HttpOnly: true, Secure: true})
+}
+
+// ValidateToken checks the signature of a token against the key named by
+// its kid header, its expiry, and that it was issued by and for this server.
 func ValidateToken(tokenString string) (*jwt.Token, error) {
 	segments := strings.Split(tokenString, ".")
 	if len(segments) != 3 {
 		return nil, fmt.Errorf("token contains an invalid number of segments")
 	}
 
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(jwtSecret), nil
-	})
+	token, err := jwt.Parse(tokenString, signingKeyFor)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidClaims
+	}
+	tokenKeys.RLock()
+	issuer, audience := tokenKeys.issuer, tokenKeys.audience
+	tokenKeys.RUnlock()
+	if !claims.VerifyIssuer(issuer, true) || !claims.VerifyAudience(audience, true) {
+		return nil, ErrInvalidClaims
+	}
+
+	return token, nil
 }
 
 func CheckPassword(storedHash, password string) bool {
@@ -210,6 +270,21 @@ func CheckPassword(storedHash, password string) bool {
 	return err == nil
 }
 
+// absentPasswordHash stands in for the hash of an account that does not
+// exist; it is made once, at the cost real hashes are made at.
+var absentPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("absent account")
+	return hash
+})
+
+// CheckAbsentPassword does the work of CheckPassword when there is no
+// account to check against, so a sign-in for an unknown phone number takes
+// as long as one with a wrong password. It always fails.
+func CheckAbsentPassword(password string) bool {
+	CheckPassword(absentPasswordHash(), password)
+	return false
+}
+
 // ParseBoolOrDefault parses a string into a boolean, or returns a default value if parsing fails.
 func ParseBoolOrDefault(value string, defaultValue bool) (bool, error) {
 	if value == "" {
@@ -217,7 +292,7 @@ func ParseBoolOrDefault(value string, defaultValue bool) (bool, error) {
 	}
 	return strconv.ParseBool(value)
 }
-func BuildPrayerTimesQuery(dest interface{}, table string, joins []string, columns []string, searchCols []string, queryParams url.Values, additionalFilters []string, orderBy []string) (*Meta, error) {
+func BuildPrayerTimesQuery(ctx context.Context, dest interface{}, table string, joins []string, columns []string, searchCols []string, queryParams url.Values, additionalFilters []string, orderBy []string) (*Meta, error) {
 	// Extract query parameters
 	q := queryParams.Get("q")
 	filters := queryParams.Get("filters")
@@ -266,7 +341,7 @@ func BuildPrayerTimesQuery(dest interface{}, table string, joins []string, colum
 	}
 
 	var total int
-	if err := db.QueryRow(countSQL, countArgs...).Scan(&total); err != nil {
+	if err := db.QueryRowContext(ctx, countSQL, countArgs...).Scan(&total); err != nil {
 		return nil, err
 	}
 
@@ -301,10 +376,11 @@ func BuildPrayerTimesQuery(dest interface{}, table string, joins []string, colum
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("Generated SQL: %s", sql)
-	log.Printf("Query args: %v", args)
+	// Arguments are search terms and filter values, often personal data;
+	// only their number is logged.
+	slog.DebugContext(ctx, "List query", "sql", sql, "args", len(args))
 
-	if err := db.Select(dest, sql, args...); err != nil {
+	if err := db.SelectContext(ctx, dest, sql, args...); err != nil {
 		return nil, err
 	}
 
@@ -321,7 +397,7 @@ func BuildPrayerTimesQuery(dest interface{}, table string, joins []string, colum
 
 	return &meta, nil
 }
-func BuildQuery(dest interface{}, table string,
+func BuildQuery(ctx context.Context, dest interface{}, table string,
 	joins []string, columns []string,
 	searchCols []string, queryParams url.Values,
 	additionalFilters []string) (*Meta, error) {
@@ -370,7 +446,7 @@ func BuildQuery(dest interface{}, table string,
 	}
 
 	var total int
-	if err := db.QueryRow(countSQL, countArgs...).Scan(&total); err != nil {
+	if err := db.QueryRowContext(ctx, countSQL, countArgs...).Scan(&total); err != nil {
 		return nil, err
 	}
 
@@ -412,10 +488,9 @@ func BuildQuery(dest interface{}, table string,
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("Generated SQL: %s", sql)
-	log.Printf("Query args: %v", args)
+	slog.DebugContext(ctx, "List query", "sql", sql, "args", len(args))
 
-	if err := db.Select(dest, sql, args...); err != nil {
+	if err := db.SelectContext(ctx, dest, sql, args...); err != nil {
 		return nil, err
 	}
 
@@ -431,20 +506,24 @@ func BuildQuery(dest interface{}, table string,
 
 	return &meta, nil
 }
-func GenerateRandomCode() string {
+
+// GenerateRandomCode returns a six-digit one-time code drawn from a
+// cryptographically secure source.
+func GenerateRandomCode() (string, error) {
 	const digits = "0123456789"
 
-	rand.Seed(uint64(time.Now().UnixNano()))
 	code := make([]byte, 6)
-
 	for i := range code {
-		randomIndex := rand.Intn(len(digits))
-
-		code[i] = digits[randomIndex]
+		n, err := crand.Int(crand.Reader, big.NewInt(int64(len(digits))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = digits[n.Int64()]
 	}
 
-	return string(code)
+	return string(code), nil
 }
+
 func StringPointer(s string) *string {
 	return &s
 }